@@ -0,0 +1,503 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+)
+
+// Errors returned when checking the signature of a Cabinet file.
+var (
+	ErrNoSignature      = errors.New("cabfile: no signature")
+	ErrInvalidSignature = errors.New("cabfile: invalid signature")
+)
+
+// Signed Cabinet files reserve 20 bytes in the header, starting with
+// signatureMagic and followed by the offset and the size of the signature,
+// which is appended to the Cabinet file.
+const signatureReserveSize = 20
+
+var signatureMagic = []byte{0x00, 0x00, 0x10, 0x00}
+
+// signatureRange returns the offset and the size of the signature recorded
+// in the header reserve area, reporting whether there is one.
+func (c *Cabinet) signatureRange() (off, n int64, ok bool) {
+	res := c.hdr.Reserve
+	if len(res) != signatureReserveSize || !bytes.Equal(res[:4], signatureMagic) {
+		return 0, 0, false
+	}
+	off = int64(binary.LittleEndian.Uint32(res[4:]))
+	n = int64(binary.LittleEndian.Uint32(res[8:]))
+	return off, n, n > 0
+}
+
+// Signature returns the Authenticode signature of the Cabinet file, a
+// DER-encoded PKCS #7 ContentInfo holding SignedData. The signature is not
+// verified. ErrNoSignature is returned if the Cabinet file is not signed.
+func (c *Cabinet) Signature() ([]byte, error) {
+	off, n, ok := c.signatureRange()
+	if !ok {
+		return nil, ErrNoSignature
+	}
+	if off+n > c.size {
+		return nil, fmt.Errorf("signature from %d to %d exceeds the stream length %d", off, off+n, c.size)
+	}
+	if _, err := c.r.Seek(off, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("could not seek to signature: %v", err)
+	}
+	sig := make([]byte, n)
+	if _, err := io.ReadFull(c.r, sig); err != nil {
+		return nil, fmt.Errorf("could not read signature: %v", err)
+	}
+	return sig, nil
+}
+
+// SignatureInfo describes the Authenticode signature of a Cabinet file.
+type SignatureInfo struct {
+	// Signer is the signing certificate, nil if it is not embedded in the
+	// signature. Subject and Issuer are taken from it.
+	Signer  *x509.Certificate
+	Subject pkix.Name
+	Issuer  pkix.Name
+
+	// DigestAlgorithm is the hash function used for signing.
+	DigestAlgorithm crypto.Hash
+
+	// Certificates holds all certificates embedded in the signature.
+	Certificates []*x509.Certificate
+
+	// SigningTime is the time of signing claimed by the signer, zero if
+	// there is none. A counter-signature is more trustworthy.
+	SigningTime time.Time
+
+	// CounterSignature describes the counter-signature or the timestamp
+	// of the signature, nil if there is none.
+	CounterSignature *CounterSignature
+}
+
+// CounterSignature describes a PKCS #9 counter-signature or an RFC 3161
+// timestamp of a signature.
+type CounterSignature struct {
+	RFC3161 bool // an RFC 3161 timestamp rather than a counter-signature
+
+	// Signer is the certificate of the counter-signer or the timestamping
+	// authority, nil if it is not embedded in the signature.
+	Signer *x509.Certificate
+
+	// SigningTime is the time vouched for, zero if there is none.
+	SigningTime time.Time
+}
+
+// SignatureInfo returns the details of the Authenticode signature of the
+// Cabinet file. The signature is not verified, see VerifySignature.
+// ErrNoSignature is returned if the Cabinet file is not signed.
+func (c *Cabinet) SignatureInfo() (*SignatureInfo, error) {
+	der, err := c.Signature()
+	if err != nil {
+		return nil, err
+	}
+	sd, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("%d signers instead of 1", len(sd.SignerInfos))
+	}
+	si := &sd.SignerInfos[0]
+	info := &SignatureInfo{}
+	if info.Certificates, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+		return nil, fmt.Errorf("could not parse certificates: %v", err)
+	}
+	if info.Signer = findCertificate(info.Certificates, &si.IssuerAndSerialNumber); info.Signer != nil {
+		info.Subject, info.Issuer = info.Signer.Subject, info.Signer.Issuer
+	}
+	if info.DigestAlgorithm, err = hashFromOID(si.DigestAlgorithm.Algorithm); err != nil {
+		return nil, err
+	}
+	if info.SigningTime, err = signingTime(si); err != nil {
+		return nil, err
+	}
+
+	unauth, err := parseAttributes(si.UnauthenticatedAttributes)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := findAttribute(unauth, oidCounterSignature); ok {
+		var csi signerInfo
+		if _, err := asn1.Unmarshal(v.FullBytes, &csi); err != nil {
+			return nil, fmt.Errorf("could not parse counter-signature: %v", err)
+		}
+		cs := &CounterSignature{Signer: findCertificate(info.Certificates, &csi.IssuerAndSerialNumber)}
+		if cs.SigningTime, err = signingTime(&csi); err != nil {
+			return nil, fmt.Errorf("could not parse counter-signature: %v", err)
+		}
+		info.CounterSignature = cs
+	}
+	if v, ok := findAttribute(unauth, oidRFC3161CounterSign); ok {
+		if info.CounterSignature, err = parseTimestamp(v.FullBytes); err != nil {
+			return nil, fmt.Errorf("could not parse timestamp: %v", err)
+		}
+	}
+	return info, nil
+}
+
+// signingTime returns the value of the signing time attribute of si, or
+// the zero time if there is none.
+func signingTime(si *signerInfo) (time.Time, error) {
+	attrs, err := parseAttributes(si.AuthenticatedAttributes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	v, ok := findAttribute(attrs, oidSigningTime)
+	if !ok {
+		return time.Time{}, nil
+	}
+	var t time.Time
+	if _, err := asn1.Unmarshal(v.FullBytes, &t); err != nil {
+		return time.Time{}, fmt.Errorf("could not parse signing time: %v", err)
+	}
+	return t, nil
+}
+
+// parseTimestamp parses an RFC 3161 timestamp token.
+func parseTimestamp(der []byte) (*CounterSignature, error) {
+	sd, err := parseSignedData(der)
+	if err != nil {
+		return nil, err
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("content type %v is not TSTInfo", sd.ContentInfo.ContentType)
+	}
+	var content []byte
+	if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+		return nil, fmt.Errorf("could not parse TSTInfo: %v", err)
+	}
+	var tst tstInfo
+	if _, err := asn1.Unmarshal(content, &tst); err != nil {
+		return nil, fmt.Errorf("could not parse TSTInfo: %v", err)
+	}
+	cs := &CounterSignature{RFC3161: true, SigningTime: tst.GenTime}
+	if len(sd.SignerInfos) > 0 {
+		certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse certificates: %v", err)
+		}
+		cs.Signer = findCertificate(certs, &sd.SignerInfos[0].IssuerAndSerialNumber)
+	}
+	return cs, nil
+}
+
+// SignatureOptions configures the verification of signatures.
+type SignatureOptions struct {
+	// Roots holds the trusted root certificates.
+	Roots *x509.CertPool
+
+	// SystemRoots trusts the root certificates of the system in addition
+	// to Roots.
+	SystemRoots bool
+
+	// CurrentTime is the time at which the certificates have to be valid,
+	// now if zero.
+	CurrentTime time.Time
+}
+
+// VerifySignature verifies the Authenticode signature of the Cabinet file:
+// the digest of the Cabinet file has to match the signed one, the signature
+// has to be made by the key of the signing certificate, and the certificate
+// has to chain up to a trusted root and allow code signing. It returns the
+// verified chains of the signing certificate.
+//
+// Problems with the signature itself are reported as ErrInvalidSignature,
+// a missing signature as ErrNoSignature.
+func (c *Cabinet) VerifySignature(opts SignatureOptions) ([][]*x509.Certificate, error) {
+	if opts.Roots == nil && !opts.SystemRoots {
+		return nil, errors.New("no trusted root certificates")
+	}
+	der, err := c.Signature()
+	if err != nil {
+		return nil, err
+	}
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), ErrInvalidSignature)
+	}
+	sd, err := parseSignedData(der)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	if !sd.ContentInfo.ContentType.Equal(oidSpcIndirectDataContent) {
+		return nil, invalid("signed content type %v is not SpcIndirectDataContent", sd.ContentInfo.ContentType)
+	}
+	var content asn1.RawValue
+	if _, err := asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content); err != nil {
+		return nil, invalid("could not parse signed content: %v", err)
+	}
+	var idc spcIndirectDataContent
+	if _, err := asn1.Unmarshal(content.FullBytes, &idc); err != nil {
+		return nil, invalid("could not parse SpcIndirectDataContent: %v", err)
+	}
+
+	// The signed digest of the Cabinet file.
+	h, err := hashFromOID(idc.MessageDigest.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return nil, invalid("%v", err)
+	}
+	digest := h.New()
+	if err := c.authenticodeDigest(digest); err != nil {
+		return nil, fmt.Errorf("could not compute digest: %v", err)
+	}
+	if !bytes.Equal(digest.Sum(nil), idc.MessageDigest.Digest) {
+		return nil, invalid("digest of the Cabinet file does not match the signed digest")
+	}
+
+	// The signature of the content, covering its digest by way of the
+	// authenticated attributes.
+	if len(sd.SignerInfos) != 1 {
+		return nil, invalid("%d signers instead of 1", len(sd.SignerInfos))
+	}
+	si := &sd.SignerInfos[0]
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, invalid("could not parse certificates: %v", err)
+	}
+	signer := findCertificate(certs, &si.IssuerAndSerialNumber)
+	if signer == nil {
+		return nil, invalid("signing certificate is missing")
+	}
+	if err := verifySignerInfo(si, signer, content.Bytes); err != nil {
+		return nil, invalid("%v", err)
+	}
+
+	// The chain of the signing certificate.
+	vopts := x509.VerifyOptions{
+		Intermediates: x509.NewCertPool(),
+		Roots:         opts.Roots,
+		CurrentTime:   opts.CurrentTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}
+	for _, cert := range certs {
+		if cert != signer {
+			vopts.Intermediates.AddCert(cert)
+		}
+	}
+	var chains [][]*x509.Certificate
+	if opts.Roots != nil {
+		chains, err = signer.Verify(vopts)
+	}
+	if opts.SystemRoots && (opts.Roots == nil || err != nil) {
+		vopts.Roots = nil
+		chains, err = signer.Verify(vopts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not verify signing certificate: %w", err)
+	}
+	return chains, nil
+}
+
+// findCertificate returns the certificate identified by id, or nil.
+func findCertificate(certs []*x509.Certificate, id *issuerAndSerialNumber) *x509.Certificate {
+	for _, cert := range certs {
+		if cert.SerialNumber.Cmp(id.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, id.Issuer.FullBytes) {
+			return cert
+		}
+	}
+	return nil
+}
+
+// verifySignerInfo verifies that si signs content, given as the contents
+// octets of its DER encoding, with the key of cert.
+func verifySignerInfo(si *signerInfo, cert *x509.Certificate, content []byte) error {
+	h, err := hashFromOID(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	attrs, err := parseAttributes(si.AuthenticatedAttributes)
+	if err != nil {
+		return err
+	}
+	if len(attrs) == 0 {
+		return errors.New("authenticated attributes are missing")
+	}
+	typ, ok := findAttribute(attrs, oidContentType)
+	if !ok {
+		return errors.New("content type attribute is missing")
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(typ.FullBytes, &oid); err != nil || !oid.Equal(oidSpcIndirectDataContent) {
+		return errors.New("content type attribute does not match the signed content")
+	}
+	md, ok := findAttribute(attrs, oidMessageDigest)
+	if !ok {
+		return errors.New("message digest attribute is missing")
+	}
+	sum := h.New()
+	sum.Write(content)
+	if !bytes.Equal(md.Bytes, sum.Sum(nil)) {
+		return errors.New("message digest attribute does not match the signed content")
+	}
+
+	// The attributes are signed as a SET rather than with their implicit
+	// tag.
+	signed := append([]byte(nil), si.AuthenticatedAttributes.FullBytes...)
+	signed[0] = 0x31
+	sum = h.New()
+	sum.Write(signed)
+	return checkSignature(cert, h, sum.Sum(nil), si.EncryptedDigest)
+}
+
+// checkSignature verifies the signature of a digest computed with h, made
+// by the key of cert.
+func checkSignature(cert *x509.Certificate, h crypto.Hash, digest, sig []byte) error {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, h, digest, sig); err != nil {
+			return fmt.Errorf("signature does not match: %v", err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return errors.New("signature does not match")
+		}
+	default:
+		return fmt.Errorf("unsupported public key of type %T", pub)
+	}
+	return nil
+}
+
+// authenticodeExcluded lists the ranges of a signed Cabinet file not
+// covered by its signature: the reserved header fields, the sizes of the
+// reserve areas and the part of the header reserve area recording the
+// signature.
+var authenticodeExcluded = [][2]int64{{4, 8}, {12, 16}, {20, 24}, {36, 56}}
+
+// digestWriter writes the bytes of a signed Cabinet file covered by its
+// signature to h, skipping the excluded ranges.
+type digestWriter struct {
+	h   hash.Hash
+	off int64 // offset in the Cabinet file
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		chunk, skip := int64(len(p)), false
+		for _, r := range authenticodeExcluded {
+			switch {
+			case d.off >= r[0] && d.off < r[1]:
+				skip = true
+				if r[1]-d.off < chunk {
+					chunk = r[1] - d.off
+				}
+			case r[0] > d.off && r[0]-d.off < chunk:
+				chunk = r[0] - d.off
+			}
+		}
+		if !skip {
+			d.h.Write(p[:chunk])
+		}
+		p = p[chunk:]
+		d.off += chunk
+	}
+	return n, nil
+}
+
+// ContentDigest returns the digest of the Cabinet file computed with h
+// over the ranges covered by an Authenticode signature, which exclude the
+// signature, the reserved header fields and the header reserve area. Signing
+// does not change the digest: for an unsigned Cabinet file without reserve
+// areas, it is the digest of the Cabinet file with the header reserve area
+// added by signing. Reserve areas other than those of signed Cabinet files
+// are not supported.
+func (c *Cabinet) ContentDigest(h crypto.Hash) ([]byte, error) {
+	if !h.Available() {
+		return nil, fmt.Errorf("unavailable hash function %v", h)
+	}
+	d := h.New()
+	switch {
+	case c.hdr.Flags&hdrReservePresent == 0:
+		if err := c.unsignedDigest(d); err != nil {
+			return nil, err
+		}
+	case c.hdr.CBCFHeader == signatureReserveSize && c.hdr.CBCFFolder == 0 && c.hdr.CBCFData == 0:
+		if err := c.authenticodeDigest(d); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("reserve areas of %d, %d and %d bytes do not belong to a signature", c.hdr.CBCFHeader, c.hdr.CBCFFolder, c.hdr.CBCFData)
+	}
+	return d.Sum(nil), nil
+}
+
+// authenticodeDigest writes the parts of a Cabinet file with the header
+// reserve area of a signed one covered by the signature to h: all bytes up
+// to the signature, except for the excluded ranges of the header.
+func (c *Cabinet) authenticodeDigest(h hash.Hash) error {
+	end := int64(c.hdr.CBCabinet)
+	if off, _, ok := c.signatureRange(); ok {
+		end = off
+	}
+	if end < cfHeaderSize+4+signatureReserveSize {
+		return fmt.Errorf("signature at offset %d within the header", end)
+	}
+	if _, err := c.r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek to the beginning: %v", err)
+	}
+	if _, err := io.CopyN(&digestWriter{h: h}, c.r, end); err != nil {
+		return fmt.Errorf("could not read Cabinet file: %v", err)
+	}
+	return nil
+}
+
+// unsignedDigest writes the parts of a Cabinet file without reserve areas
+// covered by a signature to h, as if the header reserve area of a signed
+// Cabinet file had been added, which moves all following structures.
+func (c *Cabinet) unsignedDigest(h hash.Hash) error {
+	const shift = 4 + signatureReserveSize
+	hdrEnd := int64(c.hdr.size())
+	fldrsEnd := hdrEnd + int64(c.hdr.CFolders)*cfFolderSize
+	if _, err := c.r.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek to the beginning: %v", err)
+	}
+	prefix := make([]byte, fldrsEnd)
+	if _, err := io.ReadFull(c.r, prefix); err != nil {
+		return fmt.Errorf("could not read header and folders: %v", err)
+	}
+	le := binary.LittleEndian
+	le.PutUint32(prefix[8:], le.Uint32(prefix[8:])+shift)   // cbCabinet
+	le.PutUint32(prefix[16:], le.Uint32(prefix[16:])+shift) // coffFiles
+	le.PutUint16(prefix[30:], le.Uint16(prefix[30:])|hdrReservePresent)
+	for off := hdrEnd; off < fldrsEnd; off += cfFolderSize {
+		le.PutUint32(prefix[off:], le.Uint32(prefix[off:])+shift) // coffCabStart
+	}
+
+	d := &digestWriter{h: h}
+	d.Write(prefix[:cfHeaderSize])
+	d.Write(make([]byte, shift))
+	d.Write(prefix[cfHeaderSize:])
+	if _, err := io.CopyN(d, c.r, int64(c.hdr.CBCabinet)-fldrsEnd); err != nil {
+		return fmt.Errorf("could not read Cabinet file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// writeSignable writes a Cabinet file holding files with a header reserve
+// area large enough to record a signature.
+func writeSignable(t *testing.T, files []testFile) []byte {
+	t.Helper()
+	return writeCabinetData(t, files, WithReserve(signatureReserveSize, 0, 0))
+}
+
+// appendSignature records sig in the header reserve area of a Cabinet file
+// written by writeSignable and appends it.
+func appendSignature(data, sig []byte) []byte {
+	data = append([]byte(nil), data...)
+	res := data[cfHeaderSize+4:]
+	copy(res, signatureMagic)
+	binary.LittleEndian.PutUint32(res[4:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(res[8:], uint32(len(sig)))
+	return append(data, sig...)
+}
+
+func TestSignature(t *testing.T) {
+	files := testFiles()
+	unsigned := writeSignable(t, files)
+	cab := checkCabinet(t, bytes.NewReader(unsigned), files)
+	if _, err := cab.Signature(); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("Signature() of an unsigned Cabinet file = %v; want ErrNoSignature", err)
+	}
+
+	sig := []byte("\x30\x03\x02\x01\x01")
+	signed := appendSignature(unsigned, sig)
+	cab = checkCabinet(t, bytes.NewReader(signed), files)
+	got, err := cab.Signature()
+	if err != nil {
+		t.Fatalf("Signature() failed: %v", err)
+	}
+	if !bytes.Equal(got, sig) {
+		t.Errorf("Signature() = %x; want %x", got, sig)
+	}
+
+	cab = checkCabinet(t, bytes.NewReader(signed[:len(signed)-1]), files)
+	if _, err := cab.Signature(); err == nil || errors.Is(err, ErrNoSignature) {
+		t.Errorf("Signature() of a truncated signature = %v; want error", err)
+	}
+}
+
+// testPKI holds a root certificate and a code signing certificate issued
+// by it.
+type testPKI struct {
+	roots   *x509.CertPool
+	root    *x509.Certificate
+	rootKey *ecdsa.PrivateKey
+	leaf    *x509.Certificate
+	key     *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	now := time.Now()
+	create := func(tmpl, parent *x509.Certificate, pub, priv interface{}) *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, priv)
+		if err != nil {
+			t.Fatalf("x509.CreateCertificate() failed: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("x509.ParseCertificate() failed: %v", err)
+		}
+		return cert
+	}
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	rootTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	root := create(rootTmpl, rootTmpl, &rootKey.PublicKey, rootKey)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() failed: %v", err)
+	}
+	leaf := create(&x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test Signer", Organization: []string{"Test"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, root, &key.PublicKey, rootKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	return &testPKI{roots: roots, root: root, rootKey: rootKey, leaf: leaf, key: key}
+}
+
+// signer returns a signer using the code signing certificate.
+func (p *testPKI) signer() *Signer {
+	return &Signer{Key: p.key, Certificates: []*x509.Certificate{p.leaf}}
+}
+
+// writeSigned writes a Cabinet file holding files, signed by s.
+func writeSigned(t *testing.T, files []testFile, s *Signer) []byte {
+	t.Helper()
+	return writeCabinetData(t, files, WithSigner(s))
+}
+
+func TestVerifySignature(t *testing.T) {
+	files := testFiles()
+	pki := newTestPKI(t)
+	signed := writeSigned(t, files, pki.signer())
+
+	cab := checkCabinet(t, bytes.NewReader(signed), files)
+	size := int(cab.Header().Size)
+	chains, err := cab.VerifySignature(SignatureOptions{Roots: pki.roots})
+	if err != nil {
+		t.Fatalf("VerifySignature() failed: %v", err)
+	}
+	if len(chains) != 1 || len(chains[0]) != 2 || !chains[0][0].Equal(pki.leaf) || !chains[0][1].Equal(pki.root) {
+		t.Errorf("VerifySignature() = %v; want a chain of the signing and the root certificate", chains)
+	}
+
+	// An untrusted root.
+	if _, err := cab.VerifySignature(SignatureOptions{Roots: newTestPKI(t).roots}); err == nil || errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySignature() with another root = %v; want certificate error", err)
+	}
+	if _, err := cab.VerifySignature(SignatureOptions{}); err == nil {
+		t.Error("VerifySignature() without roots succeeded; want error")
+	}
+	if _, err := cab.VerifySignature(SignatureOptions{Roots: pki.roots, CurrentTime: time.Now().Add(2 * time.Hour)}); err == nil {
+		t.Error("VerifySignature() after the certificates expired succeeded; want error")
+	}
+
+	// Modifying data covered by the signature.
+	tampered := append([]byte(nil), signed...)
+	tampered[size-1] ^= 0xff
+	cab, err = New(bytes.NewReader(tampered))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if _, err := cab.VerifySignature(SignatureOptions{Roots: pki.roots}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySignature() of modified data = %v; want ErrInvalidSignature", err)
+	}
+
+	// Modifying the signature.
+	tampered = append([]byte(nil), signed...)
+	tampered[len(tampered)-2] ^= 0xff
+	cab, err = New(bytes.NewReader(tampered))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if _, err := cab.VerifySignature(SignatureOptions{Roots: pki.roots}); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifySignature() of a modified signature = %v; want ErrInvalidSignature", err)
+	}
+
+	cab = checkCabinet(t, bytes.NewReader(writeSignable(t, files)), files)
+	if _, err := cab.VerifySignature(SignatureOptions{Roots: pki.roots}); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("VerifySignature() of an unsigned Cabinet file = %v; want ErrNoSignature", err)
+	}
+}
+
+func TestWriterSigner(t *testing.T) {
+	files := testFiles()
+	pki := newTestPKI(t)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() failed: %v", err)
+	}
+	rsaLeaf, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "Test RSA Signer"},
+		NotBefore:    pki.leaf.NotBefore,
+		NotAfter:     pki.leaf.NotAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}, pki.root, &rsaKey.PublicKey, pki.rootKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() failed: %v", err)
+	}
+	rsaCert, err := x509.ParseCertificate(rsaLeaf)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() failed: %v", err)
+	}
+
+	token, _ := asn1.Marshal(contentInfo{ContentType: oidSignedData})
+	var stamped []byte
+	for _, tc := range []struct {
+		name   string
+		signer *Signer
+	}{
+		{"ecdsa", pki.signer()},
+		{"ecdsa-sha384", &Signer{Key: pki.key, Certificates: []*x509.Certificate{pki.leaf}, Hash: crypto.SHA384}},
+		{"rsa-sha1", &Signer{Key: rsaKey, Certificates: []*x509.Certificate{rsaCert}, Hash: crypto.SHA1}},
+		{"timestamp", &Signer{Key: rsaKey, Certificates: []*x509.Certificate{rsaCert}, Timestamp: func(sig []byte) ([]byte, error) {
+			stamped = sig
+			return token, nil
+		}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := writeSigned(t, files, tc.signer)
+			cab := checkCabinet(t, bytes.NewReader(data), files)
+			if _, err := cab.VerifySignature(SignatureOptions{Roots: pki.roots}); err != nil {
+				t.Errorf("VerifySignature() failed: %v", err)
+			}
+			if tc.signer.Timestamp == nil {
+				return
+			}
+			sig, err := cab.Signature()
+			if err != nil {
+				t.Fatalf("Signature() failed: %v", err)
+			}
+			sd, err := parseSignedData(sig)
+			if err != nil {
+				t.Fatalf("parseSignedData() failed: %v", err)
+			}
+			si := sd.SignerInfos[0]
+			if !bytes.Equal(stamped, si.EncryptedDigest) {
+				t.Errorf("Timestamp() called with %x; want the signature value %x", stamped, si.EncryptedDigest)
+			}
+			attrs, err := parseAttributes(si.UnauthenticatedAttributes)
+			if err != nil {
+				t.Fatalf("parseAttributes() failed: %v", err)
+			}
+			if v, ok := findAttribute(attrs, oidRFC3161CounterSign); !ok || !bytes.Equal(v.FullBytes, token) {
+				t.Errorf("timestamp attribute = %x, %t; want %x", v.FullBytes, ok, token)
+			}
+		})
+	}
+
+	// Every Cabinet file of a set is signed.
+	content := make([]byte, 2*maxBlockSize)
+	rand.Read(content)
+	cabs, _ := writeSet(t, maxBlockSize+1000, []testFile{{"big.bin", content}}, WithSigner(pki.signer()))
+	if len(cabs) < 2 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want at least 2", len(cabs))
+	}
+	for name, data := range cabs {
+		cab, err := parse(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("parse(%q) failed: %v", name, err)
+		}
+		if _, err := cab.VerifySignature(SignatureOptions{Roots: pki.roots}); err != nil {
+			t.Errorf("VerifySignature() of %q failed: %v", name, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []WriterOption
+	}{
+		{"no key", []WriterOption{WithSigner(&Signer{Certificates: []*x509.Certificate{pki.leaf}})}},
+		{"no certificate", []WriterOption{WithSigner(&Signer{Key: pki.key})}},
+		{"md5", []WriterOption{WithSigner(&Signer{Key: pki.key, Certificates: []*x509.Certificate{pki.leaf}, Hash: crypto.MD5})}},
+		{"reserve", []WriterOption{WithSigner(pki.signer()), WithReserve(20, 0, 0)}},
+	} {
+		if err := NewWriter(io.Discard, tc.opts...).Close(); err == nil {
+			t.Errorf("Close() with %s succeeded; want error", tc.name)
+		}
+	}
+}
+
+func TestSignatureInfo(t *testing.T) {
+	files := testFiles()
+	pki := newTestPKI(t)
+	cab := checkCabinet(t, bytes.NewReader(writeSigned(t, files, pki.signer())), files)
+	info, err := cab.SignatureInfo()
+	if err != nil {
+		t.Fatalf("SignatureInfo() failed: %v", err)
+	}
+	if info.Signer == nil || !info.Signer.Equal(pki.leaf) {
+		t.Errorf("SignatureInfo().Signer = %v; want the signing certificate", info.Signer)
+	}
+	if got, want := info.Subject.CommonName, "Test Signer"; got != want {
+		t.Errorf("SignatureInfo().Subject.CommonName = %q; want %q", got, want)
+	}
+	if got, want := info.Issuer.CommonName, "Test Root"; got != want {
+		t.Errorf("SignatureInfo().Issuer.CommonName = %q; want %q", got, want)
+	}
+	if info.DigestAlgorithm != crypto.SHA256 {
+		t.Errorf("SignatureInfo().DigestAlgorithm = %v; want SHA-256", info.DigestAlgorithm)
+	}
+	if len(info.Certificates) != 1 {
+		t.Errorf("SignatureInfo().Certificates holds %d certificates; want 1", len(info.Certificates))
+	}
+	if !info.SigningTime.IsZero() || info.CounterSignature != nil {
+		t.Errorf("SignatureInfo() = signing time %v, counter-signature %+v; want neither", info.SigningTime, info.CounterSignature)
+	}
+
+	// An RFC 3161 timestamp, issued in the name of the root certificate.
+	genTime := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	tst, _ := asn1.Marshal(tstInfo{
+		Version:        1,
+		Policy:         asn1.ObjectIdentifier{1, 2, 3},
+		MessageImprint: digestInfo{DigestAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256}, Digest: make([]byte, 32)},
+		SerialNumber:   big.NewInt(1),
+		GenTime:        genTime,
+	})
+	tstContent, _ := asn1.Marshal(tst)
+	sd, _ := asn1.Marshal(signedData{
+		Version:          3,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: oidSHA256}},
+		ContentInfo:      contentInfo{ContentType: oidTSTInfo, Content: explicit(tstContent)},
+		Certificates:     explicit(pki.root.Raw),
+		SignerInfos: []signerInfo{{
+			Version:                   1,
+			IssuerAndSerialNumber:     issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: pki.root.RawIssuer}, SerialNumber: pki.root.SerialNumber},
+			DigestAlgorithm:           pkix.AlgorithmIdentifier{Algorithm: oidSHA256},
+			DigestEncryptionAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256},
+			EncryptedDigest:           []byte{0},
+		}},
+	})
+	token, _ := asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: explicit(sd)})
+	s := pki.signer()
+	s.Timestamp = func([]byte) ([]byte, error) { return token, nil }
+	cab = checkCabinet(t, bytes.NewReader(writeSigned(t, files, s)), files)
+	if info, err = cab.SignatureInfo(); err != nil {
+		t.Fatalf("SignatureInfo() of a timestamped signature failed: %v", err)
+	}
+	cs := info.CounterSignature
+	if cs == nil {
+		t.Fatal("SignatureInfo().CounterSignature = nil; want timestamp")
+	}
+	if !cs.RFC3161 || cs.Signer == nil || !cs.Signer.Equal(pki.root) || !cs.SigningTime.Equal(genTime) {
+		t.Errorf("SignatureInfo().CounterSignature = %+v; want RFC 3161 timestamp by the root certificate at %v", cs, genTime)
+	}
+
+	cab = checkCabinet(t, bytes.NewReader(writeSignable(t, files)), files)
+	if _, err := cab.SignatureInfo(); !errors.Is(err, ErrNoSignature) {
+		t.Errorf("SignatureInfo() of an unsigned Cabinet file = %v; want ErrNoSignature", err)
+	}
+}
+
+func TestContentDigest(t *testing.T) {
+	files := testFiles()
+	pki := newTestPKI(t)
+	var plain bytes.Buffer
+	w := NewWriter(&plain)
+	for _, f := range files {
+		if err := w.AddFile(f.name, time.Time{}, bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	signed := writeSigned(t, files, pki.signer())
+
+	digest := func(data []byte) []byte {
+		t.Helper()
+		cab, err := New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		d, err := cab.ContentDigest(crypto.SHA256)
+		if err != nil {
+			t.Fatalf("ContentDigest() failed: %v", err)
+		}
+		return d
+	}
+	want := digest(signed)
+	for name, data := range map[string][]byte{
+		"unsigned":     plain.Bytes(),
+		"with reserve": writeSignable(t, files),
+		"re-signed":    writeSigned(t, files, &Signer{Key: pki.key, Certificates: []*x509.Certificate{pki.leaf}, Hash: crypto.SHA512}),
+	} {
+		if got := digest(data); !bytes.Equal(got, want) {
+			t.Errorf("ContentDigest() of %s Cabinet file = %x; want %x", name, got, want)
+		}
+	}
+
+	// The digest is the one signed.
+	cab, err := New(bytes.NewReader(signed))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	sig, err := cab.Signature()
+	if err != nil {
+		t.Fatalf("Signature() failed: %v", err)
+	}
+	sd, err := parseSignedData(sig)
+	if err != nil {
+		t.Fatalf("parseSignedData() failed: %v", err)
+	}
+	var content asn1.RawValue
+	var idc spcIndirectDataContent
+	asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content)
+	if _, err := asn1.Unmarshal(content.FullBytes, &idc); err != nil {
+		t.Fatalf("asn1.Unmarshal() of SpcIndirectDataContent failed: %v", err)
+	}
+	if !bytes.Equal(idc.MessageDigest.Digest, want) {
+		t.Errorf("signed digest = %x; want ContentDigest() %x", idc.MessageDigest.Digest, want)
+	}
+
+	files[0].data = append(files[0].data, '!')
+	if got := digest(writeSigned(t, files, pki.signer())); bytes.Equal(got, want) {
+		t.Error("ContentDigest() of different content is unchanged")
+	}
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf, WithReserve(0, 3, 0)).Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if cab, err = New(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if _, err := cab.ContentDigest(crypto.SHA256); err == nil {
+		t.Error("ContentDigest() with folder reserve areas succeeded; want error")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"path"
+	"strings"
+)
+
+// compressedExts lists the extensions of file formats whose content is
+// already compressed.
+var compressedExts = map[string]bool{
+	".7z": true, ".bz2": true, ".cab": true, ".gif": true, ".gz": true,
+	".jpeg": true, ".jpg": true, ".mp3": true, ".mp4": true, ".png": true,
+	".xz": true, ".zip": true, ".zst": true,
+}
+
+// compressedMagic lists the leading bytes of file formats whose content is
+// already compressed.
+var compressedMagic = [][]byte{
+	[]byte("PK\x03\x04"),           // zip
+	[]byte("\x1f\x8b"),             // gzip
+	[]byte("\xff\xd8\xff"),         // JPEG
+	[]byte("\x89PNG\r\n\x1a\n"),    // PNG
+	[]byte("GIF8"),                 // GIF
+	[]byte("7z\xbc\xaf\x27\x1c"),   // 7-Zip
+	[]byte("\xfd7zXZ\x00"),         // xz
+	[]byte("BZh"),                  // bzip2
+	[]byte("\x28\xb5\x2f\xfd"),     // Zstandard
+	[]byte("MSCF\x00\x00\x00\x00"), // Cabinet
+}
+
+// maxMagicSize is the number of leading bytes needed to match all of
+// compressedMagic.
+const maxMagicSize = 8
+
+// incompressibleName reports whether the extension of a member name
+// indicates already compressed content.
+func incompressibleName(name string) bool {
+	return compressedExts[strings.ToLower(path.Ext(strings.ReplaceAll(name, `\`, "/")))]
+}
+
+// incompressibleContent reports whether the leading bytes of a member's
+// content indicate an already compressed file format.
+func incompressibleContent(head []byte) bool {
+	for _, m := range compressedMagic {
+		if bytes.HasPrefix(head, m) {
+			return true
+		}
+	}
+	return false
+}
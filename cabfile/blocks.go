@@ -0,0 +1,105 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// BlockInfo describes a raw CFDATA block as stored in a Cabinet file.
+type BlockInfo struct {
+	Folder int   // index of the folder of the block
+	Index  int   // index of the block within its folder
+	Offset int64 // offset of the CFDATA structure in the Cabinet file
+
+	CBData   uint16 // size of the compressed payload
+	CBUncomp uint16 // size of the uncompressed data, 0 if split
+
+	// Checksum is the stored checksum, which is 0 if absent. Computed is
+	// the checksum of the payload as read.
+	Checksum uint32
+	Computed uint32
+
+	// Reserve is the reserve area of the block, which is nil unless the
+	// header declares data block reserve areas.
+	Reserve []byte
+}
+
+// ChecksumOK reports whether the stored checksum is absent or matches the
+// payload.
+func (b *BlockInfo) ChecksumOK() bool {
+	return b.Checksum == 0 || b.Checksum == b.Computed
+}
+
+// BlockIterator iterates over the raw CFDATA blocks of a folder.
+type BlockIterator struct {
+	c    *Cabinet
+	fldr int
+	blk  uint16
+	off  int64
+	data []byte
+}
+
+// Blocks returns an iterator over the CFDATA blocks of the folder with the
+// given index. The payloads are read to compute their checksums, but nothing
+// is decompressed, so this works with any compression and with corrupted
+// data.
+func (c *Cabinet) Blocks(folder int) (*BlockIterator, error) {
+	if folder < 0 || folder >= len(c.fldrs) {
+		return nil, fmt.Errorf("folder index %d out of range [0, %d)", folder, len(c.fldrs))
+	}
+	return &BlockIterator{c: c, fldr: folder, off: int64(c.fldrs[folder].COFFCabStart)}, nil
+}
+
+// Next returns the next block of the folder, or io.EOF after the last one.
+func (it *BlockIterator) Next() (*BlockInfo, error) {
+	c := it.c
+	if it.blk >= c.fldrs[it.fldr].CCFData {
+		return nil, io.EOF
+	}
+	if _, err := c.r.Seek(it.off, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("could not seek to data block %d: %v", it.blk, err)
+	}
+	var d cfData
+	if err := binary.Read(c.r, binary.LittleEndian, &d); err != nil {
+		return nil, fmt.Errorf("could not deserialize data structure %d: %v", it.blk, err)
+	}
+	var reserve []byte
+	if c.hdr.CBCFData > 0 {
+		reserve = make([]byte, c.hdr.CBCFData)
+		if _, err := io.ReadFull(c.r, reserve); err != nil {
+			return nil, fmt.Errorf("could not read reserve of data block %d: %v", it.blk, err)
+		}
+	}
+	it.data = resize(it.data, int(d.CBData))
+	if _, err := io.ReadFull(c.r, it.data); err != nil {
+		return nil, fmt.Errorf("could not read data block %d: %v", it.blk, err)
+	}
+	b := &BlockInfo{
+		Folder:   it.fldr,
+		Index:    int(it.blk),
+		Offset:   it.off,
+		CBData:   d.CBData,
+		CBUncomp: d.CBUncomp,
+		Checksum: d.Checksum,
+		Computed: blockChecksum(&d, it.data),
+		Reserve:  reserve,
+	}
+	it.blk++
+	it.off += cfDataSize + int64(c.hdr.CBCFData) + int64(d.CBData)
+	return b, nil
+}
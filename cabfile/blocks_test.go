@@ -0,0 +1,75 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestBlocks(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionNone, 256, files)
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	// Store a wrong checksum in the second block.
+	second := int64(cab.fldrs[0].COFFCabStart) + cfDataSize + 256
+	binary.LittleEndian.PutUint32(data[second:], 0xdeadbeef)
+
+	it, err := cab.Blocks(0)
+	if err != nil {
+		t.Fatalf("Blocks(0) failed: %v", err)
+	}
+	var total int
+	for i := 0; ; i++ {
+		b, err := it.Next()
+		if err == io.EOF {
+			if i != int(cab.fldrs[0].CCFData) {
+				t.Errorf("Next() returned %d blocks; want %d", i, cab.fldrs[0].CCFData)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		if b.Folder != 0 || b.Index != i {
+			t.Errorf("Next() = block %d of folder %d; want block %d of folder 0", b.Index, b.Folder, i)
+		}
+		if got := binary.LittleEndian.Uint16(data[b.Offset+4:]); got != b.CBData {
+			t.Errorf("block %d: CBData at offset %d = %d; want %d", i, b.Offset, got, b.CBData)
+		}
+		payload := data[b.Offset+cfDataSize : b.Offset+cfDataSize+int64(b.CBData)]
+		if want := Checksum(payload, b.CBUncomp); b.Computed != want {
+			t.Errorf("block %d: Computed = %#08x; want %#08x", i, b.Computed, want)
+		}
+		if wantOK := b.Offset != second; b.ChecksumOK() != wantOK {
+			t.Errorf("block %d: ChecksumOK() = %t with checksum %#08x; want %t", i, b.ChecksumOK(), b.Checksum, wantOK)
+		}
+		total += int(b.CBUncomp)
+	}
+	if want := len(files[0].data) + len(files[1].data) + len(files[2].data); total != want {
+		t.Errorf("total CBUncomp = %d; want %d", total, want)
+	}
+
+	for _, idx := range []int{-1, 1} {
+		if _, err := cab.Blocks(idx); err == nil {
+			t.Errorf("Blocks(%d) succeeded; want error", idx)
+		}
+	}
+}
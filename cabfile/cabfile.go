@@ -32,14 +32,80 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
 )
 
 // Cabinet provides read-only access to Microsoft Cabinet files.
 type Cabinet struct {
-	r     io.ReadSeeker
-	hdr   *cfHeader
-	fldrs []*cfFolder
-	files []*file
+	r            io.ReadSeeker
+	ra           io.ReaderAt // reader of the folders, if set by NewReaderAt
+	size         int64       // length of the stream, which may exceed the Cabinet file
+	hdr          *cfHeader
+	fldrs        []*cfFolder
+	fldrReserves [][]byte // reserve areas of the CFFOLDER entries
+	files        []*file
+
+	ignoreChecksums bool
+	ignoreCase      bool
+	location        *time.Location      // location of modification times, UTC if nil
+	decodeName      func([]byte) string // decoder of names without the UTF flag
+	strict          bool
+	lenient         bool
+	anyVersion      bool
+	mu              *sync.Mutex     // guards warnings and damage
+	warnings        []error         // problems tolerated in lenient mode
+	damage          map[damage]bool // damage found in salvage mode
+	limits          Limits
+	decompressed    int64 // uncompressed bytes of all blocks read
+
+	fsys *fsIndex // entries of the fs.FS view, built by Open
+
+	next int           // index of the member returned by Next
+	mr   *memberReader // reader of the member content for Next
+	cur  *entryReader  // content of the current member of Next
+}
+
+// Errors returned when reading Cabinet files, possibly wrapped.
+var (
+	ErrNotCabinet             = errors.New("cabfile: not a Cabinet file")
+	ErrUnsupportedCompression = errors.New("cabfile: unsupported compression")
+	ErrMultiPart              = errors.New("cabfile: multi-part Cabinet file")
+	ErrFileNotFound           = errors.New("cabfile: file not found")
+	ErrChecksum               = errors.New("cabfile: checksum mismatch")
+)
+
+// ParseError reports a malformed structure of a Cabinet file.
+type ParseError struct {
+	// Structure names the structure, one of CFHEADER, CFFOLDER[i],
+	// CFFILE[i] and CFDATA[f][i], where f is the index of the folder and i
+	// the index of the structure.
+	Structure string
+	Offset    int64 // offset of the structure in the Cabinet file
+	Err       error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("malformed %s at offset %d: %v", e.Structure, e.Offset, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Option configures how Cabinet files are read by New, NewCabinetSet,
+// NewLazyCabinetSet and NewEditor. Options are applied before the header
+// structures are parsed.
+type Option func(*Cabinet)
+
+// IgnoreChecksums skips the verification of the checksums of data blocks,
+// which allows reading Cabinet files with wrong checksums.
+func IgnoreChecksums() Option {
+	return func(c *Cabinet) {
+		c.ignoreChecksums = true
+	}
 }
 
 type cfHeader struct {
@@ -59,6 +125,12 @@ type cfHeader struct {
 	CBCFHeader   uint16 // size of abReserve field in the CFHeader in bytes (optional)
 	CBCFFolder   uint8  // size of abReserve field in each CFFolder entry in bytes (optional)
 	CBCFData     uint8  // size of abReserve field in each CFData entry in bytes (optional)
+	Reserve      []byte // abReserve field of the CFHeader (optional)
+
+	CabinetPrev string // name of the previous cabinet file in a set (optional)
+	DiskPrev    string // name of the disk holding the previous cabinet file (optional)
+	CabinetNext string // name of the next cabinet file in a set (optional)
+	DiskNext    string // name of the disk holding the next cabinet file (optional)
 }
 
 const (
@@ -73,14 +145,91 @@ type cfFolder struct {
 	TypeCompress uint16 // compression type indicator
 }
 
+// CompressionType is the compression method of a folder.
+type CompressionType uint16
+
+// Compression methods defined by the Cabinet file format. Only CompressionNone
+// and CompressionMSZIP folders can be decompressed by this package. Reading
+// CompressionLZX folders would also require undoing the Intel E8 call
+// translation LZX compressors apply to x86 code, which is therefore not
+// implemented either.
+const (
+	CompressionNone    CompressionType = 0x0
+	CompressionMSZIP   CompressionType = 0x1
+	CompressionQuantum CompressionType = 0x2
+	CompressionLZX     CompressionType = 0x3
+)
+
 const (
-	compMask    uint16 = 0xf
-	compNone           = 0x0
-	compMSZIP          = 0x1
-	compQuantum        = 0x2
-	compLZX            = 0x3
+	compMask          uint16 = 0x000f // compression method
+	compQuantumLevel  uint16 = 0x00f0 // Quantum compression level
+	compQuantumMemory uint16 = 0x1f00 // Quantum memory size in bits
+	compLZXWindow     uint16 = 0x1f00 // LZX window size in bits
 )
 
+func (t CompressionType) String() string {
+	switch t {
+	case CompressionNone:
+		return "NONE"
+	case CompressionMSZIP:
+		return "MSZIP"
+	case CompressionQuantum:
+		return "Quantum"
+	case CompressionLZX:
+		return "LZX"
+	}
+	return fmt.Sprintf("CompressionType(%d)", uint16(t))
+}
+
+// Compression describes the compression method and parameters of a folder.
+type Compression struct {
+	Type CompressionType
+
+	// QuantumLevel and QuantumMemory are the compression level and the
+	// memory size in bits of Quantum compressed folders.
+	QuantumLevel  int
+	QuantumMemory int
+
+	// LZXWindow is the window size in bits of LZX compressed folders.
+	LZXWindow int
+}
+
+func parseCompression(typeCompress uint16) Compression {
+	c := Compression{Type: CompressionType(typeCompress & compMask)}
+	switch c.Type {
+	case CompressionQuantum:
+		c.QuantumLevel = int(typeCompress&compQuantumLevel) >> 4
+		c.QuantumMemory = int(typeCompress&compQuantumMemory) >> 8
+	case CompressionLZX:
+		c.LZXWindow = int(typeCompress&compLZXWindow) >> 8
+	}
+	return c
+}
+
+// typeCompress returns the TypeCompress field value describing c.
+func (c Compression) typeCompress() uint16 {
+	t := uint16(c.Type) & compMask
+	switch c.Type {
+	case CompressionQuantum:
+		t |= uint16(c.QuantumLevel<<4)&compQuantumLevel | uint16(c.QuantumMemory<<8)&compQuantumMemory
+	case CompressionLZX:
+		t |= uint16(c.LZXWindow<<8) & compLZXWindow
+	}
+	return t
+}
+
+// String returns the compression in the notation used by Microsoft's
+// tools, e.g. "MSZIP", "LZX:21" or "Quantum:7:21".
+func (c Compression) String() string {
+	switch c.Type {
+	case CompressionQuantum:
+		return fmt.Sprintf("%v:%d:%d", c.Type, c.QuantumLevel, c.QuantumMemory)
+	case CompressionLZX:
+		return fmt.Sprintf("%v:%d", c.Type, c.LZXWindow)
+	}
+	return c.Type.String()
+}
+
 type cfFile struct {
 	CBFile          uint32 // uncompressed size of this file in bytes
 	UOffFolderStart uint32 // uncompressed offset of this file in the folder
@@ -90,20 +239,50 @@ type cfFile struct {
 	Attribs         uint16 // attribute flags for this file
 }
 
+// Special IFolder values of files spanning multiple Cabinet files of a set.
+const (
+	ifoldContinuedFromPrev    uint16 = 0xfffd // file continued from the previous cabinet
+	ifoldContinuedToNext      uint16 = 0xfffe // file continued in the next cabinet
+	ifoldContinuedPrevAndNext uint16 = 0xffff // file continued from the previous and in the next cabinet
+)
+
+// Attributes are the attribute flags of a member.
+type Attributes uint16
+
+// Attribute flags defined by the Cabinet file format.
 const (
-	attribReadOnly = 1 << iota // file is read-only
-	attribHidden               // file is hidden
-	attribSystem               // file is a system file
+	AttrReadOnly Attributes = 1 << iota // file is read-only
+	AttrHidden                          // file is hidden
+	AttrSystem                          // file is a system file
 	_
 	_
-	attribArchive   // file modified since last backup
-	attribExec      // run after extraction
-	attribNameIsUTF // filename is UTF-encoded
+	AttrArchive   // file modified since last backup
+	AttrExec      // run after extraction
+	AttrNameIsUTF // filename is UTF-encoded
 )
 
+// ReadOnly reports whether the member is read-only.
+func (a Attributes) ReadOnly() bool { return a&AttrReadOnly != 0 }
+
+// Hidden reports whether the member is hidden.
+func (a Attributes) Hidden() bool { return a&AttrHidden != 0 }
+
+// System reports whether the member is a system file.
+func (a Attributes) System() bool { return a&AttrSystem != 0 }
+
+// Archive reports whether the member was modified since the last backup.
+func (a Attributes) Archive() bool { return a&AttrArchive != 0 }
+
+// Exec reports whether the member is to be run after extraction.
+func (a Attributes) Exec() bool { return a&AttrExec != 0 }
+
+// NameIsUTF reports whether the name of the member is UTF-encoded.
+func (a Attributes) NameIsUTF() bool { return a&AttrNameIsUTF != 0 }
+
 type file struct {
 	*cfFile
 	name string
+	raw  string // name as stored if it differs from the decoded name
 }
 
 type cfData struct {
@@ -113,12 +292,133 @@ type cfData struct {
 }
 
 // New returns a new Cabinet with the header structures parsed and sanity checked.
-func New(r io.ReadSeeker) (*Cabinet, error) {
+func New(r io.ReadSeeker, opts ...Option) (*Cabinet, error) {
+	c, err := parse(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if (c.hdr.Flags&hdrPrevCabinet) != 0 || (c.hdr.Flags&hdrNextCabinet) != 0 {
+		return nil, fmt.Errorf("use NewCabinetSet to read the set: %w", ErrMultiPart)
+	}
+	if err := c.checkExtents(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parse parses and sanity checks the header structures of a Cabinet file,
+// which may be part of a multi-part set.
+func parse(r io.ReadSeeker, opts []Option) (*Cabinet, error) {
+	c := &Cabinet{r: r, mu: new(sync.Mutex), fsys: new(fsIndex)}
+	for _, opt := range opts {
+		opt(c)
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine the stream length: %v", err)
+	}
+	c.size = size
 	if _, err := r.Seek(0, io.SeekStart); err != nil {
 		return nil, fmt.Errorf("could not seek to the beginning: %v", err)
 	}
 
 	// CFHEADER
+	hdr, err := c.readHeader(r)
+	if err != nil {
+		return nil, &ParseError{Structure: "CFHEADER", Err: err}
+	}
+	hdrEnd, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("could not preserve current offset: %v", err)
+	}
+
+	if err := c.limits.checkHeader(hdr); err != nil {
+		return nil, err
+	}
+
+	// CFFOLDER
+	var fldrs []*cfFolder
+	var reserves [][]byte
+	for i := uint16(0); i < hdr.CFolders; i++ {
+		off, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("could not preserve current offset: %v", err)
+		}
+		perr := func(err error) error {
+			return &ParseError{Structure: fmt.Sprintf("CFFOLDER[%d]", i), Offset: off, Err: err}
+		}
+		var fldr cfFolder
+		if err := binary.Read(r, binary.LittleEndian, &fldr); err != nil {
+			if c.lenient {
+				c.warn(fmt.Errorf("cFolders %d exceeds the %d folders present: %v", hdr.CFolders, i, err))
+				break
+			}
+			return nil, perr(fmt.Errorf("could not deserialize folder: %v", err))
+		}
+		var reserve []byte
+		if hdr.CBCFFolder > 0 {
+			reserve = make([]byte, hdr.CBCFFolder)
+			if _, err := io.ReadFull(r, reserve); err != nil {
+				if c.lenient {
+					c.warn(fmt.Errorf("cFolders %d exceeds the %d folders present: %v", hdr.CFolders, i, err))
+					break
+				}
+				return nil, perr(fmt.Errorf("could not read %d folder abReserve bytes: %v", hdr.CBCFFolder, err))
+			}
+		}
+		if c.strict {
+			if err := checkFolder(hdr, int(i), &fldr); err != nil {
+				return nil, perr(err)
+			}
+		}
+		fldrs = append(fldrs, &fldr)
+		reserves = append(reserves, reserve)
+	}
+	fldrsEnd, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("could not preserve current offset: %v", err)
+	}
+
+	// CFFILE
+	if _, err := r.Seek(int64(hdr.COFFFiles), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("could not seek to start of CFFILE section: %v", err)
+	}
+	var files []*file
+	for i := uint16(0); i < hdr.CFiles; i++ {
+		off, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("could not preserve current offset: %v", err)
+		}
+		f, err := readFileEntry(r, c.decodeName)
+		if err != nil {
+			if c.lenient {
+				c.warn(fmt.Errorf("cFiles %d exceeds the %d files present: %v", hdr.CFiles, i, err))
+				break
+			}
+			return nil, &ParseError{Structure: fmt.Sprintf("CFFILE[%d]", i), Offset: off, Err: err}
+		}
+		files = append(files, f)
+	}
+	filesEnd, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("could not preserve current offset: %v", err)
+	}
+	if c.lenient {
+		files = c.presentFiles(files, len(fldrs))
+	}
+
+	c.hdr, c.fldrs, c.fldrReserves, c.files = hdr, fldrs, reserves, files
+	if c.strict {
+		if err := c.checkOverlaps(hdrEnd, fldrsEnd, filesEnd); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// readHeader reads and sanity checks the CFHEADER structure, including the
+// names of the neighboring Cabinet files.
+func (c *Cabinet) readHeader(r io.ReadSeeker) (*cfHeader, error) {
 	var hdr cfHeader
 	if err := binary.Read(r, binary.LittleEndian, &hdr.Signature); err != nil {
 		return nil, fmt.Errorf("could not deserialize header signature: %w", err)
@@ -174,67 +474,122 @@ func New(r io.ReadSeeker) (*Cabinet, error) {
 	}
 
 	if !bytes.Equal(hdr.Signature[:], []byte("MSCF")) {
-		return nil, fmt.Errorf("invalid Cabinet file signature: %v", hdr.Signature)
+		return nil, fmt.Errorf("invalid Cabinet file signature %v: %w", hdr.Signature, ErrNotCabinet)
 	}
-	if hdr.Reserved1 != 0 || hdr.Reserved2 != 0 || hdr.Reserved3 != 0 {
-		return nil, fmt.Errorf("reserved files must be zero: %v, %v, %v", hdr.Reserved1, hdr.Reserved2, hdr.Reserved3)
+	if c.strict && (hdr.Reserved1 != 0 || hdr.Reserved2 != 0 || hdr.Reserved3 != 0) {
+		return nil, fmt.Errorf("reserved fields must be zero: %v, %v, %v", hdr.Reserved1, hdr.Reserved2, hdr.Reserved3)
 	}
-	if hdr.VersionMajor != 1 || hdr.VersionMinor != 3 {
+	if (hdr.VersionMajor != 1 || hdr.VersionMinor != 3) && !c.anyVersion {
 		return nil, fmt.Errorf("Cabinet file version has unsupported version %d.%d", hdr.VersionMajor, hdr.VersionMinor)
 	}
-	if (hdr.Flags&hdrPrevCabinet) != 0 || (hdr.Flags&hdrNextCabinet) != 0 {
-		return nil, errors.New("multi-part Cabinet files are unsupported")
-	}
 
-	// skip abReserve by reading cbCFHeader bytes, discarding the result
-	if _, err := io.ReadFull(r, make([]byte, hdr.CBCFHeader)); err != nil {
-		return nil, fmt.Errorf("could not skip %d header abReserve bytes: %w", hdr.CBCFHeader, err)
+	// abReserve, which is left to applications such as code signing
+	if hdr.CBCFHeader > 0 {
+		hdr.Reserve = make([]byte, hdr.CBCFHeader)
+		if _, err := io.ReadFull(r, hdr.Reserve); err != nil {
+			return nil, fmt.Errorf("could not read %d header abReserve bytes: %w", hdr.CBCFHeader, err)
+		}
 	}
 
-	// CFFOLDER
-	var fldrs []*cfFolder
-	for i := uint16(0); i < hdr.CFolders; i++ {
-		var fldr cfFolder
-		if err := binary.Read(r, binary.LittleEndian, &fldr); err != nil {
-			return nil, fmt.Errorf("could not deserialize folder %d: %v", i, err)
+	// names of the neighboring Cabinet files of a multi-part set
+	if (hdr.Flags & hdrPrevCabinet) != 0 {
+		var err error
+		if hdr.CabinetPrev, err = readName(r); err != nil {
+			return nil, fmt.Errorf("could not read szCabinetPrev: %v", err)
 		}
-		switch fldr.TypeCompress & compMask {
-		case compNone:
-		case compMSZIP:
-		default:
-			return nil, fmt.Errorf("folder compressed with unsupported algorithm %d", fldr.TypeCompress)
+		if hdr.DiskPrev, err = readName(r); err != nil {
+			return nil, fmt.Errorf("could not read szDiskPrev: %v", err)
 		}
-		fldrs = append(fldrs, &fldr)
 	}
-
-	// CFFILE
-	if _, err := r.Seek(int64(hdr.COFFFiles), io.SeekStart); err != nil {
-		return nil, fmt.Errorf("could not seek to start of CFFILE section: %v", err)
-	}
-	var files []*file
-	for i := uint16(0); i < hdr.CFiles; i++ {
-		var f cfFile
-		if err := binary.Read(r, binary.LittleEndian, &f); err != nil {
-			return nil, fmt.Errorf("could not deserialize file %d: %v", i, err)
+	if (hdr.Flags & hdrNextCabinet) != 0 {
+		var err error
+		if hdr.CabinetNext, err = readName(r); err != nil {
+			return nil, fmt.Errorf("could not read szCabinetNext: %v", err)
 		}
-		off, err := r.Seek(0, io.SeekCurrent)
+		if hdr.DiskNext, err = readName(r); err != nil {
+			return nil, fmt.Errorf("could not read szDiskNext: %v", err)
+		}
+	}
+
+	if c.strict {
+		end, err := r.Seek(0, io.SeekCurrent)
 		if err != nil {
 			return nil, fmt.Errorf("could not preserve current offset: %v", err)
 		}
-		fn, err := bufio.NewReader(r).ReadBytes('\x00')
-		if err != nil {
-			return nil, fmt.Errorf("could not read filename for file %d: %v", i, err)
+		if err := checkHeader(&hdr, end, c.size); err != nil {
+			return nil, err
 		}
-		if _, err := r.Seek(off+int64(len(fn)), io.SeekStart); err != nil {
-			return nil, fmt.Errorf("could not seek to the end of file entry %d: %v", i, err)
+	}
+	return &hdr, nil
+}
+
+// readFileEntry reads a CFFILE entry, decoding names without the UTF flag
+// using decode unless it is nil.
+func readFileEntry(r io.ReadSeeker, decode func([]byte) string) (*file, error) {
+	var f cfFile
+	if err := binary.Read(r, binary.LittleEndian, &f); err != nil {
+		return nil, fmt.Errorf("could not deserialize file: %v", err)
+	}
+	off, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("could not preserve current offset: %v", err)
+	}
+	fn, err := bufio.NewReader(r).ReadBytes('\x00')
+	if err != nil {
+		return nil, fmt.Errorf("could not read filename: %v", err)
+	}
+	if _, err := r.Seek(off+int64(len(fn)), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("could not seek to the end of the file entry: %v", err)
+	}
+	raw := fn[:len(fn)-1]
+	name := string(raw)
+	switch {
+	case Attributes(f.Attribs).NameIsUTF():
+		name = decodeUTF(raw)
+	case decode != nil:
+		name = decode(raw)
+	}
+	if name == string(raw) {
+		return &file{cfFile: &f, name: name}, nil
+	}
+	return &file{cfFile: &f, name: name, raw: string(raw)}, nil
+}
+
+// maxNameSize is the maximum size of a name in a Cabinet file, including the
+// terminating NUL byte.
+const maxNameSize = 256
+
+// readName reads a NUL-terminated name of at most maxNameSize bytes.
+func readName(r io.Reader) (string, error) {
+	var name []byte
+	var b [1]byte
+	for len(name) < maxNameSize {
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return "", err
+		}
+		if b[0] == 0 {
+			return string(name), nil
 		}
-		files = append(files, &file{&f, string(fn[:len(fn)-1])})
+		name = append(name, b[0])
 	}
+	return "", fmt.Errorf("name exceeds %d bytes", maxNameSize)
+}
 
-	return &Cabinet{r, &hdr, fldrs, files}, nil
+// TrailingData returns the offset and the length of the data following the
+// Cabinet file in the stream it is read from, such as appended signatures or
+// payloads of installers. The trailing data is ignored otherwise, and its
+// length is zero if there is none.
+func (c *Cabinet) TrailingData() (off, n int64) {
+	off = int64(c.hdr.CBCabinet)
+	if c.size > off {
+		n = c.size - off
+	}
+	return off, n
 }
 
-// FileList returns the list of filenames in the Cabinet file.
+// FileList returns the list of filenames in the Cabinet file, in the order
+// of the CFFILE entries. The slice is allocated for every call and may be
+// modified by the caller.
 func (c *Cabinet) FileList() []string {
 	var names []string
 	for _, f := range c.files {
@@ -243,84 +598,677 @@ func (c *Cabinet) FileList() []string {
 	return names
 }
 
-func (c *Cabinet) folderData(idx uint16) (io.ReadSeeker, error) {
+// SortedFileList returns the list of filenames in the Cabinet file sorted by
+// name, for display.
+func (c *Cabinet) SortedFileList() []string {
+	names := c.FileList()
+	sort.Strings(names)
+	return names
+}
+
+// Len returns the number of members of the Cabinet file.
+func (c *Cabinet) Len() int {
+	return len(c.files)
+}
+
+// Exists reports whether the Cabinet file has a member of the given name.
+func (c *Cabinet) Exists(name string) bool {
+	return c.lookup(name) != nil
+}
+
+// FileInfo describes a member of a Cabinet file.
+type FileInfo struct {
+	// Name is the name of the member, decoded from UTF if
+	// Attributes.NameIsUTF reports so, or else by the decoder set with
+	// WithNameDecoder.
+	Name       string
+	Size       int64
+	Modified   time.Time // stored with a resolution of two seconds, see WithLocation
+	Attributes Attributes
+
+	// DOSDate and DOSTime are the MS-DOS date and time of the member as
+	// stored, from which Modified is derived.
+	DOSDate uint16
+	DOSTime uint16
+
+	// Folder is the index of the folder holding the content, which starts
+	// at FolderOffset in the uncompressed data of the folder. For members
+	// continued across Cabinet files of a set, it is the folder of this
+	// Cabinet file holding part of the content.
+	Folder       int
+	FolderOffset int64
+
+	// Compression is the compression of the folder.
+	Compression Compression
+}
+
+// Header returns a header reproducing the name, the MS-DOS date and time and
+// the attributes of the member as stored when passed to Writer.CreateHeader.
+func (fi *FileInfo) Header() *FileHeader {
+	return &FileHeader{
+		Name:        fi.Name,
+		Modified:    fi.Modified,
+		DOSDate:     fi.DOSDate,
+		DOSTime:     fi.DOSTime,
+		Attributes:  fi.Attributes,
+		Size:        fi.Size,
+		dosVerbatim: true,
+	}
+}
+
+// Files returns information about the members of the Cabinet file, in the
+// order of FileList. Nothing is decompressed. Like FileList, the slice may be
+// modified by the caller.
+func (c *Cabinet) Files() []FileInfo {
+	var infos []FileInfo
+	for _, f := range c.files {
+		infos = append(infos, c.fileInfo(f))
+	}
+	return infos
+}
+
+// FilesByFolder returns information about the members of the Cabinet file
+// grouped by the index of the folder holding them, in the order of FileList
+// within each folder. Processing one folder at a time, for example with
+// FolderReader, decompresses every folder only once.
+func (c *Cabinet) FilesByFolder() [][]FileInfo {
+	fldrs := make([][]FileInfo, len(c.fldrs))
+	for _, f := range c.files {
+		fi := c.fileInfo(f)
+		if fi.Folder >= 0 && fi.Folder < len(fldrs) {
+			fldrs[fi.Folder] = append(fldrs[fi.Folder], fi)
+		}
+	}
+	return fldrs
+}
+
+// fileInfo returns information about the member f.
+func (c *Cabinet) fileInfo(f *file) FileInfo {
+	fi := FileInfo{
+		Name:         f.name,
+		Size:         int64(f.CBFile),
+		Modified:     c.modTime(f),
+		Attributes:   Attributes(f.Attribs),
+		DOSDate:      f.Date,
+		DOSTime:      f.Time,
+		Folder:       c.folderIndex(f),
+		FolderOffset: int64(f.UOffFolderStart),
+	}
+	if fi.Folder >= 0 && fi.Folder < len(c.fldrs) {
+		fi.Compression = parseCompression(c.fldrs[fi.Folder].TypeCompress)
+	}
+	return fi
+}
+
+// folderIndex returns the index of the folder holding the member f,
+// resolving the special IFolder values of members continued across Cabinet
+// files: those continued from the previous Cabinet file are held by the
+// first folder and those continued in the next one by the last folder.
+func (c *Cabinet) folderIndex(f *file) int {
+	switch f.IFolder {
+	case ifoldContinuedFromPrev, ifoldContinuedPrevAndNext:
+		return 0
+	case ifoldContinuedToNext:
+		return len(c.fldrs) - 1
+	}
+	return int(f.IFolder)
+}
+
+// SetID returns the SetID header field, which is shared by all Cabinet files
+// of a multi-part set.
+func (c *Cabinet) SetID() uint16 {
+	return c.hdr.SetID
+}
+
+// CabinetIndex returns the ICabinet header field, the zero-based index of the
+// Cabinet file within a multi-part set.
+func (c *Cabinet) CabinetIndex() uint16 {
+	return c.hdr.ICabinet
+}
+
+// FolderInfo describes a folder of the Cabinet file.
+type FolderInfo struct {
+	Compression Compression
+
+	// Blocks is the number of CFDATA blocks of the folder, the first of
+	// which starts at DataOffset in the Cabinet file.
+	Blocks     int
+	DataOffset int64
+
+	// Reserve is the reserve area of the CFFOLDER entry, which is nil
+	// unless the header declares folder reserve areas.
+	Reserve []byte
+}
+
+// Folders returns information about the folders in the Cabinet file, in the
+// order they are stored.
+func (c *Cabinet) Folders() []FolderInfo {
+	var fldrs []FolderInfo
+	for i, f := range c.fldrs {
+		var reserve []byte
+		if r := c.fldrReserves[i]; len(r) > 0 {
+			reserve = append(reserve, r...)
+		}
+		fldrs = append(fldrs, FolderInfo{
+			Compression: parseCompression(f.TypeCompress),
+			Blocks:      int(f.CCFData),
+			DataOffset:  int64(f.COFFCabStart),
+			Reserve:     reserve,
+		})
+	}
+	return fldrs
+}
+
+// FolderReader returns a reader for the entire uncompressed data of the
+// folder with the given index, along with its size, which is determined from
+// the headers of its data blocks. Blocks are decompressed incrementally as the
+// data is read. The reader shares the underlying reader of the Cabinet, but
+// repositions it for every block, so other folders and members may be read
+// in between, though not concurrently.
+func (c *Cabinet) FolderReader(i int) (io.Reader, int64, error) {
+	if i < 0 || i >= len(c.fldrs) {
+		return nil, 0, fmt.Errorf("folder index %d out of range [0, %d)", i, len(c.fldrs))
+	}
+	size, _, err := c.folderExtent(uint16(i))
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not determine size of folder %d: %v", i, err)
+	}
+	fr, err := c.folderData(uint16(i))
+	if err != nil {
+		return nil, 0, err
+	}
+	return fr, size, nil
+}
+
+// folderReader decompresses the CFDATA blocks of a folder one at a time,
+// handing out the uncompressed bytes of each block as soon as it has been
+// processed.
+type folderReader struct {
+	r    io.Reader
+	idx  int // index of the folder, reported in errors
+	fldr *cfFolder
+	blk  uint16 // index of the next CFDATA block to process
+	pos  int64  // offset of the next CFDATA block in the Cabinet file
+	buf  []byte // uncompressed bytes of the current block not yet read
+
+	reserve int64 // size of the reserve area of every CFDATA block
+
+	ignoreChecksums bool
+
+	// damaged, if not nil, records a range of uncompressed data which could
+	// not be recovered, up to the end of the folder if n is negative. Set in
+	// salvage mode.
+	damaged func(off, n int64, err error)
+	off     int64 // uncompressed offset of the next block
+
+	// warn, if not nil, records a problem tolerated in lenient mode, such
+	// as a truncated last block, which sets truncated.
+	warn      func(err error)
+	truncated bool
+
+	limits       Limits
+	decompressed *int64 // uncompressed bytes read from the Cabinet file
+
+	// Buffers reused across blocks. The uncompressed data of the previous
+	// block doubles as MS-ZIP history, which is preserved across block
+	// boundaries.
+	block   []byte
+	data    []byte
+	history []byte
+
+	src bytes.Reader  // source of the MS-ZIP decompressor
+	dec io.ReadCloser // MS-ZIP decompressor, reset for every block
+
+	// more, if not nil, returns the reader and folder of the next segment
+	// of a folder continued in the next Cabinet file of a set, or a nil
+	// folder if there is none.
+	more func() (io.Reader, *cfFolder, error)
+}
+
+func (fr *folderReader) Read(p []byte) (int, error) {
+	for len(fr.buf) == 0 {
+		if fr.blk >= fr.fldr.CCFData {
+			if ok, err := fr.nextSegment(); err != nil {
+				return 0, err
+			} else if !ok {
+				return 0, io.EOF
+			}
+			continue
+		}
+		if err := fr.nextBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[n:]
+	return n, nil
+}
+
+// nextSegment switches to the next segment of a folder continued in the
+// next Cabinet file of a set, reporting whether there is one. The
+// decompression history is preserved.
+func (fr *folderReader) nextSegment() (bool, error) {
+	if fr.more == nil {
+		return false, nil
+	}
+	r, fldr, err := fr.more()
+	if err != nil || fldr == nil {
+		return false, err
+	}
+	if fldr.TypeCompress != fr.fldr.TypeCompress {
+		return false, fmt.Errorf("folder continued with compression %d instead of %d", fldr.TypeCompress, fr.fldr.TypeCompress)
+	}
+	fr.r, fr.fldr, fr.blk, fr.pos = r, fldr, 0, int64(fldr.COFFCabStart)
+	return true, nil
+}
+
+// readBlock reads the header and the compressed data of the next CFDATA
+// block, appending the data to fr.block.
+func (fr *folderReader) readBlock() (cfData, error) {
+	i := fr.blk
+	fr.blk++
+	var d cfData
+	// Other readers of the Cabinet file may have moved the offset.
+	if s, ok := fr.r.(io.Seeker); ok {
+		if _, err := s.Seek(fr.pos, io.SeekStart); err != nil {
+			return d, fmt.Errorf("could not seek to data structure %d: %v", i, err)
+		}
+	}
+	if err := binary.Read(fr.r, binary.LittleEndian, &d); err != nil {
+		return d, fmt.Errorf("could not deserialize data structure %d: %v", i, err)
+	}
+	if _, err := io.CopyN(io.Discard, fr.r, fr.reserve); err != nil {
+		return d, fmt.Errorf("could not skip reserve of data block %d: %v", i, err)
+	}
+	if err := fr.checkLimits(i, &d); err != nil {
+		return d, err
+	}
+	fr.pos += cfDataSize + fr.reserve + int64(d.CBData)
+	n := len(fr.block)
+	fr.block = resize(fr.block, n+int(d.CBData))
+	if m, err := io.ReadFull(fr.r, fr.block[n:]); err != nil {
+		if fr.warn == nil || fr.blk < fr.fldr.CCFData || (err != io.ErrUnexpectedEOF && err != io.EOF) {
+			return d, fmt.Errorf("invalid read of size %d in data block %d; expected %d bytes: %v", m, i, d.CBData, err)
+		}
+		fr.warn(fmt.Errorf("data block %d of folder %d is truncated to %d of %d bytes", i, fr.idx, m, d.CBData))
+		fr.block = fr.block[:n+m]
+		fr.truncated = true
+		return d, nil
+	}
+	// A zero checksum means that none was computed.
+	if d.Checksum != 0 && !fr.ignoreChecksums {
+		if sum := blockChecksum(&d, fr.block[n:]); sum != d.Checksum {
+			return d, &ChecksumError{Folder: fr.idx, Block: int(i), Checksum: d.Checksum, Want: sum}
+		}
+	}
+	return d, nil
+}
+
+// nextBlock reads and decompresses the next CFDATA block of the folder. In
+// salvage mode, a block failing its checksum or decompression is replaced
+// with zeros, while a block that cannot be read ends the folder. Folders
+// using an unsupported compression method are not salvaged.
+func (fr *folderReader) nextBlock() error {
+	i, pos := fr.blk, fr.pos
+	fr.block = fr.block[:0]
+	d, err := fr.readBlock()
+	// A block split across Cabinet files ends its segment with no
+	// uncompressed bytes.
+	if err == nil && d.CBUncomp == 0 && fr.blk >= fr.fldr.CCFData {
+		d, err = fr.completeBlock(d)
+	}
+	perr := func(err error) error {
+		return &ParseError{Structure: fmt.Sprintf("CFDATA[%d][%d]", fr.idx, i), Offset: pos, Err: err}
+	}
+	if uerr := fr.unsupported(); uerr != nil {
+		return perr(uerr)
+	}
+	if err != nil {
+		err = perr(err)
+	}
+	var cerr *ChecksumError
+	if err != nil && (fr.damaged == nil || !errors.As(err, &cerr)) {
+		if fr.damaged == nil {
+			return err
+		}
+		// The layout of the remaining blocks is unknown.
+		fr.damaged(fr.off, -1, err)
+		fr.blk, fr.more = fr.fldr.CCFData, nil
+		return nil
+	}
+	if err == nil {
+		if err = fr.decode(i, d); err != nil {
+			err = perr(err)
+		}
+	}
+	if err != nil {
+		if fr.damaged == nil {
+			return err
+		}
+		fr.damaged(fr.off, int64(d.CBUncomp), err)
+		fr.data = resize(fr.data, int(d.CBUncomp))
+		for j := range fr.data {
+			fr.data[j] = 0
+		}
+		fr.buf, fr.history = fr.data, fr.data
+	}
+	fr.off += int64(len(fr.buf))
+	return nil
+}
+
+// completeBlock completes a block split across Cabinet files with the first
+// block of the next segment.
+func (fr *folderReader) completeBlock(d cfData) (cfData, error) {
+	if ok, err := fr.nextSegment(); err != nil || !ok || fr.fldr.CCFData == 0 {
+		return d, err
+	}
+	next, err := fr.readBlock()
+	d.CBUncomp = next.CBUncomp
+	return d, err
+}
+
+// decode decompresses the block with index i and header d held in fr.block.
+func (fr *folderReader) decode(i uint16, d cfData) error {
+	block := fr.block
+	switch CompressionType(fr.fldr.TypeCompress) {
+	case CompressionNone:
+		if len(block) != int(d.CBUncomp) && !(fr.truncated && len(block) < int(d.CBUncomp)) {
+			return fmt.Errorf("compressed bytes %d of data section %d do not equal uncompressed bytes %d when no compression was specified", len(block), i, d.CBUncomp)
+		}
+		fr.buf = block
+	case CompressionMSZIP:
+		if len(block) < 2 {
+			return fmt.Errorf("data block %d is too short for MS-ZIP signature", i)
+		}
+		if !bytes.Equal(block[:2], []byte("CK")) {
+			return fmt.Errorf("invalid MS-ZIP signature %q in data block %d", block[:2], i)
+		}
+		fr.src.Reset(block[2:])
+		if fr.dec == nil {
+			fr.dec = flate.NewReaderDict(&fr.src, fr.history)
+		} else if err := fr.dec.(flate.Resetter).Reset(&fr.src, fr.history); err != nil {
+			return fmt.Errorf("could not reset decompressor for data block %d: %v", i, err)
+		}
+		// The history has been copied into the decompressor's window by
+		// now, so the buffer holding it can be overwritten.
+		fr.data = resize(fr.data, int(d.CBUncomp))
+		data := fr.data
+		// The decompressor may hand out the block in several pieces, one
+		// for each deflate block contained in it.
+		if n, err := io.ReadFull(fr.dec, data); fr.truncated && (err == io.ErrUnexpectedEOF || err == io.EOF) {
+			data = data[:n]
+		} else if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return fmt.Errorf("invalid decompression of size %d in data block %d; expected %d bytes", n, i, d.CBUncomp)
+		} else if err != nil {
+			return fmt.Errorf("could not decompress data block %d: %v", i, err)
+		}
+		fr.buf = data
+		fr.history = data
+	default:
+		return fr.unsupported()
+	}
+	return nil
+}
+
+// unsupported returns an error wrapping ErrUnsupportedCompression if the
+// blocks of the folder cannot be decompressed.
+func (fr *folderReader) unsupported() error {
+	switch CompressionType(fr.fldr.TypeCompress) {
+	case CompressionNone, CompressionMSZIP:
+		return nil
+	}
+	return fmt.Errorf("folder compressed with algorithm %d: %w", fr.fldr.TypeCompress, ErrUnsupportedCompression)
+}
+
+// resize returns buf with its length set to n, only allocating if the
+// capacity of buf is insufficient.
+func resize(buf []byte, n int) []byte {
+	if cap(buf) < n {
+		return make([]byte, n)
+	}
+	return buf[:n]
+}
+
+// folderData returns a reader for the uncompressed data of the folder with
+// the given index. Blocks are decompressed incrementally as the data is read.
+// The reader shares the Cabinet's underlying reader, which it repositions
+// for every block if it is an io.Seeker.
+func (c *Cabinet) folderData(idx uint16) (*folderReader, error) {
 	if int(idx) >= len(c.fldrs) {
 		return nil, errors.New("folder number out of range")
 	}
 	fldr := c.fldrs[idx]
-	if _, err := c.r.Seek(int64(fldr.COFFCabStart), io.SeekStart); err != nil {
+	r := c.r
+	if c.ra != nil {
+		// Every folder is read through its own cursor.
+		r = io.NewSectionReader(c.ra, 0, c.size)
+	}
+	if _, err := r.Seek(int64(fldr.COFFCabStart), io.SeekStart); err != nil {
 		return nil, fmt.Errorf("could not seek to start of data section: %v", err)
 	}
+	return &folderReader{
+		r:               r,
+		idx:             int(idx),
+		fldr:            fldr,
+		pos:             int64(fldr.COFFCabStart),
+		reserve:         int64(c.hdr.CBCFData),
+		ignoreChecksums: c.ignoreChecksums,
+		damaged:         c.record(idx),
+		warn:            c.warner(),
+		limits:          c.limits,
+		decompressed:    &c.decompressed,
+	}, nil
+}
 
-	// MS-ZIP requires that the history buffer is preserved across block boundaries
-	var history []byte
+// Content returns the content of the file specified by its filename as an
+// io.Reader. Note that the folder which contains the file in question is
+// decompressed from its start up to the end of the file for every request.
+// If several members share the name, the first one in the order of FileList
+// is returned; use Lookup and ContentIndex to read the others. The content is
+// held in memory, and the reader also implements io.Seeker and io.ReaderAt
+// for random access.
+func (c *Cabinet) Content(name string) (io.Reader, error) {
+	f := c.lookup(name)
+	if f == nil {
+		return nil, fmt.Errorf("could not read %q: %w", name, ErrFileNotFound)
+	}
+	return c.content(f)
+}
+
+// ContentBytes returns the content of the file specified by its filename,
+// like Content.
+func (c *Cabinet) ContentBytes(name string) ([]byte, error) {
+	f := c.lookup(name)
+	if f == nil {
+		return nil, fmt.Errorf("could not read %q: %w", name, ErrFileNotFound)
+	}
+	return c.contentBytes(f)
+}
+
+// ContentReader returns the content of the file specified by its filename,
+// like Content, along with its size. The reader also implements io.Seeker and
+// io.ReaderAt.
+func (c *Cabinet) ContentReader(name string) (io.ReadCloser, int64, error) {
+	blob, err := c.ContentBytes(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return contentReader{bytes.NewReader(blob)}, int64(len(blob)), nil
+}
+
+// contentReader is the io.ReadCloser of the content of a member held in
+// memory, with nothing to close.
+type contentReader struct {
+	*bytes.Reader
+}
+
+func (contentReader) Close() error { return nil }
 
-	var buf bytes.Buffer
+// WriteFileTo decompresses the content of the file specified by its filename
+// into w, returning the number of bytes written. Unlike Content, the content
+// is streamed without being held in memory. As with Content, the folder
+// holding the file is decompressed from its start up to the end of the file.
+func (c *Cabinet) WriteFileTo(name string, w io.Writer) (int64, error) {
+	f := c.lookup(name)
+	if f == nil {
+		return 0, fmt.Errorf("could not read %q: %w", name, ErrFileNotFound)
+	}
+	if err := c.limits.checkFile(f); err != nil {
+		return 0, err
+	}
+	size := int64(f.CBFile)
+	var n int64
+	data, err := c.fileData(f)
+	if err == nil {
+		if n, err = io.Copy(w, data); err == nil && n < size {
+			err = fmt.Errorf("invalid read of size %d of file data; expected %d: %w", n, size, io.ErrUnexpectedEOF)
+		}
+	}
+	switch {
+	case err == nil:
+	case c.truncated(f, int(n), err):
+		m, err := io.CopyN(w, zeroReader{}, size-n)
+		return n + m, err
+	case c.partial(f, int(n), err):
+	default:
+		return n, err
+	}
+	return n, nil
+}
+
+// content returns the content of the member f.
+func (c *Cabinet) content(f *file) (io.Reader, error) {
+	blob, err := c.contentBytes(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(blob), nil
+}
+
+// contentBytes returns the content of the member f, which is cut short if
+// only part of it is present in lenient mode.
+func (c *Cabinet) contentBytes(f *file) ([]byte, error) {
+	if err := c.limits.checkFile(f); err != nil {
+		return nil, err
+	}
+	blob := make([]byte, f.CBFile)
+	n, err := c.readFile(f, blob)
+	switch {
+	case err == nil || c.truncated(f, n, err):
+	case c.partial(f, n, err):
+		blob = blob[:n]
+	default:
+		return nil, err
+	}
+	return blob, nil
+}
+
+// folderExtent returns the uncompressed size of the folder with the given
+// index and the offset of the end of its data in the Cabinet file, reading
+// only the headers of its data blocks.
+func (c *Cabinet) folderExtent(idx uint16) (size, end int64, err error) {
+	fldr := c.fldrs[idx]
+	if _, err := c.r.Seek(int64(fldr.COFFCabStart), io.SeekStart); err != nil {
+		return 0, 0, fmt.Errorf("could not seek to start of data section: %v", err)
+	}
+	end = int64(fldr.COFFCabStart)
 	for i := uint16(0); i < fldr.CCFData; i++ {
 		var d cfData
 		if err := binary.Read(c.r, binary.LittleEndian, &d); err != nil {
-			return nil, fmt.Errorf("could not deserialize data structure %d: %v", i, err)
+			return 0, 0, fmt.Errorf("could not deserialize data structure %d: %v", i, err)
 		}
-		block := make([]byte, d.CBData)
-		if n, err := c.r.Read(block); n != int(d.CBData) {
-			return nil, fmt.Errorf("invalid read of size %d in data block %d; expected %d bytes", n, i, d.CBData)
-		} else if err != nil {
-			return nil, fmt.Errorf("could not read data block %d: %v", i, err)
-		}
-		// TODO: Checksum the block
-		switch fldr.TypeCompress {
-		case compNone:
-			if d.CBData != d.CBUncomp {
-				return nil, fmt.Errorf("compressed bytes %d of data section %d do not equal uncompressed bytes %d when no compression was specified", d.CBData, i, d.CBUncomp)
-			}
-			buf.Write(block)
-		case compMSZIP:
-			if !bytes.Equal(block[:2], []byte("CK")) {
-				return nil, fmt.Errorf("invalid MS-ZIP signature %q in data block %d", block[:2], i)
-			}
-			var r io.ReadCloser
-			if len(history) == 0 {
-				r = flate.NewReader(bytes.NewReader(block[2:]))
-			} else {
-				r = flate.NewReaderDict(bytes.NewReader(block[2:]), history)
-			}
-			data := make([]byte, d.CBUncomp)
-			if n, err := r.Read(data); n != int(d.CBUncomp) {
-				return nil, fmt.Errorf("invalid decompression of size %d in data block %d; expected %d bytes", n, i, d.CBUncomp)
-			} else if err != nil && err != io.EOF {
-				return nil, fmt.Errorf("could not decompress data block %d: %v", i, err)
-			}
-			buf.Write(data)
-			history = data
-		default:
-			return nil, errors.New("unsupported compression")
+		if end, err = c.r.Seek(int64(c.hdr.CBCFData)+int64(d.CBData), io.SeekCurrent); err != nil {
+			return 0, 0, fmt.Errorf("could not skip data block %d: %v", i, err)
 		}
+		size += int64(d.CBUncomp)
 	}
-	return bytes.NewReader(buf.Bytes()), nil
+	return size, end, nil
 }
 
-// Content returns the content of the file specified by its filename as an
-// io.Reader. Note that the entire folder which contains the file in question
-// is decompressed for every file request.
-func (c *Cabinet) Content(name string) (io.Reader, error) {
+// folderSpan identifies the data blocks of a folder, which hostile Cabinet
+// files may share between folders.
+type folderSpan struct {
+	start  uint32 // COFFCabStart
+	blocks uint16 // CCFData
+}
+
+// extents holds the folder sizes determined by checkExtents.
+type extents struct {
+	sizes map[folderSpan]int64 // -1 if unknown
+	// budget is the number of data block headers still to be walked. No
+	// more headers fit into the Cabinet file, unless folders overlap.
+	budget int64
+}
+
+// checkExtents validates that the content of every file lies within its
+// folder, which is only reported as a warning in lenient mode.
+func (c *Cabinet) checkExtents() error {
+	ex := &extents{sizes: make(map[folderSpan]int64), budget: c.size / cfDataSize}
 	for _, f := range c.files {
-		if f.name != name {
+		err := c.checkExtent(f, ex)
+		if err == nil {
 			continue
 		}
-		data, err := c.folderData(f.IFolder)
-		if err != nil {
-			return nil, fmt.Errorf("could not acquire uncompressed data for folder %d: %v", f.IFolder, err)
-		}
-		if _, err := data.Seek(int64(f.UOffFolderStart), io.SeekStart); err != nil {
-			return nil, fmt.Errorf("could not seek to start of data: %v", err)
+		if !c.lenient {
+			return err
 		}
-		blob := make([]byte, f.CBFile)
-		if n, err := data.Read(blob); n != int(f.CBFile) {
-			return nil, fmt.Errorf("invalid read of size %d of file data; expected %d", n, f.CBFile)
-		} else if err != nil {
-			return nil, fmt.Errorf("could not read file data: %v", err)
+		c.warn(err)
+	}
+	return nil
+}
+
+// checkExtent validates that the content of f lies within its folder, using
+// and filling ex to walk the data blocks of every folder only once. Folders
+// whose size cannot be determined, or whose blocks exceed the budget of ex,
+// are left to fail when reading their data.
+func (c *Cabinet) checkExtent(f *file, ex *extents) error {
+	if f.UOffFolderStart > math.MaxUint32-f.CBFile {
+		return fmt.Errorf("offset %d and size %d of file %q overflow", f.UOffFolderStart, f.CBFile, f.name)
+	}
+	if int(f.IFolder) >= len(c.fldrs) {
+		return nil
+	}
+	fldr := c.fldrs[f.IFolder]
+	span := folderSpan{fldr.COFFCabStart, fldr.CCFData}
+	size, ok := ex.sizes[span]
+	if !ok {
+		size = -1
+		if ex.budget >= int64(span.blocks) {
+			ex.budget -= int64(span.blocks)
+			if s, _, err := c.folderExtent(f.IFolder); err == nil {
+				size = s
+			}
 		}
-		return bytes.NewReader(blob), nil
+		ex.sizes[span] = size
+	}
+	if end := int64(f.UOffFolderStart) + int64(f.CBFile); size >= 0 && end > size {
+		return fmt.Errorf("file %q ends at offset %d beyond the end of folder %d at %d", f.name, end, f.IFolder, size)
+	}
+	return nil
+}
+
+// readFile reads the uncompressed content of f into blob, returning the
+// number of bytes read.
+func (c *Cabinet) readFile(f *file, blob []byte) (int, error) {
+	data, err := c.fileData(f)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(data, blob)
+	if err != nil {
+		return n, fmt.Errorf("invalid read of size %d of file data; expected %d: %w", n, len(blob), err)
+	}
+	return n, nil
+}
+
+// fileData returns a reader for the uncompressed content of f.
+func (c *Cabinet) fileData(f *file) (io.Reader, error) {
+	data, err := c.folderData(f.IFolder)
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire uncompressed data for folder %d: %v", f.IFolder, err)
+	}
+	if _, err := io.CopyN(io.Discard, data, int64(f.UOffFolderStart)); err != nil {
+		return nil, fmt.Errorf("could not skip to start of data: %w", err)
 	}
-	return nil, fmt.Errorf("file %q not found in Cabinet", name)
+	return io.LimitReader(data, int64(f.CBFile)), nil
 }
@@ -0,0 +1,946 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testFile struct {
+	name string
+	data []byte
+}
+
+// buildCabinet assembles a Cabinet file with a single folder holding the
+// given files. The folder data is split into blocks of at most blockSize
+// uncompressed bytes.
+func buildCabinet(t testing.TB, typeCompress CompressionType, blockSize int, files []testFile) []byte {
+	t.Helper()
+	var data []byte
+	for _, f := range files {
+		data = append(data, f.data...)
+	}
+	var blocks [][]byte
+	var uncomp []int
+	var history []byte
+	for off := 0; off < len(data); off += blockSize {
+		end := off + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[off:end]
+		switch typeCompress {
+		case CompressionNone:
+			blocks = append(blocks, chunk)
+		case CompressionMSZIP:
+			var buf bytes.Buffer
+			buf.WriteString("CK")
+			fw, err := flate.NewWriterDict(&buf, flate.BestCompression, history)
+			if err != nil {
+				t.Fatalf("flate.NewWriterDict: %v", err)
+			}
+			// Flush halfway through so that the block consists of
+			// multiple deflate blocks, as produced by some compressors.
+			fw.Write(chunk[:len(chunk)/2])
+			fw.Flush()
+			fw.Write(chunk[len(chunk)/2:])
+			fw.Close()
+			blocks = append(blocks, buf.Bytes())
+			history = chunk
+		default:
+			t.Fatalf("unsupported compression %d", typeCompress)
+		}
+		uncomp = append(uncomp, len(chunk))
+	}
+
+	const hdrSize, fldrSize, fileSize, dataSize = 36, 8, 16, 8
+	coffFiles := hdrSize + fldrSize
+	coffCabStart := coffFiles
+	for _, f := range files {
+		coffCabStart += fileSize + len(f.name) + 1
+	}
+	cbCabinet := coffCabStart
+	for _, b := range blocks {
+		cbCabinet += dataSize + len(b)
+	}
+
+	var buf bytes.Buffer
+	w := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("MSCF")
+	w(uint32(0))
+	w(uint32(cbCabinet))
+	w(uint32(0))
+	w(uint32(coffFiles))
+	w(uint32(0))
+	w([]uint8{3, 1})
+	w([]uint16{1, uint16(len(files)), 0, 0, 0})
+	w(cfFolder{COFFCabStart: uint32(coffCabStart), CCFData: uint16(len(blocks)), TypeCompress: uint16(typeCompress)})
+	var off uint32
+	for _, f := range files {
+		w(cfFile{CBFile: uint32(len(f.data)), UOffFolderStart: off})
+		buf.WriteString(f.name)
+		buf.WriteByte(0)
+		off += uint32(len(f.data))
+	}
+	for i, b := range blocks {
+		w(cfData{CBData: uint16(len(b)), CBUncomp: uint16(uncomp[i])})
+		buf.Write(b)
+	}
+	return buf.Bytes()
+}
+
+// testFiles returns a set of files whose content spans multiple blocks when
+// split into blocks of a few hundred bytes.
+func testFiles() []testFile {
+	return []testFile{
+		{"a.txt", bytes.Repeat([]byte("hello, world\n"), 50)},
+		{"b.bin", bytes.Repeat([]byte{0, 1, 2, 3, 4, 5, 6, 7}, 100)},
+		{"c.txt", []byte("tiny")},
+	}
+}
+
+func TestContent(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		typeCompress CompressionType
+	}{
+		{"none", CompressionNone},
+		{"mszip", CompressionMSZIP},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			files := testFiles()
+			cab, err := New(bytes.NewReader(buildCabinet(t, tc.typeCompress, 256, files)))
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			for _, f := range files {
+				r, err := cab.Content(f.name)
+				if err != nil {
+					t.Fatalf("Content(%q) failed: %v", f.name, err)
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("Reading content of %q failed: %v", f.name, err)
+				}
+				if !bytes.Equal(got, f.data) {
+					t.Errorf("Content(%q) = %q; want %q", f.name, got, f.data)
+				}
+			}
+		})
+	}
+}
+
+func TestContentVariants(t *testing.T) {
+	files := testFiles()
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	for _, f := range files {
+		got, err := cab.ContentBytes(f.name)
+		if err != nil {
+			t.Fatalf("ContentBytes(%q) failed: %v", f.name, err)
+		}
+		if !bytes.Equal(got, f.data) {
+			t.Errorf("ContentBytes(%q) = %q; want %q", f.name, got, f.data)
+		}
+
+		rc, size, err := cab.ContentReader(f.name)
+		if err != nil {
+			t.Fatalf("ContentReader(%q) failed: %v", f.name, err)
+		}
+		if size != int64(len(f.data)) {
+			t.Errorf("ContentReader(%q) reported size %d; want %d", f.name, size, len(f.data))
+		}
+		if got, err = io.ReadAll(rc); err != nil || !bytes.Equal(got, f.data) {
+			t.Errorf("ContentReader(%q) read %q, %v; want %q", f.name, got, err, f.data)
+		}
+		if err := rc.Close(); err != nil {
+			t.Errorf("Close() failed: %v", err)
+		}
+	}
+	if _, err := cab.ContentBytes("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("ContentBytes() of a missing member = %v; want ErrFileNotFound", err)
+	}
+	if _, _, err := cab.ContentReader("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("ContentReader() of a missing member = %v; want ErrFileNotFound", err)
+	}
+}
+
+func TestWriteFileTo(t *testing.T) {
+	files := []testFile{{"big.bin", make([]byte, 3*maxBlockSize)}, {"small.txt", []byte("tiny")}}
+	rand.New(rand.NewSource(1)).Read(files[0].data)
+	data := writeCabinetData(t, files)
+	cab := checkCabinet(t, bytes.NewReader(data), files)
+	for _, f := range files {
+		var out bytes.Buffer
+		if n, err := cab.WriteFileTo(f.name, &out); err != nil || n != int64(len(f.data)) {
+			t.Errorf("WriteFileTo(%q) = %d, %v; want %d, nil", f.name, n, err, len(f.data))
+		}
+		if !bytes.Equal(out.Bytes(), f.data) {
+			t.Errorf("WriteFileTo(%q) wrote %d bytes not matching the content", f.name, out.Len())
+		}
+	}
+	if _, err := cab.WriteFileTo("missing", io.Discard); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("WriteFileTo() of a missing member = %v; want ErrFileNotFound", err)
+	}
+
+	// The content of truncated members matches Content in every mode.
+	data = data[:len(data)-2]
+	for _, opts := range [][]Option{nil, {Lenient()}, {Salvage()}} {
+		cab, err := New(bytes.NewReader(data), opts...)
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		for _, f := range files {
+			var want []byte
+			r, wantErr := cab.Content(f.name)
+			if wantErr == nil {
+				want, _ = io.ReadAll(r)
+			}
+			var out bytes.Buffer
+			n, err := cab.WriteFileTo(f.name, &out)
+			if (err != nil) != (wantErr != nil) || err == nil && (n != int64(len(want)) || !bytes.Equal(out.Bytes(), want)) {
+				t.Errorf("WriteFileTo(%q) with %d options = %d bytes, %v; want %d bytes, %v", f.name, len(opts), n, err, len(want), wantErr)
+			}
+		}
+	}
+}
+
+func TestContentRandomAccess(t *testing.T) {
+	files := testFiles()
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	r, err := cab.Content(files[1].name)
+	if err != nil {
+		t.Fatalf("Content() failed: %v", err)
+	}
+	rc, _, err := cab.ContentReader(files[1].name)
+	if err != nil {
+		t.Fatalf("ContentReader() failed: %v", err)
+	}
+	want := files[1].data[100:108]
+	for _, r := range []io.Reader{r, rc} {
+		ra, ok := r.(io.ReaderAt)
+		if !ok {
+			t.Fatalf("%T does not implement io.ReaderAt", r)
+		}
+		got := make([]byte, len(want))
+		if _, err := ra.ReadAt(got, 100); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("ReadAt(100) = %v, %v; want %v", got, err, want)
+		}
+		rs, ok := r.(io.ReadSeeker)
+		if !ok {
+			t.Fatalf("%T does not implement io.ReadSeeker", r)
+		}
+		if _, err := rs.Seek(100, io.SeekStart); err != nil {
+			t.Fatalf("Seek() failed: %v", err)
+		}
+		if _, err := io.ReadFull(rs, got); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("Read() after Seek(100) = %v, %v; want %v", got, err, want)
+		}
+	}
+}
+
+func TestFolderDataIncremental(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionNone, 256, files)
+	// Corrupt the size of the second data block, which must not prevent the
+	// first block from being consumed.
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	off := cab.fldrs[0].COFFCabStart + 8 + 256 + 4
+	binary.LittleEndian.PutUint16(data[off:], 0xffff)
+
+	r, err := cab.folderData(0)
+	if err != nil {
+		t.Fatalf("folderData(0) failed: %v", err)
+	}
+	first := make([]byte, 256)
+	if _, err := io.ReadFull(r, first); err != nil {
+		t.Fatalf("Reading the first block failed: %v", err)
+	}
+	if !bytes.Equal(first, files[0].data[:256]) {
+		t.Errorf("First block = %q; want %q", first, files[0].data[:256])
+	}
+	if _, err := r.Read(first); err == nil {
+		t.Error("Reading the corrupted second block succeeded; want error")
+	}
+}
+
+func TestContentChecksum(t *testing.T) {
+	files := testFiles()
+	data := writeCabinetData(t, files)
+	checkCabinet(t, bytes.NewReader(data), files)
+
+	// Corrupt the content of the last file, stored in the only block.
+	data[len(data)-1] ^= 0xff
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	_, err = cab.Content("c.txt")
+	var cerr *ChecksumError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("Content() = %v; want *ChecksumError", err)
+	}
+	if cerr.Folder != 0 || cerr.Block != 0 {
+		t.Errorf("ChecksumError for folder %d, block %d; want 0, 0", cerr.Folder, cerr.Block)
+	}
+
+	cab, err = New(bytes.NewReader(data), IgnoreChecksums())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	r, err := cab.Content("c.txt")
+	if err != nil {
+		t.Fatalf("Content() with IgnoreChecksums() failed: %v", err)
+	}
+	want := append([]byte(nil), files[2].data...)
+	want[len(want)-1] ^= 0xff
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, want) {
+		t.Errorf("Content() with IgnoreChecksums() = %q; want %q", got, want)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	files := testFiles()
+	for _, tc := range []struct {
+		name      string
+		off       int // offset of the corrupted byte
+		structure string
+		offset    int64
+	}{
+		{"header", 0, "CFHEADER", 0},
+		// Unsupported compression is reported when reading the first block.
+		{"compression", 36 + 6, "CFDATA[0][0]", 0},
+		{"data", 0, "CFDATA[0][1]", 0}, // offsets depend on the first block
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := buildCabinet(t, CompressionMSZIP, 256, files)
+			cab, err := New(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			if tc.name == "compression" {
+				tc.offset = int64(cab.fldrs[0].COFFCabStart)
+			}
+			if tc.name == "data" {
+				// Corrupt the MS-ZIP signature of the second block.
+				var d cfData
+				binary.Read(bytes.NewReader(data[cab.fldrs[0].COFFCabStart:]), binary.LittleEndian, &d)
+				tc.offset = int64(cab.fldrs[0].COFFCabStart) + cfDataSize + int64(d.CBData)
+				tc.off = int(tc.offset) + cfDataSize
+			}
+			data[tc.off] ^= 0xff
+			if cab, err = New(bytes.NewReader(data)); err == nil {
+				_, err = cab.Content("c.txt")
+			}
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Error = %v; want *ParseError", err)
+			}
+			if perr.Structure != tc.structure || perr.Offset != tc.offset {
+				t.Errorf("ParseError for %s at offset %d; want %s at offset %d", perr.Structure, perr.Offset, tc.structure, tc.offset)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	files := testFiles()
+	open := func(data []byte) error {
+		cab, err := New(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		_, err = cab.Content("c.txt")
+		return err
+	}
+	patch := func(off int, val uint16) []byte {
+		data := buildCabinet(t, CompressionNone, 256, files)
+		binary.LittleEndian.PutUint16(data[off:], val)
+		return data
+	}
+	// The last block holds the last 174 bytes.
+	checksum := buildCabinet(t, CompressionNone, 256, files)
+	binary.LittleEndian.PutUint32(checksum[len(checksum)-174-8:], 1)
+	random := make([]byte, 2*maxBlockSize)
+	rand.New(rand.NewSource(1)).Read(random)
+	cabs, names := writeSet(t, maxBlockSize+1000, []testFile{{"random.bin", random}})
+	for _, tc := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"signature", open([]byte("PK\x03\x04 is not a Cabinet file, but a zip file")), ErrNotCabinet},
+		{"compression", open(patch(36+6, 0x000f)), ErrUnsupportedCompression},
+		{"multipart", open(cabs[names[0]]), ErrMultiPart},
+		{"checksum", open(checksum), ErrChecksum},
+		{"notfound", func() error {
+			cab, err := New(bytes.NewReader(buildCabinet(t, CompressionNone, 256, files)))
+			if err != nil {
+				return err
+			}
+			_, err = cab.Content("missing.txt")
+			return err
+		}(), ErrFileNotFound},
+	} {
+		if !errors.Is(tc.err, tc.want) {
+			t.Errorf("%s: error = %v; want %v", tc.name, tc.err, tc.want)
+		}
+	}
+}
+
+func TestUnsupportedCompression(t *testing.T) {
+	data := writeLZXCabinet(t, testFiles())
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	fldrs := cab.Folders()
+	if len(fldrs) != 1 || fldrs[0].Compression.String() != "LZX:21" {
+		t.Errorf("Folders() = %+v; want a single LZX:21 folder", fldrs)
+	}
+	if _, err := cab.Content("a.txt"); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Errorf("Content() = %v; want %v", err, ErrUnsupportedCompression)
+	}
+
+	// Salvaging does not pass off the content as zeros.
+	if cab, err = New(bytes.NewReader(data), Salvage()); err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if _, err := cab.Content("a.txt"); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Errorf("Content() with Salvage = %v; want %v", err, ErrUnsupportedCompression)
+	}
+	if _, err := cab.Next(); err != nil {
+		t.Fatalf("Next() with Salvage failed: %v", err)
+	}
+	if _, err := io.ReadAll(cab); !errors.Is(err, ErrUnsupportedCompression) {
+		t.Errorf("Reading Next() with Salvage = %v; want %v", err, ErrUnsupportedCompression)
+	}
+	if got := cab.Incomplete(); len(got) != 0 {
+		t.Errorf("Incomplete() = %q; want none", got)
+	}
+}
+
+func TestFileExtents(t *testing.T) {
+	files := testFiles()
+	for _, tc := range []struct {
+		name         string
+		size, offset uint32 // of the first file
+	}{
+		{"beyond", 1455, 0},
+		{"overflow", 0x20, 0xfffffff0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := buildCabinet(t, CompressionMSZIP, 256, files)
+			const coffFiles = 36 + 8
+			binary.LittleEndian.PutUint32(data[coffFiles:], tc.size)
+			binary.LittleEndian.PutUint32(data[coffFiles+4:], tc.offset)
+			if _, err := New(bytes.NewReader(data)); err == nil {
+				t.Error("New() succeeded; want error")
+			}
+			cab, err := New(bytes.NewReader(data), Lenient())
+			if err != nil {
+				t.Fatalf("New() with Lenient() failed: %v", err)
+			}
+			if len(cab.Warnings()) != 1 {
+				t.Errorf("Warnings() = %v; want 1 warning", cab.Warnings())
+			}
+		})
+	}
+}
+
+func TestFileExtentsOverlappingFolders(t *testing.T) {
+	// Every folder claims the maximum number of empty data blocks, starting
+	// at a different block of the same run.
+	const folders, blocks = 200, 0xffff
+	fileStart := cfHeaderSize + folders*cfFolderSize
+	var files bytes.Buffer
+	for i := 0; i < folders; i++ {
+		f := &file{cfFile: &cfFile{IFolder: uint16(i)}, name: fmt.Sprintf("%d", i)}
+		if err := f.write(&files); err != nil {
+			t.Fatalf("Writing file entry failed: %v", err)
+		}
+	}
+	dataStart := fileStart + files.Len()
+	size := dataStart + (blocks+folders)*cfDataSize
+	hdr := &cfHeader{
+		Signature: [4]byte{'M', 'S', 'C', 'F'},
+		CBCabinet: uint32(size), COFFFiles: uint32(fileStart),
+		VersionMinor: 3, VersionMajor: 1,
+		CFolders: folders, CFiles: folders,
+	}
+	var buf bytes.Buffer
+	if err := hdr.write(&buf); err != nil {
+		t.Fatalf("Writing header failed: %v", err)
+	}
+	for i := 0; i < folders; i++ {
+		binary.Write(&buf, binary.LittleEndian, &cfFolder{COFFCabStart: uint32(dataStart + i*cfDataSize), CCFData: blocks})
+	}
+	buf.Write(files.Bytes())
+	buf.Write(make([]byte, size-buf.Len()))
+
+	// Walking the blocks of every folder would read them over and over,
+	// while reading each file entry reads ahead a little.
+	r := &countingReader{Reader: bytes.NewReader(buf.Bytes())}
+	if _, err := New(r); err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if r.n > 4*int64(size) {
+		t.Errorf("New() read %d bytes of the %d byte Cabinet file", r.n, size)
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionMSZIP, 256, files)
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if off, n := cab.TrailingData(); off != int64(len(data)) || n != 0 {
+		t.Errorf("TrailingData() = %d, %d; want %d, 0", off, n, len(data))
+	}
+
+	tail := []byte("appended payload")
+	data = append(data, tail...)
+	cab = checkCabinet(t, bytes.NewReader(data), files)
+	if off, n := cab.TrailingData(); off != int64(len(data)-len(tail)) || n != int64(len(tail)) {
+		t.Errorf("TrailingData() = %d, %d; want %d, %d", off, n, len(data)-len(tail), len(tail))
+	}
+	if _, err := New(bytes.NewReader(data), Strict()); err != nil {
+		t.Errorf("New() with Strict() failed: %v", err)
+	}
+}
+
+func BenchmarkContent(b *testing.B) {
+	data := bytes.Repeat([]byte("The quick brown fox jumps over the lazy dog. "), 1<<14)
+	cabData := buildCabinet(b, CompressionMSZIP, 32768, []testFile{{"data", data}})
+	cab, err := New(bytes.NewReader(cabData))
+	if err != nil {
+		b.Fatalf("New() failed: %v", err)
+	}
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r, err := cab.Content("data")
+		if err != nil {
+			b.Fatalf("Content() failed: %v", err)
+		}
+		io.Copy(io.Discard, r)
+	}
+}
+
+func TestCompressionString(t *testing.T) {
+	for _, tt := range []struct {
+		typeCompress uint16
+		want         string
+	}{
+		{0x0000, "NONE"},
+		{0x0001, "MSZIP"},
+		{0x1503, "LZX:21"},
+		{0x0f03, "LZX:15"},
+		{0x1572, "Quantum:7:21"},
+		{0x000f, "CompressionType(15)"},
+	} {
+		if got := parseCompression(tt.typeCompress).String(); got != tt.want {
+			t.Errorf("parseCompression(%#04x).String() = %q; want %q", tt.typeCompress, got, tt.want)
+		}
+	}
+}
+
+func TestFolderReserve(t *testing.T) {
+	files := testFiles()
+	data := writeCabinetData(t, files, WithFolderPerFile(), WithReserve(0, 3, 0))
+	// The CFFOLDER entries follow the header and the fields sizing the
+	// reserve areas, each followed by its reserve area.
+	for i := range files {
+		copy(data[cfHeaderSize+4+i*(cfFolderSize+3)+cfFolderSize:], fmt.Sprintf("%03d", i))
+	}
+
+	cab := checkCabinet(t, bytes.NewReader(data), files)
+	fldrs := cab.Folders()
+	if len(fldrs) != len(files) {
+		t.Fatalf("Folders() returned %d folders; want %d", len(fldrs), len(files))
+	}
+	for i, fi := range fldrs {
+		if want := fmt.Sprintf("%03d", i); string(fi.Reserve) != want {
+			t.Errorf("Folders()[%d].Reserve = %q; want %q", i, fi.Reserve, want)
+		}
+	}
+
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionNone, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if got := cab.Folders()[0].Reserve; got != nil {
+		t.Errorf("Folders()[0].Reserve without reserve areas = %q; want nil", got)
+	}
+}
+
+func TestFolderBlocks(t *testing.T) {
+	files := []testFile{
+		{"a.bin", make([]byte, 2*maxBlockSize+1)},
+		{"b.txt", []byte("tiny")},
+	}
+	cab := writeCabinet(t, files, WithFolderPerFile())
+	fldrs := cab.Folders()
+	if len(fldrs) != len(files) {
+		t.Fatalf("Folders() returned %d folders; want %d", len(fldrs), len(files))
+	}
+	for i, want := range []int{3, 1} {
+		fi := fldrs[i]
+		if fi.Blocks != want {
+			t.Errorf("Folders()[%d].Blocks = %d; want %d", i, fi.Blocks, want)
+		}
+		it, err := cab.Blocks(i)
+		if err != nil {
+			t.Fatalf("Blocks(%d) failed: %v", i, err)
+		}
+		b, err := it.Next()
+		if err != nil {
+			t.Fatalf("Blocks(%d).Next() failed: %v", i, err)
+		}
+		if fi.DataOffset != b.Offset {
+			t.Errorf("Folders()[%d].DataOffset = %d; want %d", i, fi.DataOffset, b.Offset)
+		}
+	}
+}
+
+func TestAttributes(t *testing.T) {
+	a := AttrReadOnly | AttrExec | AttrNameIsUTF
+	got := []bool{a.ReadOnly(), a.Hidden(), a.System(), a.Archive(), a.Exec(), a.NameIsUTF()}
+	want := []bool{true, false, false, false, true, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Attributes %#04x reported as %v; want %v", uint16(a), got, want)
+	}
+}
+
+func TestDecodeUTF(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{"plain.txt", "plain.txt"},
+		{"stra\xc3\x9fe.txt", "straße.txt"},
+		{"\xf0\x9f\x98\x80.txt", "\U0001f600.txt"},
+		{"\xed\xa0\xbd\xed\xb8\x80.txt", "\U0001f600.txt"}, // encoded surrogate pair
+		{"\xed\xa0\xbdx.txt", "\ufffdx.txt"},               // unpaired surrogate
+		{"bad\xff.txt", "bad\ufffd.txt"},
+	} {
+		if got := decodeUTF([]byte(tc.name)); got != tc.want {
+			t.Errorf("decodeUTF(%q) = %q; want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestUTFNames(t *testing.T) {
+	files := []testFile{{"plain.txt", nil}, {"xxxxxx.txt", nil}}
+	data := writeCabinetData(t, files, WithNameEncoding(NameEncodingUTF))
+	// Replace the placeholder by U+1F600 stored as a pair of surrogates.
+	data = bytes.Replace(data, []byte("xxxxxx"), []byte("\xed\xa0\xbd\xed\xb8\x80"), 1)
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	want := []string{"plain.txt", "\U0001f600.txt"}
+	if got := cab.FileList(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FileList() = %q; want %q", got, want)
+	}
+	for _, fi := range cab.Files() {
+		if !fi.Attributes.NameIsUTF() {
+			t.Errorf("Files() reports %q without the UTF flag", fi.Name)
+		}
+	}
+	if _, err := cab.Content("\U0001f600.txt"); err != nil {
+		t.Errorf("Content() of the decoded name failed: %v", err)
+	}
+}
+
+func TestNameDecoder(t *testing.T) {
+	data := writeCabinetData(t, []testFile{{"plain.txt", nil}, {"straße.txt", nil}}, WithNameEncoding(NameEncodingOEM))
+	for _, tc := range []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"default", nil, []string{"plain.txt", "stra\xe1e.txt"}},
+		{"cp437", []Option{WithNameDecoder(DecodeCP437)}, []string{"plain.txt", "straße.txt"}},
+		{"custom", []Option{WithNameDecoder(func(b []byte) string { return "_" + string(b) })}, []string{"_plain.txt", "_stra\xe1e.txt"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cab, err := New(bytes.NewReader(data), tc.opts...)
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			if got := cab.FileList(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FileList() = %q; want %q", got, tc.want)
+			}
+
+			// Copied members keep their names as stored.
+			var out bytes.Buffer
+			cw := NewWriter(&out)
+			if err := cw.CopyFolder(cab, 0); err != nil {
+				t.Fatalf("CopyFolder() failed: %v", err)
+			}
+			if err := cw.Close(); err != nil {
+				t.Fatalf("Close() failed: %v", err)
+			}
+			c := parseRaw(t, out.Bytes())
+			if want := []string{"plain.txt", "stra\xe1e.txt"}; !reflect.DeepEqual(c.names, want) {
+				t.Errorf("Names stored by CopyFolder() = %q; want %q", c.names, want)
+			}
+		})
+	}
+}
+
+func TestFolderReader(t *testing.T) {
+	files := testFiles()
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	var want []byte
+	for _, f := range files {
+		want = append(want, f.data...)
+	}
+	r, size, err := cab.FolderReader(0)
+	if err != nil {
+		t.Fatalf("FolderReader(0) failed: %v", err)
+	}
+	if size != int64(len(want)) {
+		t.Errorf("FolderReader(0) reported size %d; want %d", size, len(want))
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Reading folder 0 failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("FolderReader(0) returned %d bytes not matching the %d bytes of the members", len(got), len(want))
+	}
+	for _, i := range []int{-1, 1} {
+		if _, _, err := cab.FolderReader(i); err == nil {
+			t.Errorf("FolderReader(%d) succeeded; want error", i)
+		}
+	}
+}
+
+func TestDataReserve(t *testing.T) {
+	files := []testFile{{"a.bin", make([]byte, 3*maxBlockSize)}}
+	rand.New(rand.NewSource(1)).Read(files[0].data)
+	data := writeCabinetData(t, files, WithCompression(CompressionMSZIP), WithReserve(0, 0, 4))
+
+	// Fill the reserve area of every block, which follows its header.
+	it, err := checkCabinet(t, bytes.NewReader(data), files).Blocks(0)
+	if err != nil {
+		t.Fatalf("Blocks(0) failed: %v", err)
+	}
+	var n int
+	for ; ; n++ {
+		b, err := it.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		copy(data[b.Offset+cfDataSize:], fmt.Sprintf("R%03d", b.Index))
+	}
+	if n < 3 {
+		t.Fatalf("Cabinet file has %d blocks; want at least 3", n)
+	}
+
+	cab := checkCabinet(t, bytes.NewReader(data), files)
+	if it, err = cab.Blocks(0); err != nil {
+		t.Fatalf("Blocks(0) failed: %v", err)
+	}
+	for i := 0; i < n; i++ {
+		b, err := it.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		if want := fmt.Sprintf("R%03d", i); string(b.Reserve) != want {
+			t.Errorf("block %d: Reserve = %q; want %q", i, b.Reserve, want)
+		}
+		if !b.ChecksumOK() {
+			t.Errorf("block %d: ChecksumOK() = false; want true", i)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	files := testFiles()
+	modified := time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(CompressionMSZIP))
+	for i, f := range files {
+		fw, err := w.CreateHeader(&FileHeader{
+			Name:       f.name,
+			Modified:   modified,
+			Attributes: AttrReadOnly,
+			Store:      i == 2,
+		})
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", f.name, err)
+		}
+		fw.Write(f.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(buf.Bytes()), files)
+
+	mszip, none := Compression{Type: CompressionMSZIP}, Compression{Type: CompressionNone}
+	want := []FileInfo{
+		{Name: "a.txt", Size: int64(len(files[0].data)), Modified: modified, Attributes: AttrReadOnly, DOSDate: 0x4ea1, DOSTime: 0x645c, Folder: 0, FolderOffset: 0, Compression: mszip},
+		{Name: "b.bin", Size: int64(len(files[1].data)), Modified: modified, Attributes: AttrReadOnly, DOSDate: 0x4ea1, DOSTime: 0x645c, Folder: 0, FolderOffset: int64(len(files[0].data)), Compression: mszip},
+		{Name: "c.txt", Size: int64(len(files[2].data)), Modified: modified, Attributes: AttrReadOnly, DOSDate: 0x4ea1, DOSTime: 0x645c, Folder: 1, FolderOffset: 0, Compression: none},
+	}
+	if got := cab.Files(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %+v; want %+v", got, want)
+	}
+}
+
+func TestFileInfoHeader(t *testing.T) {
+	files := testFiles()
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for i, f := range files {
+		// Zero and invalid dates and times are reproduced as well.
+		fw, err := w.CreateHeader(&FileHeader{Name: f.name, DOSDate: uint16(i * 0xffff), DOSTime: uint16(i), Attributes: AttrHidden, dosVerbatim: true})
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", f.name, err)
+		}
+		fw.Write(f.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(buf.Bytes()), files)
+
+	var out bytes.Buffer
+	cw := NewWriter(&out)
+	for _, fi := range cab.Files() {
+		fw, err := cw.CreateHeader(fi.Header())
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", fi.Name, err)
+		}
+		data, err := cab.ContentBytes(fi.Name)
+		if err != nil {
+			t.Fatalf("ContentBytes(%q) failed: %v", fi.Name, err)
+		}
+		fw.Write(data)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), buf.Bytes()) {
+		t.Error("Cabinet file written from the headers of Files() differs from the original")
+	}
+}
+
+func TestFilesByFolder(t *testing.T) {
+	files := append(testFiles(), testFile{"d.txt", []byte("more")})
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(CompressionMSZIP))
+	for i, f := range files {
+		// The last members are stored in an uncompressed folder.
+		fw, err := w.CreateHeader(&FileHeader{Name: f.name, Store: i >= 2})
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", f.name, err)
+		}
+		fw.Write(f.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(buf.Bytes()), files)
+	var got [][]string
+	for i, fis := range cab.FilesByFolder() {
+		var names []string
+		for _, fi := range fis {
+			if fi.Folder != i {
+				t.Errorf("FilesByFolder()[%d] holds %q of folder %d", i, fi.Name, fi.Folder)
+			}
+			names = append(names, fi.Name)
+		}
+		got = append(got, names)
+	}
+	want := [][]string{{"a.txt", "b.bin"}, {"c.txt", "d.txt"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FilesByFolder() = %q; want %q", got, want)
+	}
+}
+
+func TestFileListOrder(t *testing.T) {
+	files := []testFile{{"c.txt", []byte("1")}, {"a.txt", []byte("2")}, {"b.txt", []byte("3")}}
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionNone, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	want := []string{"c.txt", "a.txt", "b.txt"}
+	names := cab.FileList()
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("FileList() = %q; want %q", names, want)
+	}
+	if got, want := cab.SortedFileList(), []string{"a.txt", "b.txt", "c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SortedFileList() = %q; want %q", got, want)
+	}
+
+	// Modifying the results leaves the Cabinet intact.
+	names[0] = "modified"
+	cab.Files()[0].Name = "modified"
+	if got := cab.FileList(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FileList() after modifying a previous result = %q; want %q", got, want)
+	}
+	if _, err := cab.Content("c.txt"); err != nil {
+		t.Errorf("Content() after modifying a previous result failed: %v", err)
+	}
+}
+
+func TestExistsLen(t *testing.T) {
+	files := testFiles()
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionNone, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if got := cab.Len(); got != len(files) {
+		t.Errorf("Len() = %d; want %d", got, len(files))
+	}
+	for _, f := range files {
+		if !cab.Exists(f.name) {
+			t.Errorf("Exists(%q) = false; want true", f.name)
+		}
+	}
+	if cab.Exists("missing") {
+		t.Error(`Exists("missing") = true; want false`)
+	}
+}
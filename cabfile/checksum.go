@@ -0,0 +1,72 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ChecksumError reports a CFDATA block whose checksum does not match its
+// content.
+type ChecksumError struct {
+	Folder   int    // index of the folder
+	Block    int    // index of the block within the folder
+	Checksum uint32 // checksum stored in the block
+	Want     uint32 // checksum computed from the content
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum %#08x of data block %d of folder %d does not match its content; want %#08x", e.Checksum, e.Block, e.Folder, e.Want)
+}
+
+// Is reports whether target is ErrChecksum.
+func (e *ChecksumError) Is(target error) bool {
+	return target == ErrChecksum
+}
+
+// csum computes the MS-CAB checksum of p, starting with seed. Full 32-bit
+// words are combined little-endian with XOR, the remaining bytes form a
+// final word in big-endian order.
+func csum(p []byte, seed uint32) uint32 {
+	sum := seed
+	for len(p) >= 4 {
+		sum ^= binary.LittleEndian.Uint32(p)
+		p = p[4:]
+	}
+	var ul uint32
+	for _, b := range p {
+		ul = ul<<8 | uint32(b)
+	}
+	return sum ^ ul
+}
+
+// Checksum returns the checksum of a CFDATA block holding the compressed
+// data, which decompresses to uncomp bytes. Like libmspack and cabextract,
+// the checksum covers the compressed data followed by the cbData and
+// cbUncomp fields, but not the abReserve area. Data of a block split across
+// Cabinet files of a set is checksummed separately in each Cabinet file.
+func Checksum(data []byte, uncomp uint16) uint32 {
+	return blockChecksum(&cfData{CBData: uint16(len(data)), CBUncomp: uncomp}, data)
+}
+
+// blockChecksum returns the checksum of a CFDATA block with the given
+// header and compressed payload.
+func blockChecksum(d *cfData, payload []byte) uint32 {
+	var sizes [4]byte
+	binary.LittleEndian.PutUint16(sizes[0:], d.CBData)
+	binary.LittleEndian.PutUint16(sizes[2:], d.CBUncomp)
+	return csum(sizes[:], csum(payload, 0))
+}
@@ -0,0 +1,45 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		seed uint32
+		want uint32
+	}{
+		{nil, 0, 0},
+		{nil, 0x12345678, 0x12345678},
+		{[]byte{1, 2, 3, 4}, 0, 0x04030201},
+		{[]byte{1, 2, 3, 4, 5}, 0, 0x04030201 ^ 0x05},
+		{[]byte{1, 2, 3, 4, 5, 6}, 0, 0x04030201 ^ 0x0506},
+		{[]byte{1, 2, 3, 4, 5, 6, 7}, 0, 0x04030201 ^ 0x050607},
+		{[]byte{1, 2, 3, 4, 1, 2, 3, 4}, 0xff, 0xff},
+	} {
+		if got := csum(tc.data, tc.seed); got != tc.want {
+			t.Errorf("csum(%v, %#x) = %#08x; want %#08x", tc.data, tc.seed, got, tc.want)
+		}
+	}
+
+	d := cfData{CBData: 3, CBUncomp: 0x0102}
+	if got, want := blockChecksum(&d, []byte{0xaa, 0xbb, 0xcc}), uint32(0x01020003^0xaabbcc); got != want {
+		t.Errorf("blockChecksum() = %#08x; want %#08x", got, want)
+	}
+	if got, want := Checksum([]byte{0xaa, 0xbb, 0xcc}, 0x0102), uint32(0x01020003^0xaabbcc); got != want {
+		t.Errorf("Checksum() = %#08x; want %#08x", got, want)
+	}
+}
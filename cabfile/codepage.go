@@ -0,0 +1,131 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// cp437 holds the characters 0x80 to 0xff of code page 437, the original
+// IBM PC OEM code page, which is used for names without the UTF flag.
+const cp437 = "ÇüéâäàåçêëèïîìÄÅÉæÆôöòûùÿÖÜ¢£¥₧ƒáíóúñÑªº¿⌐¬½¼¡«»" +
+	"░▒▓│┤╡╢╖╕╣║╗╝╜╛┐└┴┬├─┼╞╟╚╔╩╦╠═╬╧╨╤╥╙╘╒╓╫╪┘┌█▄▌▐▀" +
+	"αßΓπΣσµτΦΘΩδ∞φε∩≡±≥≤⌠⌡÷≈°∙·√ⁿ²■ "
+
+// cp437Encode maps characters to their code page 437 bytes 0x80 to 0xff.
+var cp437Encode = func() map[rune]byte {
+	m := make(map[rune]byte, 128)
+	b := 0x80
+	for _, r := range cp437 {
+		m[r] = byte(b)
+		b++
+	}
+	return m
+}()
+
+// WithNameDecoder decodes the names of members without the UTF flag, which
+// are stored in the OEM code page of the system that created the Cabinet
+// file, using decode. By default such names are returned as stored.
+// DecodeCP437 decodes code page 437, and decoders of other code pages such
+// as those of golang.org/x/text/encoding/charmap and
+// golang.org/x/text/encoding/japanese can be adapted to a decode function.
+func WithNameDecoder(decode func([]byte) string) Option {
+	return func(c *Cabinet) {
+		c.decodeName = decode
+	}
+}
+
+// DecodeCP437 decodes a name in code page 437, the original IBM PC OEM code
+// page. It can be passed to WithNameDecoder.
+func DecodeCP437(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c < utf8.RuneSelf {
+			sb.WriteByte(c)
+		} else {
+			sb.WriteRune(cp437Decode[c-0x80])
+		}
+	}
+	return sb.String()
+}
+
+// cp437Decode maps the code page 437 bytes 0x80 to 0xff to their characters.
+var cp437Decode = []rune(cp437)
+
+// isASCII reports whether s consists of 7-bit characters only.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeOEM encodes a name in code page 437.
+func encodeOEM(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	b := make([]byte, 0, len(name))
+	for _, r := range name {
+		switch c, ok := cp437Encode[r]; {
+		case r < utf8.RuneSelf:
+			b = append(b, byte(r))
+		case ok:
+			b = append(b, c)
+		default:
+			return "", fmt.Errorf("name %q cannot be encoded in code page 437: unsupported character %q", name, r)
+		}
+	}
+	return string(b), nil
+}
+
+// decodeUTF decodes a name with the UTF flag. Cabinet files encode UTF-16
+// code units in up to three bytes like UTF-8, so characters outside the
+// Basic Multilingual Plane may be stored as a pair of encoded surrogates,
+// which are combined. Invalid sequences are replaced by U+FFFD.
+func decodeUTF(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, 0, len(b))
+	for len(b) > 0 {
+		r, n := decodeUTFRune(b)
+		if utf16.IsSurrogate(r) {
+			r2, n2 := decodeUTFRune(b[n:])
+			if dec := utf16.DecodeRune(r, r2); dec != utf8.RuneError {
+				r, n = dec, n+n2
+			} else {
+				r = utf8.RuneError
+			}
+		}
+		runes = append(runes, r)
+		b = b[n:]
+	}
+	return string(runes)
+}
+
+// decodeUTFRune decodes the first character of b like utf8.DecodeRune, but
+// also accepts the three-byte encodings of surrogates.
+func decodeUTFRune(b []byte) (rune, int) {
+	if len(b) >= 3 && b[0] == 0xed && b[1]&0xe0 == 0xa0 && b[2]&0xc0 == 0x80 {
+		return rune(b[0]&0x0f)<<12 | rune(b[1]&0x3f)<<6 | rune(b[2]&0x3f), 3
+	}
+	return utf8.DecodeRune(b)
+}
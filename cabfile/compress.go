@@ -0,0 +1,103 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"sync"
+)
+
+// A Compressor returns a new BlockCompressor for a folder using the given
+// compression method and parameters. The meaning of level is up to the
+// Compressor.
+type Compressor func(c Compression, level int) (BlockCompressor, error)
+
+// BlockCompressor compresses the CFDATA blocks of a single folder. Compress
+// is called once for every block, in order, with at most 32768 bytes of
+// uncompressed data and returns the compressed payload of the block. The
+// returned slice only needs to remain valid until the next call.
+type BlockCompressor interface {
+	Compress(block []byte) ([]byte, error)
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[CompressionType]Compressor{
+		CompressionNone:  newStoreCompressor,
+		CompressionMSZIP: newMSZIPCompressor,
+	}
+)
+
+// RegisterCompressor registers or overrides a Compressor for the given
+// compression method. It is safe to call from multiple goroutines.
+func RegisterCompressor(method CompressionType, comp Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[method] = comp
+}
+
+func compressor(method CompressionType) Compressor {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	return compressors[method]
+}
+
+// storeCompressor stores blocks uncompressed.
+type storeCompressor struct{}
+
+func newStoreCompressor(Compression, int) (BlockCompressor, error) {
+	return storeCompressor{}, nil
+}
+
+func (storeCompressor) Compress(block []byte) ([]byte, error) {
+	return block, nil
+}
+
+// mszipCompressor compresses blocks using MS-ZIP: every block is a separate
+// deflate stream prefixed by the "CK" signature, using the uncompressed data
+// of the previous block as dictionary.
+type mszipCompressor struct {
+	level   int
+	buf     bytes.Buffer
+	history []byte
+}
+
+func newMSZIPCompressor(_ Compression, level int) (BlockCompressor, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("invalid MS-ZIP compression level %d", level)
+	}
+	return &mszipCompressor{level: level}, nil
+}
+
+func (c *mszipCompressor) Compress(block []byte) ([]byte, error) {
+	c.buf.Reset()
+	c.buf.WriteString("CK")
+	// flate.Writer.Reset retains the original dictionary, so a new
+	// compressor is required for every block.
+	fw, err := flate.NewWriterDict(&c.buf, c.level, c.history)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fw.Write(block); err != nil {
+		return nil, err
+	}
+	if err := fw.Close(); err != nil {
+		return nil, err
+	}
+	c.history = append(c.history[:0], block...)
+	return c.buf.Bytes(), nil
+}
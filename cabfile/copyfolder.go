@@ -0,0 +1,131 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CopyFolder adds all members of the folder of src with the given index,
+// copying its compressed CFDATA blocks verbatim instead of decompressing and
+// compressing them again. The folder keeps its compression method, and the
+// members their names, attributes and timestamps. Members added afterwards
+// start a new folder.
+func (w *Writer) CopyFolder(src *Cabinet, folder int) error {
+	if folder < 0 || folder >= len(src.fldrs) {
+		return errors.New("folder number out of range")
+	}
+	var files []*file
+	var hdrs []*FileHeader
+	for _, f := range src.files {
+		if int(f.IFolder) == folder {
+			files = append(files, f)
+			hdrs = append(hdrs, &FileHeader{Name: f.name})
+		}
+	}
+	return w.copyFolder(src, uint16(folder), files, hdrs)
+}
+
+// copyFolder copies the folder of src with the given index and adds the
+// given members of it. Members renamed in hdrs have their names encoded
+// according to the NameEncoding, all others are copied verbatim.
+func (w *Writer) copyFolder(src *Cabinet, idx uint16, files []*file, hdrs []*FileHeader) error {
+	if w.closed {
+		return errors.New("writer is closed")
+	}
+	if err := w.checkContext(); err != nil {
+		return err
+	}
+	if err := w.endMember(); err != nil {
+		return err
+	}
+	if len(w.files)+len(files) > maxFiles {
+		return ErrTooManyFiles
+	}
+	if len(w.fldrs) >= maxFolders {
+		return ErrTooManyFolders
+	}
+	if err := w.endFolder(); err != nil {
+		return err
+	}
+
+	entries := make([]*file, len(files))
+	for i, f := range files {
+		name, attrs := f.name, Attributes(f.Attribs)
+		if f.raw != "" {
+			name = f.raw
+		}
+		if hdrs[i].Name != f.name {
+			var err error
+			if name, attrs, err = w.encodeName(hdrs[i].Name, attrs); err != nil {
+				return err
+			}
+		}
+		entry := *f.cfFile
+		entry.IFolder = uint16(len(w.fldrs))
+		entry.Attribs = uint16(attrs)
+		entries[i] = &file{cfFile: &entry, name: name}
+	}
+
+	sfldr := src.fldrs[idx]
+	fldr := w.appendFolder(sfldr.TypeCompress, nil)
+	fldr.ended = true
+	if err := fldr.copyBlocks(src, sfldr); err != nil {
+		w.err = fmt.Errorf("could not copy folder %d: %w", idx, err)
+		return w.err
+	}
+	fldr.files = len(entries)
+	w.files = append(w.files, entries...)
+	w.progress.Files += len(entries)
+	w.progress.Bytes += fldr.size
+	w.report()
+	return nil
+}
+
+// copyBlocks copies the CFDATA blocks of sfldr of src to the folder, adjusting
+// their reserve areas to the folder.
+func (f *writerFolder) copyBlocks(src *Cabinet, sfldr *cfFolder) error {
+	if _, err := src.r.Seek(int64(sfldr.COFFCabStart), io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek to start of data section: %v", err)
+	}
+	var payload []byte
+	for i := 0; i < int(sfldr.CCFData); i++ {
+		var d cfData
+		if err := binary.Read(src.r, binary.LittleEndian, &d); err != nil {
+			return fmt.Errorf("could not read header of data block %d: %v", i, err)
+		}
+		if _, err := src.r.Seek(int64(src.hdr.CBCFData), io.SeekCurrent); err != nil {
+			return fmt.Errorf("could not skip reserve area of data block %d: %v", i, err)
+		}
+		payload = resize(payload, int(d.CBData))
+		if _, err := io.ReadFull(src.r, payload); err != nil {
+			return fmt.Errorf("could not read data block %d: %v", i, err)
+		}
+		if d.CBUncomp > maxBlockSize {
+			return fmt.Errorf("data block %d holds %d bytes; maximum is %d", i, d.CBUncomp, maxBlockSize)
+		}
+		if f.size+int64(d.CBUncomp) > maxFolderSize {
+			return ErrFolderTooLarge
+		}
+		if err := f.writeBlock(&d, payload); err != nil {
+			return err
+		}
+		f.size += int64(d.CBUncomp)
+	}
+	return nil
+}
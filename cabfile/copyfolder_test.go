@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCopyFolder(t *testing.T) {
+	files := testFiles()
+	src := buildCabinet(t, CompressionMSZIP, 300, files)
+	cab, err := New(bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	for _, workers := range []int{1, 4} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WithConcurrency(workers), WithReserve(0, 0, 8))
+		if err := w.AddFile("first.txt", time.Time{}, bytes.NewReader([]byte("first"))); err != nil {
+			t.Fatalf("AddFile() failed: %v", err)
+		}
+		if err := w.CopyFolder(cab, 0); err != nil {
+			t.Fatalf("CopyFolder() failed: %v", err)
+		}
+		if err := w.AddFile("last.txt", time.Time{}, bytes.NewReader([]byte("last"))); err != nil {
+			t.Fatalf("AddFile() failed: %v", err)
+		}
+		if err := w.CopyFolder(cab, 1); err == nil {
+			t.Error("CopyFolder() of missing folder succeeded; want error")
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() failed: %v", err)
+		}
+
+		// The reader does not support data reserve areas yet, so compare
+		// the copied blocks to the source.
+		out := buf.Bytes()
+		c := parseRaw(t, out)
+		if got, want := len(c.fldrs), 3; got != want {
+			t.Fatalf("Number of folders = %d; want %d", got, want)
+		}
+		if got, want := c.fldrs[1].TypeCompress, uint16(CompressionMSZIP); got != want {
+			t.Errorf("TypeCompress of copied folder = %d; want %d", got, want)
+		}
+		if got, want := c.names, []string{"first.txt", "a.txt", "b.bin", "c.txt", "last.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Names = %q; want %q", got, want)
+		}
+		soff, off := cab.fldrs[0].COFFCabStart, c.fldrs[1].COFFCabStart
+		for i := 0; i < int(cab.fldrs[0].CCFData); i++ {
+			sd, d := src[soff:soff+cfDataSize], out[off:off+cfDataSize]
+			if !bytes.Equal(sd, d) {
+				t.Errorf("Header of block %d = %x; want %x", i, d, sd)
+			}
+			n := uint32(sd[4]) | uint32(sd[5])<<8
+			soff += cfDataSize
+			off += cfDataSize + 8
+			if !bytes.Equal(src[soff:soff+n], out[off:off+n]) {
+				t.Errorf("Data of block %d differs from source", i)
+			}
+			soff += n
+			off += n
+		}
+	}
+}
+
+func TestEditorCopiesUnchangedFolders(t *testing.T) {
+	var src bytes.Buffer
+	w := NewWriter(&src, WithCompression(CompressionMSZIP), WithFolderSize(1000))
+	for _, f := range testFiles() {
+		if err := w.AddFile(f.name, time.Date(2019, 1, 2, 3, 4, 6, 0, time.UTC), bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	// Unchanged folders are copied bit for bit, even at a different level.
+	e, err := NewEditor(bytes.NewReader(src.Bytes()))
+	if err != nil {
+		t.Fatalf("NewEditor() failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := e.Write(&out, WithCompressionLevel(1), WithFolderSize(1000)); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), src.Bytes()) {
+		t.Error("Unchanged Cabinet file differs after Write()")
+	}
+
+	// Renaming keeps the folder unchanged.
+	if err := e.Rename("c.txt", "d.txt"); err != nil {
+		t.Fatalf("Rename() failed: %v", err)
+	}
+	out.Reset()
+	if err := e.Write(&out); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	files := testFiles()
+	files[2].name = "d.txt"
+	checkCabinet(t, bytes.NewReader(out.Bytes()), files)
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import "time"
+
+// EncodeDOSTime converts t into the MS-DOS date and time format used by
+// CFFILE entries, which has a resolution of two seconds and no time zone.
+// The fields of t are used as they are, without converting t to another
+// location. Times before 1980 are clamped to the earliest representable
+// date, and times after 2107 to the latest.
+func EncodeDOSTime(t time.Time) (date, tm uint16) {
+	switch {
+	case t.Year() < 1980:
+		return 1<<5 | 1, 0
+	case t.Year() > 2107:
+		return 127<<9 | 12<<5 | 31, 23<<11 | 59<<5 | 29
+	}
+	date = uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+	tm = uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()/2)
+	return date, tm
+}
+
+// DecodeDOSTime converts an MS-DOS date and time as used by CFFILE entries
+// into a time in UTC.
+func DecodeDOSTime(date, tm uint16) time.Time {
+	return time.Date(
+		int(date>>9)+1980, time.Month(date>>5&0xf), int(date&0x1f),
+		int(tm>>11), int(tm>>5&0x3f), int(tm&0x1f)*2, 0, time.UTC)
+}
+
+// WithLocation interprets the modification times of members, which Cabinet
+// files store without a time zone, in the given location. Windows uses the
+// local time zone, time.Local, which also makes the times match those
+// displayed by Windows tools. By default, times are interpreted as UTC.
+func WithLocation(loc *time.Location) Option {
+	return func(c *Cabinet) {
+		c.location = loc
+	}
+}
+
+// modTime returns the modification time of the member f in the location set
+// by WithLocation.
+func (c *Cabinet) modTime(f *file) time.Time {
+	t := DecodeDOSTime(f.Date, f.Time)
+	if c.location == nil {
+		return t
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, c.location)
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDOSTime(t *testing.T) {
+	for _, tc := range []struct {
+		t        time.Time
+		date, tm uint16
+		decoded  time.Time
+	}{
+		{time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC), 0x4ea1, 0x645c, time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)},
+		{time.Date(2019, 5, 1, 12, 34, 57, 0, time.UTC), 0x4ea1, 0x645c, time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)},
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), 0x0021, 0, time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC), 0xff9f, 0xbf7d, time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC)},
+		// The fields of times in other locations are kept.
+		{time.Date(2019, 5, 1, 12, 34, 56, 0, time.FixedZone("", 3600)), 0x4ea1, 0x645c, time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)},
+	} {
+		date, tm := EncodeDOSTime(tc.t)
+		if date != tc.date || tm != tc.tm {
+			t.Errorf("EncodeDOSTime(%v) = %#04x, %#04x; want %#04x, %#04x", tc.t, date, tm, tc.date, tc.tm)
+		}
+		if got := DecodeDOSTime(date, tm); !got.Equal(tc.decoded) {
+			t.Errorf("DecodeDOSTime(%#04x, %#04x) = %v; want %v", date, tm, got, tc.decoded)
+		}
+	}
+}
+
+func TestWithLocation(t *testing.T) {
+	files := []testFile{{"a.txt", []byte("hello")}}
+	modified := time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)
+	data := writeCabinetData(t, files, WithReproducible(modified))
+	loc := time.FixedZone("UTC-8", -8*3600)
+	for _, tc := range []struct {
+		opts []Option
+		want time.Time
+	}{
+		{nil, modified},
+		{[]Option{WithLocation(time.UTC)}, modified},
+		{[]Option{WithLocation(loc)}, time.Date(2019, 5, 1, 12, 34, 56, 0, loc)},
+	} {
+		cab, err := New(bytes.NewReader(data), tc.opts...)
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		if got := cab.Files()[0].Modified; !got.Equal(tc.want) || got.Location() != tc.want.Location() {
+			t.Errorf("Files()[0].Modified = %v; want %v", got, tc.want)
+		}
+		hdr, err := cab.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		if !hdr.Modified.Equal(tc.want) {
+			t.Errorf("Next().Modified = %v; want %v", hdr.Modified, tc.want)
+		}
+		fi, err := cab.Stat("a.txt")
+		if err != nil {
+			t.Fatalf("Stat() failed: %v", err)
+		}
+		if !fi.ModTime().Equal(tc.want) {
+			t.Errorf("Stat().ModTime() = %v; want %v", fi.ModTime(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dump writes a textual description of the structures of the Cabinet file to
+// w: the header, the folders and the members. Nothing is decompressed. The
+// format is stable, so that it can be compared in tests, and numbers are
+// written in decimal except for flags, dates and times.
+func (c *Cabinet) Dump(w io.Writer) error {
+	var b strings.Builder
+	h := c.Header()
+	fmt.Fprintf(&b, "CFHEADER version=%d.%d size=%d files_offset=%d folders=%d files=%d flags=%#04x set_id=%d index=%d\n",
+		h.VersionMajor, h.VersionMinor, h.Size, h.FilesOffset, h.Folders, h.Files, h.Flags, h.SetID, h.CabinetIndex)
+	fmt.Fprintf(&b, "  reserve header=%d folder=%d data=%d\n", h.HeaderReserve, h.FolderReserve, h.DataReserve)
+	if h.Reserved1 != 0 || h.Reserved2 != 0 || h.Reserved3 != 0 {
+		fmt.Fprintf(&b, "  reserved %#010x %#010x %#010x\n", h.Reserved1, h.Reserved2, h.Reserved3)
+	}
+	if h.PrevCabinet != "" || h.PrevDisk != "" {
+		fmt.Fprintf(&b, "  prev cabinet=%q disk=%q\n", h.PrevCabinet, h.PrevDisk)
+	}
+	if h.NextCabinet != "" || h.NextDisk != "" {
+		fmt.Fprintf(&b, "  next cabinet=%q disk=%q\n", h.NextCabinet, h.NextDisk)
+	}
+	for i, fi := range c.Folders() {
+		fmt.Fprintf(&b, "CFFOLDER[%d] compression=%v blocks=%d data_offset=%d\n", i, fi.Compression, fi.Blocks, fi.DataOffset)
+	}
+	for i, f := range c.files {
+		fmt.Fprintf(&b, "CFFILE[%d] name=%q size=%d folder=%d offset=%d date=%#04x time=%#04x attribs=%#04x\n",
+			i, f.name, f.CBFile, f.IFolder, f.UOffFolderStart, f.Date, f.Time, f.Attribs)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
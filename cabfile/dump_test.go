@@ -0,0 +1,40 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDump(t *testing.T) {
+	files := []testFile{{`dir\a.txt`, []byte("hello")}, {"b.txt", []byte("world!")}}
+	modified := time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)
+	cab := writeCabinet(t, files, WithCompression(CompressionMSZIP), WithSetID(7), WithReproducible(modified))
+	var out bytes.Buffer
+	if err := cab.Dump(&out); err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+	want := `CFHEADER version=1.3 size=120 files_offset=44 folders=1 files=2 flags=0x0000 set_id=7 index=0
+  reserve header=0 folder=0 data=0
+CFFOLDER[0] compression=MSZIP blocks=1 data_offset=92
+CFFILE[0] name="dir\\a.txt" size=5 folder=0 offset=0 date=0x4ea1 time=0x645c attribs=0x0020
+CFFILE[1] name="b.txt" size=6 folder=0 offset=5 date=0x4ea1 time=0x645c attribs=0x0020
+`
+	if got := out.String(); got != want {
+		t.Errorf("Dump() wrote\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Editor rebuilds an existing Cabinet file with members removed, renamed,
+// replaced or added. Members keep their order, added members follow the
+// existing ones.
+type Editor struct {
+	cab     *Cabinet
+	members []*editMember
+}
+
+// editMember is a member of the rebuilt Cabinet file.
+type editMember struct {
+	fh  FileHeader
+	src *file     // member of the existing Cabinet file holding the content
+	r   io.Reader // new content, if src is nil
+}
+
+// NewEditor returns a new Editor for the Cabinet file read from r, which is
+// read according to the options.
+func NewEditor(r io.ReadSeeker, opts ...Option) (*Editor, error) {
+	cab, err := New(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	e := &Editor{cab: cab}
+	for _, f := range cab.files {
+		e.members = append(e.members, &editMember{
+			fh: FileHeader{
+				Name:        f.name,
+				DOSDate:     f.Date,
+				DOSTime:     f.Time,
+				Attributes:  Attributes(f.Attribs),
+				dosVerbatim: true,
+			},
+			src: f,
+		})
+	}
+	return e, nil
+}
+
+// find returns the index of the member of the given name.
+func (e *Editor) find(name string) (int, error) {
+	for i, m := range e.members {
+		if m.fh.Name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("could not find %q: %w", name, ErrFileNotFound)
+}
+
+// Remove removes the member of the given name.
+func (e *Editor) Remove(name string) error {
+	i, err := e.find(name)
+	if err != nil {
+		return err
+	}
+	e.members = append(e.members[:i], e.members[i+1:]...)
+	return nil
+}
+
+// Rename renames the member of the given name to newName.
+func (e *Editor) Rename(name, newName string) error {
+	if _, err := e.find(newName); err == nil {
+		return fmt.Errorf("file %q already exists in Cabinet", newName)
+	}
+	i, err := e.find(name)
+	if err != nil {
+		return err
+	}
+	e.members[i].fh.Name = newName
+	return nil
+}
+
+// Replace replaces the content and modification time of the member of the
+// given name, keeping its position and attributes. The content is read from
+// r when the Cabinet file is written.
+func (e *Editor) Replace(name string, modified time.Time, r io.Reader) error {
+	i, err := e.find(name)
+	if err != nil {
+		return err
+	}
+	m := e.members[i]
+	m.fh.Modified = modified
+	m.fh.DOSDate, m.fh.DOSTime, m.fh.dosVerbatim = 0, 0, false
+	m.src, m.r = nil, r
+	return nil
+}
+
+// Add appends a member of the given name. The content is read from r when
+// the Cabinet file is written.
+func (e *Editor) Add(name string, modified time.Time, r io.Reader) error {
+	if _, err := e.find(name); err == nil {
+		return fmt.Errorf("file %q already exists in Cabinet", name)
+	}
+	e.members = append(e.members, &editMember{
+		fh: FileHeader{Name: name, Modified: modified, Attributes: AttrArchive},
+		r:  r,
+	})
+	return nil
+}
+
+// Write writes the rebuilt Cabinet file to w. The compression of the first
+// folder, the SetID and the index of the existing Cabinet file are kept
+// unless overridden by opts. Folders whose members are all kept unchanged
+// and in order are copied verbatim if compressed like the rebuilt Cabinet
+// file.
+func (e *Editor) Write(w io.Writer, opts ...WriterOption) error {
+	var defaults []WriterOption
+	if fldrs := e.cab.Folders(); len(fldrs) > 0 {
+		defaults = append(defaults, WithCompressionParameters(fldrs[0].Compression))
+	}
+	defaults = append(defaults, WithSetID(e.cab.SetID()), WithCabinetIndex(e.cab.CabinetIndex()))
+	cw := NewWriter(w, append(defaults, opts...)...)
+	mr := newMemberReader(e.cab)
+	for i := 0; i < len(e.members); {
+		if files := e.unchangedFolder(i, cw); files != nil {
+			hdrs := make([]*FileHeader, len(files))
+			for k := range files {
+				hdrs[k] = &e.members[i+k].fh
+			}
+			if err := cw.copyFolder(e.cab, files[0].IFolder, files, hdrs); err != nil {
+				return cw.abort(err)
+			}
+			i += len(files)
+			continue
+		}
+		m := e.members[i]
+		if err := copyMember(cw, mr, &m.fh, m.src, m.r); err != nil {
+			return cw.abort(err)
+		}
+		i++
+	}
+	return cw.Close()
+}
+
+// unchangedFolder returns the members of the existing Cabinet file's folder
+// if the members starting at index i are exactly the members of that folder
+// with unchanged content and the folder is compressed like cw compresses.
+// The compressed data of such a folder can be copied verbatim.
+func (e *Editor) unchangedFolder(i int, cw *Writer) []*file {
+	src := e.members[i].src
+	if src == nil || int(src.IFolder) >= len(e.cab.fldrs) || e.cab.fldrs[src.IFolder].TypeCompress != cw.compression.typeCompress() {
+		return nil
+	}
+	var files []*file
+	for _, f := range e.cab.files {
+		if f.IFolder == src.IFolder {
+			files = append(files, f)
+		}
+	}
+	if len(e.members)-i < len(files) {
+		return nil
+	}
+	for k, f := range files {
+		if e.members[i+k].src != f {
+			return nil
+		}
+	}
+	return files
+}
+
+// copyMember adds a member to cw, with its content read from src if not nil
+// and r otherwise.
+func copyMember(cw *Writer, mr *memberReader, fh *FileHeader, src *file, r io.Reader) error {
+	fw, err := cw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		_, err = io.Copy(fw, r)
+	} else if r, err = mr.open(int(src.IFolder), src); err == nil {
+		_, err = io.CopyN(fw, r, int64(src.CBFile))
+	}
+	if err != nil {
+		return fmt.Errorf("could not copy content of %q: %v", fh.Name, err)
+	}
+	return nil
+}
+
+// abort closes the Writer without writing the Cabinet file, removing any
+// temporary file, and returns err.
+func (w *Writer) abort(err error) error {
+	if w.err == nil {
+		w.err = err
+	}
+	w.Close()
+	return err
+}
+
+// memberReader reads the content of members, decompressing every folder
+// only once as long as the members are read in the order of their content.
+type memberReader struct {
+	folderData func(idx int) (io.Reader, error)
+	fldr       int
+	data       io.Reader // uncompressed data of fldr, nil if none
+	pos        int64     // offset of data in fldr
+}
+
+// newMemberReader returns a memberReader for the members of cab.
+func newMemberReader(cab *Cabinet) *memberReader {
+	return &memberReader{folderData: func(idx int) (io.Reader, error) {
+		return cab.folderData(uint16(idx))
+	}}
+}
+
+// open returns a reader for the content of f, stored in the folder with the
+// given index.
+func (mr *memberReader) open(fldr int, f *file) (io.Reader, error) {
+	if mr.data == nil || fldr != mr.fldr || int64(f.UOffFolderStart) < mr.pos {
+		data, err := mr.folderData(fldr)
+		if err != nil {
+			return nil, fmt.Errorf("could not acquire uncompressed data for folder %d: %v", fldr, err)
+		}
+		mr.fldr, mr.data, mr.pos = fldr, data, 0
+	}
+	if _, err := io.CopyN(io.Discard, mr, int64(f.UOffFolderStart)-mr.pos); err != nil {
+		return nil, fmt.Errorf("could not skip to start of data: %w", err)
+	}
+	return io.LimitReader(mr, int64(f.CBFile)), nil
+}
+
+func (mr *memberReader) Read(p []byte) (int, error) {
+	n, err := mr.data.Read(p)
+	mr.pos += int64(n)
+	return n, err
+}
+
+// Transcode rewrites the Cabinet file read from r to w with its members
+// compressed using c. Names, order, attributes and timestamps of the members
+// are preserved. Further options, like the compression level, are applied
+// to the Writer. Folders already compressed using c are copied verbatim.
+func Transcode(r io.ReadSeeker, w io.Writer, c Compression, opts ...WriterOption) error {
+	e, err := NewEditor(r)
+	if err != nil {
+		return err
+	}
+	return e.Write(w, append([]WriterOption{WithCompressionParameters(c)}, opts...)...)
+}
@@ -0,0 +1,158 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditor(t *testing.T) {
+	files := testFiles()
+	var src bytes.Buffer
+	w := NewWriter(&src, WithCompression(CompressionMSZIP), WithSetID(7))
+	for _, f := range files {
+		fw, err := w.CreateHeader(&FileHeader{Name: f.name, DOSDate: 0x4ee1, DOSTime: 0x63c5, Attributes: AttrReadOnly})
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", f.name, err)
+		}
+		fw.Write(f.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	e, err := NewEditor(bytes.NewReader(src.Bytes()))
+	if err != nil {
+		t.Fatalf("NewEditor() failed: %v", err)
+	}
+	modified := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+	if err := e.Remove("b.bin"); err != nil {
+		t.Errorf("Remove() failed: %v", err)
+	}
+	if err := e.Rename("c.txt", `sub\d.txt`); err != nil {
+		t.Errorf("Rename() failed: %v", err)
+	}
+	if err := e.Replace("a.txt", modified, strings.NewReader("replaced")); err != nil {
+		t.Errorf("Replace() failed: %v", err)
+	}
+	if err := e.Add("e.txt", modified, strings.NewReader("added")); err != nil {
+		t.Errorf("Add() failed: %v", err)
+	}
+	for name, err := range map[string]error{
+		"Remove() of missing member":  e.Remove("missing"),
+		"Rename() of missing member":  e.Rename("missing", "x"),
+		"Rename() to existing member": e.Rename("a.txt", "e.txt"),
+		"Replace() of missing member": e.Replace("missing", modified, strings.NewReader("")),
+		"Add() of existing member":    e.Add("e.txt", modified, strings.NewReader("")),
+	} {
+		if err == nil {
+			t.Errorf("%s succeeded; want error", name)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := e.Write(&out); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(out.Bytes()), []testFile{
+		{"a.txt", []byte("replaced")},
+		{`sub\d.txt`, files[2].data},
+		{"e.txt", []byte("added")},
+	})
+	if got, want := cab.Folders()[0].Compression.Type, CompressionMSZIP; got != want {
+		t.Errorf("Compression = %v; want %v", got, want)
+	}
+	if got, want := cab.SetID(), uint16(7); got != want {
+		t.Errorf("SetID() = %d; want %d", got, want)
+	}
+	date, tm := EncodeDOSTime(modified)
+	for i, want := range []cfFile{
+		{CBFile: 8, Date: date, Time: tm, Attribs: uint16(AttrReadOnly)},
+		{CBFile: 4, UOffFolderStart: 8, Date: 0x4ee1, Time: 0x63c5, Attribs: uint16(AttrReadOnly)},
+		{CBFile: 5, UOffFolderStart: 12, Date: date, Time: tm, Attribs: uint16(AttrArchive)},
+	} {
+		if got := *cab.files[i].cfFile; got != want {
+			t.Errorf("File entry %d = %+v; want %+v", i, got, want)
+		}
+	}
+}
+
+func TestEditorReadError(t *testing.T) {
+	data := buildCabinet(t, CompressionNone, 100, testFiles())
+	e, err := NewEditor(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewEditor() failed: %v", err)
+	}
+	if err := e.Replace("b.bin", time.Time{}, &failingReader{}); err != nil {
+		t.Fatalf("Replace() failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := e.Write(&out); err == nil {
+		t.Error("Write() with failing reader succeeded; want error")
+	}
+	if out.Len() != 0 {
+		t.Errorf("Write() with failing reader wrote %d bytes; want none", out.Len())
+	}
+}
+
+func TestEditorMissingFolder(t *testing.T) {
+	data := writeCabinetData(t, testFiles())
+	// Point the first file to a folder past the end of the CFFOLDER table.
+	c := parseRaw(t, data)
+	binary.LittleEndian.PutUint16(data[c.hdr.COFFFiles+8:], 7)
+	e, err := NewEditor(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("NewEditor() failed: %v", err)
+	}
+	if err := e.Write(io.Discard); err == nil {
+		t.Error("Write() of a member of a missing folder succeeded; want error")
+	}
+	if err := Transcode(bytes.NewReader(data), io.Discard, Compression{Type: CompressionMSZIP}); err == nil {
+		t.Error("Transcode() of a member of a missing folder succeeded; want error")
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	files := testFiles()
+	src := buildCabinet(t, CompressionNone, 100, files)
+	orig, err := New(bytes.NewReader(src))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	for _, c := range []Compression{{Type: CompressionMSZIP}, {Type: CompressionNone}} {
+		var out bytes.Buffer
+		if err := Transcode(bytes.NewReader(src), &out, c, WithCompressionLevel(9)); err != nil {
+			t.Fatalf("Transcode() to %v failed: %v", c, err)
+		}
+		cab := checkCabinet(t, bytes.NewReader(out.Bytes()), files)
+		if got := cab.Folders()[0].Compression; got != c {
+			t.Errorf("Compression after Transcode() = %v; want %v", got, c)
+		}
+		for i, f := range cab.files {
+			if got, want := *f.cfFile, *orig.files[i].cfFile; got != want {
+				t.Errorf("File entry %d after Transcode() to %v = %+v; want %+v", i, c, got, want)
+			}
+		}
+	}
+
+	if err := Transcode(bytes.NewReader(src), io.Discard, Compression{Type: CompressionLZX}); err == nil {
+		t.Error("Transcode() to LZX succeeded; want error")
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fsEntry is a member or a directory of the fs.FS view of a Cabinet file.
+type fsEntry struct {
+	f        *file    // nil for directories
+	children []string // paths of the entries of a directory, sorted
+}
+
+// fsIndex holds the entries of the fs.FS view of a Cabinet file, which are
+// built once on first use and shared by its clones.
+type fsIndex struct {
+	once    sync.Once
+	entries map[string]*fsEntry
+}
+
+// fsEntries returns the entries of the fs.FS view of the Cabinet file by
+// their slash-separated paths. Directories are implied by the names of the
+// members. Members whose names are not valid paths, which duplicate earlier
+// names or which conflict with directories are left out.
+func (c *Cabinet) fsEntries() map[string]*fsEntry {
+	c.fsys.once.Do(func() {
+		c.fsys.entries = c.buildFSEntries()
+	})
+	return c.fsys.entries
+}
+
+// buildFSEntries builds the entries returned by fsEntries.
+func (c *Cabinet) buildFSEntries() map[string]*fsEntry {
+	idx := map[string]*fsEntry{".": {}}
+	// mkdir adds the directory dir and its parents, reporting whether dir
+	// is a directory.
+	var mkdir func(dir string) bool
+	mkdir = func(dir string) bool {
+		if e, ok := idx[dir]; ok {
+			return e.f == nil
+		}
+		parent := path.Dir(dir)
+		if !mkdir(parent) {
+			return false
+		}
+		idx[dir] = &fsEntry{}
+		idx[parent].children = append(idx[parent].children, dir)
+		return true
+	}
+	for _, f := range c.files {
+		name := strings.ReplaceAll(f.name, `\`, "/")
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		if _, ok := idx[name]; ok {
+			continue
+		}
+		dir := path.Dir(name)
+		if !mkdir(dir) {
+			continue
+		}
+		idx[name] = &fsEntry{f: f}
+		idx[dir].children = append(idx[dir].children, name)
+	}
+	for _, e := range idx {
+		sort.Strings(e.children)
+	}
+	return idx
+}
+
+// Open opens the member or directory of the given slash-separated path,
+// implementing fs.FS. Backslashes in the names of members separate
+// directories, which are implied by the names. Reading a member streams its
+// content, decompressing its folder from the start, and reading a directory
+// lists its entries. Members whose names are not valid paths or duplicate
+// earlier names are not accessible. Files may only be read concurrently, as
+// by http.FS, if the Cabinet was returned by NewReaderAt.
+func (c *Cabinet) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := c.fsEntries()[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.f == nil {
+		return &fsDir{c: c, path: name, e: e}, nil
+	}
+	return &fsFile{c: c, path: name, f: e.f}, nil
+}
+
+// fsStat returns the fs.FileInfo of the entry of the fs.FS view at the given
+// path.
+func (c *Cabinet) fsStat(name string, e *fsEntry) fs.FileInfo {
+	if e.f == nil {
+		return dirStat(path.Base(name))
+	}
+	return c.stat(e.f)
+}
+
+// fsFile is a member opened by Open.
+type fsFile struct {
+	c      *Cabinet
+	path   string
+	f      *file
+	r      io.Reader // content, opened by the first call to Read
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.path, Err: fs.ErrClosed}
+	}
+	return f.c.stat(f.f), nil
+}
+
+func (f *fsFile) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.path, Err: fs.ErrClosed}
+	}
+	if f.r == nil {
+		if err := f.c.limits.checkFile(f.f); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.path, Err: err}
+		}
+		data, err := f.c.fileData(f.f)
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.path, Err: err}
+		}
+		f.r = &entryReader{r: data, left: int64(f.f.CBFile)}
+	}
+	return f.r.Read(p)
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.path, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// fsDir is a directory opened by Open.
+type fsDir struct {
+	c      *Cabinet
+	path   string
+	e      *fsEntry
+	next   int // index of the next entry returned by ReadDir
+	closed bool
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "stat", Path: d.path, Err: fs.ErrClosed}
+	}
+	return dirStat(path.Base(d.path)), nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.path, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile, returning the entries sorted by name.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.path, Err: fs.ErrClosed}
+	}
+	children := d.e.children[d.next:]
+	if n > 0 && len(children) > n {
+		children = children[:n]
+	}
+	if n > 0 && len(children) == 0 {
+		return nil, io.EOF
+	}
+	idx := d.c.fsEntries()
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, name := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(d.c.fsStat(name, idx[name])))
+	}
+	d.next += len(children)
+	return entries, nil
+}
+
+// dirStat implements fs.FileInfo for a directory implied by the names of
+// members.
+type dirStat string
+
+func (s dirStat) Name() string       { return string(s) }
+func (s dirStat) Size() int64        { return 0 }
+func (s dirStat) Mode() fs.FileMode  { return fs.ModeDir | 0755 }
+func (s dirStat) ModTime() time.Time { return time.Time{} }
+func (s dirStat) IsDir() bool        { return true }
+func (s dirStat) Sys() interface{}   { return nil }
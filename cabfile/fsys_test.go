@@ -0,0 +1,120 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFS(t *testing.T) {
+	files := []testFile{
+		{`dir\sub\a.txt`, []byte("hello")},
+		{`dir\b.txt`, []byte("world!")},
+		{"c.txt", []byte("top")},
+		{"c.txt", []byte("duplicate")},
+		{`..\escape.txt`, []byte("invalid")},
+	}
+	modified := time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)
+	data := writeCabinetData(t, files, WithReproducible(modified))
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+
+	if err := fstest.TestFS(cab, "dir/sub/a.txt", "dir/b.txt", "c.txt"); err != nil {
+		t.Fatalf("TestFS() failed: %v", err)
+	}
+
+	for name, want := range map[string]string{"dir/sub/a.txt": "hello", "dir/b.txt": "world!", "c.txt": "top"} {
+		got, err := fs.ReadFile(cab, name)
+		if err != nil {
+			t.Errorf("ReadFile(%q) failed: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("ReadFile(%q) = %q; want %q", name, got, want)
+		}
+	}
+
+	fi, err := fs.Stat(cab, "dir/sub/a.txt")
+	if err != nil {
+		t.Fatalf("Stat() failed: %v", err)
+	}
+	if fi.Name() != "a.txt" || fi.Size() != 5 || !fi.ModTime().Equal(modified) {
+		t.Errorf("Stat() = %q, %d bytes, modified %v; want a.txt, 5 bytes, modified %v", fi.Name(), fi.Size(), fi.ModTime(), modified)
+	}
+	if fi, err := fs.Stat(cab, "dir"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat(dir) = %v, %v; want directory", fi, err)
+	}
+
+	var walked []string
+	if err := fs.WalkDir(cab, ".", func(name string, d fs.DirEntry, err error) error {
+		walked = append(walked, name)
+		return err
+	}); err != nil {
+		t.Fatalf("WalkDir() failed: %v", err)
+	}
+	want := []string{".", "c.txt", "dir", "dir/b.txt", "dir/sub", "dir/sub/a.txt"}
+	if len(walked) != len(want) {
+		t.Fatalf("WalkDir() visited %q; want %q", walked, want)
+	}
+	for i := range want {
+		if walked[i] != want[i] {
+			t.Errorf("WalkDir() visited %q; want %q", walked, want)
+			break
+		}
+	}
+
+	for name, wantErr := range map[string]error{"missing": fs.ErrNotExist, "../escape.txt": fs.ErrInvalid, `dir\b.txt`: fs.ErrNotExist} {
+		if _, err := cab.Open(name); !errors.Is(err, wantErr) {
+			t.Errorf("Open(%q) = %v; want %v", name, err, wantErr)
+		}
+	}
+}
+
+func TestFSConcurrent(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionMSZIP, 256, files)
+	cab, err := NewReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewReaderAt() failed: %v", err)
+	}
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			for _, f := range files {
+				if _, err := fs.Stat(cab, f.name); err != nil {
+					errs <- err
+					return
+				}
+				got, err := fs.ReadFile(cab, f.name)
+				if err != nil || !bytes.Equal(got, f.data) {
+					errs <- fmt.Errorf("ReadFile(%q) = %q, %v; want %q", f.name, got, err, f.data)
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
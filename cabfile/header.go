@@ -0,0 +1,89 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+// CabinetHeader holds the fields of the CFHEADER structure of a Cabinet file.
+type CabinetHeader struct {
+	VersionMajor uint8
+	VersionMinor uint8
+	Size         uint32 // cbCabinet, the size of the Cabinet file in bytes
+	FilesOffset  uint32 // coffFiles, the offset of the first CFFILE entry
+	Folders      uint16 // cFolders, the number of CFFOLDER entries
+	Files        uint16 // cFiles, the number of CFFILE entries
+	Flags        uint16
+	SetID        uint16
+	CabinetIndex uint16 // iCabinet, the index within a multi-part set
+
+	// Sizes of the reserve areas of the header, folders and data blocks.
+	HeaderReserve uint16
+	FolderReserve uint8
+	DataReserve   uint8
+
+	// Fields reserved by the format, which are expected to be zero.
+	Reserved1 uint32
+	Reserved2 uint32
+	Reserved3 uint32
+
+	// Names of the neighboring Cabinet files of a multi-part set and of
+	// the disks holding them, if any.
+	PrevCabinet string
+	PrevDisk    string
+	NextCabinet string
+	NextDisk    string
+}
+
+// AllowUnknownVersion accepts Cabinet files of versions other than 1.3,
+// assuming their layout is the same. The version is reported by Header.
+func AllowUnknownVersion() Option {
+	return func(c *Cabinet) {
+		c.anyVersion = true
+	}
+}
+
+// Header returns the fields of the header of the Cabinet file.
+func (c *Cabinet) Header() CabinetHeader {
+	h := c.hdr
+	return CabinetHeader{
+		VersionMajor:  h.VersionMajor,
+		VersionMinor:  h.VersionMinor,
+		Size:          h.CBCabinet,
+		FilesOffset:   h.COFFFiles,
+		Folders:       h.CFolders,
+		Files:         h.CFiles,
+		Flags:         h.Flags,
+		SetID:         h.SetID,
+		CabinetIndex:  h.ICabinet,
+		HeaderReserve: h.CBCFHeader,
+		FolderReserve: h.CBCFFolder,
+		DataReserve:   h.CBCFData,
+		Reserved1:     h.Reserved1,
+		Reserved2:     h.Reserved2,
+		Reserved3:     h.Reserved3,
+		PrevCabinet:   h.CabinetPrev,
+		PrevDisk:      h.DiskPrev,
+		NextCabinet:   h.CabinetNext,
+		NextDisk:      h.DiskNext,
+	}
+}
+
+// HeaderReserve returns a copy of the reserve area of the header, which
+// applications use for data such as code signatures. It is nil unless the
+// header declares a reserve area.
+func (c *Cabinet) HeaderReserve() []byte {
+	if len(c.hdr.Reserve) == 0 {
+		return nil
+	}
+	return append([]byte(nil), c.hdr.Reserve...)
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionNone, 256, files)
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	want := CabinetHeader{
+		VersionMajor: 1,
+		VersionMinor: 3,
+		Size:         uint32(len(data)),
+		FilesOffset:  36 + 8,
+		Folders:      1,
+		Files:        3,
+	}
+	if got := cab.Header(); got != want {
+		t.Errorf("Header() = %+v; want %+v", got, want)
+	}
+
+	// Garbage in a reserved field is only rejected in strict mode.
+	data[4] = 0xff
+	if cab, err = New(bytes.NewReader(data)); err != nil {
+		t.Fatalf("New() with nonzero reserved1 failed: %v", err)
+	}
+	if got := cab.Header().Reserved1; got != 0xff {
+		t.Errorf("Header().Reserved1 = %#x; want 0xff", got)
+	}
+	if _, err := New(bytes.NewReader(data), Strict()); err == nil {
+		t.Error("New() with Strict() and nonzero reserved1 succeeded; want error")
+	}
+	data[4] = 0
+
+	// Version 1.4.
+	data[24] = 4
+	if _, err := New(bytes.NewReader(data)); err == nil {
+		t.Error("New() of version 1.4 succeeded; want error")
+	}
+	if cab, err = New(bytes.NewReader(data), AllowUnknownVersion()); err != nil {
+		t.Fatalf("New() with AllowUnknownVersion() failed: %v", err)
+	}
+	if h := cab.Header(); h.VersionMajor != 1 || h.VersionMinor != 4 {
+		t.Errorf("Header() has version %d.%d; want 1.4", h.VersionMajor, h.VersionMinor)
+	}
+	r, err := cab.Content("c.txt")
+	if err != nil {
+		t.Fatalf("Content() of version 1.4 failed: %v", err)
+	}
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, files[2].data) {
+		t.Errorf("Content() of version 1.4 = %q; want %q", got, files[2].data)
+	}
+}
+
+func TestHeaderReserve(t *testing.T) {
+	files := testFiles()
+	data := writeCabinetData(t, files, WithReserve(6, 0, 0))
+	// The reserve area follows the header and the fields sizing the
+	// reserve areas.
+	reserve := []byte("abcdef")
+	copy(data[cfHeaderSize+4:], reserve)
+
+	cab := checkCabinet(t, bytes.NewReader(data), files)
+	if got := cab.HeaderReserve(); !bytes.Equal(got, reserve) {
+		t.Errorf("HeaderReserve() = %q; want %q", got, reserve)
+	}
+	cab.HeaderReserve()[0] = 'x'
+	if got := cab.HeaderReserve(); !bytes.Equal(got, reserve) {
+		t.Errorf("HeaderReserve() after modifying its result = %q; want %q", got, reserve)
+	}
+
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionNone, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if got := cab.HeaderReserve(); got != nil {
+		t.Errorf("HeaderReserve() without reserve area = %q; want nil", got)
+	}
+}
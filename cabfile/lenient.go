@@ -0,0 +1,81 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Lenient reads Cabinet files which are incomplete or inconsistent, for
+// example because they were only partially downloaded. Folders and files
+// declared in the header but missing from the Cabinet file are ignored, as
+// are files referring to missing folders, and a truncated last data block
+// yields the data it still holds, cutting short the content of the
+// affected members. The problems tolerated are reported by Warnings.
+func Lenient() Option {
+	return func(c *Cabinet) {
+		c.lenient = true
+	}
+}
+
+// Warnings returns the problems tolerated so far when reading a Cabinet
+// file opened with the Lenient option.
+func (c *Cabinet) Warnings() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]error(nil), c.warnings...)
+}
+
+func (c *Cabinet) warn(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, err)
+}
+
+// warner returns a function recording warnings for a folderReader, or nil if
+// not in lenient mode.
+func (c *Cabinet) warner() func(err error) {
+	if !c.lenient {
+		return nil
+	}
+	return c.warn
+}
+
+// presentFiles returns the files referring to one of the n folders present,
+// or continuing folders of other Cabinet files, warning about the others.
+func (c *Cabinet) presentFiles(files []*file, n int) []*file {
+	var present []*file
+	for _, f := range files {
+		if int(f.IFolder) >= n && f.IFolder < ifoldContinuedFromPrev {
+			c.warn(fmt.Errorf("file %q refers to missing folder %d", f.name, f.IFolder))
+			continue
+		}
+		present = append(present, f)
+	}
+	return present
+}
+
+// partial reports whether err, encountered after reading n bytes of the
+// content of f, ends the data of a truncated folder in lenient mode, in
+// which case a warning is recorded.
+func (c *Cabinet) partial(f *file, n int, err error) bool {
+	if !c.lenient || !(errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return false
+	}
+	c.warn(fmt.Errorf("content of file %q is truncated to %d of %d bytes", f.name, n, f.CBFile))
+	return true
+}
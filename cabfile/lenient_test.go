@@ -0,0 +1,99 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestLenient(t *testing.T) {
+	files := testFiles()
+	data := writeCabinetData(t, files)
+	c := parseRaw(t, data)
+
+	t.Run("counts", func(t *testing.T) {
+		// Cut the data, so that the declared files exceed the Cabinet file.
+		data := append([]byte(nil), data[:c.fldrs[0].COFFCabStart]...)
+		binary.LittleEndian.PutUint16(data[28:], uint16(len(files)+1))
+		if _, err := New(bytes.NewReader(data)); err == nil {
+			t.Error("New() with too many files succeeded; want error")
+		}
+		cab, err := New(bytes.NewReader(data), Lenient())
+		if err != nil {
+			t.Fatalf("New() with Lenient() failed: %v", err)
+		}
+		if got, want := cab.FileList(), []string{"a.txt", "b.bin", "c.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("FileList() = %q; want %q", got, want)
+		}
+		if len(cab.Warnings()) != 1 {
+			t.Errorf("Warnings() = %v; want 1 warning", cab.Warnings())
+		}
+	})
+
+	t.Run("folder", func(t *testing.T) {
+		data := append([]byte(nil), data...)
+		// Point the first file to a missing folder.
+		binary.LittleEndian.PutUint16(data[c.hdr.COFFFiles+8:], 1)
+		cab, err := New(bytes.NewReader(data), Lenient())
+		if err != nil {
+			t.Fatalf("New() with Lenient() failed: %v", err)
+		}
+		if got, want := cab.FileList(), []string{"b.bin", "c.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("FileList() = %q; want %q", got, want)
+		}
+		if len(cab.Warnings()) != 1 {
+			t.Errorf("Warnings() = %v; want 1 warning", cab.Warnings())
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		// Cut the end of the second file and the entire third file.
+		data := data[:len(data)-100]
+		cab, err := New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		if _, err := cab.Content("b.bin"); err == nil {
+			t.Error("Content() of a truncated file succeeded; want error")
+		}
+		if cab, err = New(bytes.NewReader(data), Lenient()); err != nil {
+			t.Fatalf("New() with Lenient() failed: %v", err)
+		}
+		for _, f := range files {
+			r, err := cab.Content(f.name)
+			if err != nil {
+				t.Fatalf("Content(%q) failed: %v", f.name, err)
+			}
+			got, _ := io.ReadAll(r)
+			want := f.data
+			switch f.name {
+			case "b.bin":
+				want = want[:len(want)-96]
+			case "c.txt":
+				want = nil
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Content(%q) = %d bytes; want %d bytes", f.name, len(got), len(want))
+			}
+		}
+		if len(cab.Warnings()) == 0 {
+			t.Error("Warnings() = []; want warnings about the truncated data")
+		}
+	})
+}
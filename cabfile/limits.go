@@ -0,0 +1,84 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrSizeLimitExceeded is returned when reading data would exceed one of the
+// size limits set using WithLimits.
+var ErrSizeLimitExceeded = errors.New("cabfile: size limit exceeded")
+
+// Limits caps the resources spent on reading a Cabinet file, protecting
+// against hostile header fields. A zero field imposes no limit.
+type Limits struct {
+	MaxFiles        int   // number of files in the Cabinet file
+	MaxFolders      int   // number of folders in the Cabinet file
+	MaxBlockSize    int   // compressed or uncompressed size of a data block
+	MaxDecompressed int64 // uncompressed bytes of all data blocks read in total
+	MaxFileSize     int64 // size of the content of a member
+	MaxFolderSize   int64 // uncompressed size of a folder
+}
+
+// WithLimits enforces the limits while parsing the Cabinet file and reading
+// the data of its folders. MaxDecompressed caps the running total of all
+// reads from the Cabinet file, or from all Cabinet files of a CabinetSet,
+// rather than each read of a folder. Errors due to a size limit wrap
+// ErrSizeLimitExceeded, and are returned before the data is allocated.
+func WithLimits(l Limits) Option {
+	return func(c *Cabinet) {
+		c.limits = l
+	}
+}
+
+// checkHeader validates the counts of the header against the limits.
+func (l *Limits) checkHeader(hdr *cfHeader) error {
+	if l.MaxFiles > 0 && int(hdr.CFiles) > l.MaxFiles {
+		return fmt.Errorf("cFiles %d exceeds the limit of %d files", hdr.CFiles, l.MaxFiles)
+	}
+	if l.MaxFolders > 0 && int(hdr.CFolders) > l.MaxFolders {
+		return fmt.Errorf("cFolders %d exceeds the limit of %d folders", hdr.CFolders, l.MaxFolders)
+	}
+	return nil
+}
+
+// checkLimits validates the header of the data block with index i against
+// the limits, before any of its data is read.
+func (fr *folderReader) checkLimits(i uint16, d *cfData) error {
+	l := &fr.limits
+	if l.MaxBlockSize > 0 && (int(d.CBData) > l.MaxBlockSize || int(d.CBUncomp) > l.MaxBlockSize) {
+		return fmt.Errorf("size %d, %d of data block %d exceeds the limit of %d bytes: %w", d.CBData, d.CBUncomp, i, l.MaxBlockSize, ErrSizeLimitExceeded)
+	}
+	if l.MaxFolderSize > 0 && fr.off+int64(d.CBUncomp) > l.MaxFolderSize {
+		return fmt.Errorf("data block %d exceeds the limit of %d bytes of folder %d: %w", i, l.MaxFolderSize, fr.idx, ErrSizeLimitExceeded)
+	}
+	total := atomic.AddInt64(fr.decompressed, int64(d.CBUncomp))
+	if l.MaxDecompressed > 0 && total > l.MaxDecompressed {
+		return fmt.Errorf("data block %d exceeds the limit of %d uncompressed bytes: %w", i, l.MaxDecompressed, ErrSizeLimitExceeded)
+	}
+	return nil
+}
+
+// checkFile validates the size of a member against the limits, before its
+// content is allocated.
+func (l *Limits) checkFile(f *file) error {
+	if l.MaxFileSize > 0 && int64(f.CBFile) > l.MaxFileSize {
+		return fmt.Errorf("size %d of file %q exceeds the limit of %d bytes: %w", f.CBFile, f.name, l.MaxFileSize, ErrSizeLimitExceeded)
+	}
+	return nil
+}
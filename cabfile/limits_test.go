@@ -0,0 +1,107 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionMSZIP, 256, files)
+	for _, tc := range []struct {
+		name    string
+		limits  Limits
+		newErr  bool
+		readErr bool
+	}{
+		{"none", Limits{}, false, false},
+		{"sufficient", Limits{MaxFiles: 3, MaxFolders: 1, MaxBlockSize: 256, MaxDecompressed: 10000}, false, false},
+		{"files", Limits{MaxFiles: 2}, true, false},
+		{"block", Limits{MaxBlockSize: 255}, false, true},
+		{"decompressed", Limits{MaxDecompressed: 1000}, false, true},
+		{"file", Limits{MaxFileSize: 799}, false, true},
+		{"folder", Limits{MaxFolderSize: 1400}, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cab, err := New(bytes.NewReader(data), WithLimits(tc.limits))
+			if (err != nil) != tc.newErr {
+				t.Fatalf("New() = %v; want error %t", err, tc.newErr)
+			}
+			if err != nil {
+				return
+			}
+			// Every member decompresses its folder from the start, which
+			// adds up to more than 1000 bytes.
+			var readErr error
+			for _, f := range files {
+				if _, err := cab.Content(f.name); err != nil {
+					readErr = err
+				}
+			}
+			if (readErr != nil) != tc.readErr || (readErr != nil && !errors.Is(readErr, ErrSizeLimitExceeded)) {
+				t.Errorf("Content() = %v; want ErrSizeLimitExceeded %t", readErr, tc.readErr)
+			}
+		})
+	}
+
+	data = writeCabinetData(t, files, WithFolderPerFile())
+	if _, err := New(bytes.NewReader(data), WithLimits(Limits{MaxFolders: 2})); err == nil {
+		t.Error("New() exceeding the folder limit succeeded; want error")
+	}
+}
+
+func TestLimitsDecompressedTotal(t *testing.T) {
+	files := []testFile{{"a.bin", make([]byte, 600)}, {"b.bin", make([]byte, 600)}}
+	data := writeCabinetData(t, files, WithFolderPerFile())
+	cab, err := New(bytes.NewReader(data), WithLimits(Limits{MaxDecompressed: 1000}))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	// Each folder is within the limit, but not both of them.
+	if _, err := cab.Content("a.bin"); err != nil {
+		t.Fatalf("Content() of the first folder failed: %v", err)
+	}
+	if _, err := cab.Content("b.bin"); !errors.Is(err, ErrSizeLimitExceeded) {
+		t.Errorf("Content() of the second folder = %v; want ErrSizeLimitExceeded", err)
+	}
+
+	// The limit applies to all Cabinet files of a set together.
+	var setFiles []testFile
+	for i := 0; i < 6; i++ {
+		setFiles = append(setFiles, testFile{fmt.Sprintf("file%d.bin", i), make([]byte, 5000)})
+	}
+	cabs, names := writeSet(t, 12000, setFiles, WithFolderPerFile())
+	s, err := NewCabinetSet(bytes.NewReader(cabs[names[0]]), func(name string) (io.ReadSeeker, error) {
+		return bytes.NewReader(cabs[name]), nil
+	}, WithLimits(Limits{MaxDecompressed: 12000}))
+	if err != nil {
+		t.Fatalf("NewCabinetSet() failed: %v", err)
+	}
+	var readErr error
+	for _, f := range setFiles {
+		if _, err := s.Content(f.name); err != nil {
+			readErr = err
+			break
+		}
+	}
+	if !errors.Is(readErr, ErrSizeLimitExceeded) {
+		t.Errorf("Content() of all members of the set = %v; want ErrSizeLimitExceeded", readErr)
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// IgnoreCase matches the names of members case-insensitively when looking
+// them up by name, as Windows does when extracting Cabinet files. A member
+// whose name matches exactly takes precedence, otherwise the first member
+// in the order of FileList whose name matches under Unicode case folding is
+// chosen.
+func IgnoreCase() Option {
+	return func(c *Cabinet) {
+		c.ignoreCase = true
+	}
+}
+
+// nameMatcher finds the member of a name among candidates presented in the
+// order of FileList, tracking the best match found so far.
+type nameMatcher struct {
+	name       string
+	ignoreCase bool
+	fold       *file // first member matching case-insensitively
+}
+
+// match reports whether f matches the name exactly, which ends the search.
+func (m *nameMatcher) match(f *file) bool {
+	if f.name == m.name {
+		return true
+	}
+	if m.ignoreCase && m.fold == nil && strings.EqualFold(f.name, m.name) {
+		m.fold = f
+	}
+	return false
+}
+
+// lookup returns the member of the given name according to the IgnoreCase
+// option, or nil.
+func (c *Cabinet) lookup(name string) *file {
+	if i := c.lookupIndex(name); i >= 0 {
+		return c.files[i]
+	}
+	return nil
+}
+
+// lookupIndex returns the index of the member of the given name according to
+// the IgnoreCase option, or -1.
+func (c *Cabinet) lookupIndex(name string) int {
+	m := nameMatcher{name: name, ignoreCase: c.ignoreCase}
+	fold := -1
+	for i, f := range c.files {
+		if m.match(f) {
+			return i
+		}
+		if fold < 0 && m.fold != nil {
+			fold = i
+		}
+	}
+	return fold
+}
+
+// Lookup returns the indices in FileList of all members of the given name,
+// in the order of FileList. A Cabinet file may hold several members of the
+// same name, of which Content only returns the first. With IgnoreCase,
+// members matching case-insensitively are included.
+func (c *Cabinet) Lookup(name string) []int {
+	var idx []int
+	for i, f := range c.files {
+		if f.name == name || c.ignoreCase && strings.EqualFold(f.name, name) {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// ContentIndex returns the content of the member with the given index in
+// FileList, like Content.
+func (c *Cabinet) ContentIndex(i int) (io.Reader, error) {
+	if i < 0 || i >= len(c.files) {
+		return nil, fmt.Errorf("member index %d out of range [0, %d)", i, len(c.files))
+	}
+	return c.content(c.files[i])
+}
+
+// Glob returns the names of the members matching the pattern, in the order
+// of FileList. As in Windows, '*' matches any sequence of characters and '?'
+// any single character, including backslashes. With IgnoreCase, names are
+// matched case-insensitively.
+func (c *Cabinet) Glob(pattern string) []string {
+	var names []string
+	for _, f := range c.files {
+		if c.globMatch(pattern, f.name) {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// ContentGlob calls fn with the name and content of every member matching
+// the pattern, as with Glob, stopping at the first error, which is
+// returned. The members are visited folder by folder in the order of their
+// content, which is the order of FileList unless the Cabinet file was
+// written unusually, so that every folder is decompressed only once. As with
+// Next, the content is streamed and only valid until fn returns.
+func (c *Cabinet) ContentGlob(pattern string, fn func(name string, r io.Reader) error) error {
+	var matches []*file
+	for _, f := range c.files {
+		if c.globMatch(pattern, f.name) {
+			matches = append(matches, f)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.IFolder != b.IFolder {
+			return a.IFolder < b.IFolder
+		}
+		return a.UOffFolderStart < b.UOffFolderStart
+	})
+	mr := newMemberReader(c)
+	for _, f := range matches {
+		if err := c.limits.checkFile(f); err != nil {
+			return err
+		}
+		r, err := mr.open(int(f.IFolder), f)
+		if err != nil {
+			return fmt.Errorf("could not read %q: %w", f.name, err)
+		}
+		if err := fn(f.name, &entryReader{r: r, left: int64(f.CBFile)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// globMatch reports whether name matches the wildcard pattern, under Unicode
+// case folding as by strings.EqualFold with the IgnoreCase option.
+func (c *Cabinet) globMatch(pattern, name string) bool {
+	p, n := []rune(pattern), []rune(name)
+	// On a mismatch, the last '*' consumes one more character of the name.
+	i, j := 0, 0
+	star, next := -1, 0
+	for j < len(n) {
+		switch {
+		case i < len(p) && p[i] == '*':
+			star, next = i, j
+			i++
+		case i < len(p) && (p[i] == '?' || equalRune(p[i], n[j], c.ignoreCase)):
+			i, j = i+1, j+1
+		case star >= 0:
+			next++
+			i, j = star+1, next
+		default:
+			return false
+		}
+	}
+	for i < len(p) && p[i] == '*' {
+		i++
+	}
+	return i == len(p)
+}
+
+// equalRune reports whether the runes a and b are equal, or equal under
+// Unicode simple case folding if fold is set.
+func equalRune(a, b rune, fold bool) bool {
+	if a == b {
+		return true
+	}
+	if !fold {
+		return false
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
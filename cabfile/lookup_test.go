@@ -0,0 +1,246 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// checkLookup verifies the member whose content content returns for name,
+// identified by its content, or that it reports ErrFileNotFound if want is
+// empty.
+func checkLookup(t *testing.T, content func(string) (io.Reader, error), name, want string) {
+	t.Helper()
+	r, err := content(name)
+	if want == "" {
+		if !errors.Is(err, ErrFileNotFound) {
+			t.Errorf("Content(%q) = %v; want ErrFileNotFound", name, err)
+		}
+		return
+	}
+	if err != nil {
+		t.Errorf("Content(%q) failed: %v", name, err)
+		return
+	}
+	if got, _ := io.ReadAll(r); string(got) != want {
+		t.Errorf("Content(%q) = %q; want %q", name, got, want)
+	}
+}
+
+func TestIgnoreCase(t *testing.T) {
+	files := []testFile{
+		{"setup.inf", []byte("1")},
+		{"Readme.TXT", []byte("2")},
+		{"README.txt", []byte("3")},
+		{"straße.txt", []byte("4")},
+	}
+	data := buildCabinet(t, CompressionNone, 256, files)
+	for _, tc := range []struct {
+		name       string
+		want       string
+		wantIgnore string
+	}{
+		{"setup.inf", "1", "1"},
+		{"SETUP.INF", "", "1"},
+		{"readme.txt", "", "2"},
+		{"README.txt", "3", "3"},
+		{"STRASSE.TXT", "", ""},
+		{"STRAßE.TXT", "", "4"},
+		{"missing", "", ""},
+	} {
+		cab, err := New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		checkLookup(t, cab.Content, tc.name, tc.want)
+		cab, err = New(bytes.NewReader(data), IgnoreCase())
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		checkLookup(t, cab.Content, tc.name, tc.wantIgnore)
+		if got := cab.Exists(tc.name); got != (tc.wantIgnore != "") {
+			t.Errorf("Exists(%q) with IgnoreCase = %t; want %t", tc.name, got, !got)
+		}
+	}
+}
+
+func TestCabinetSetIgnoreCase(t *testing.T) {
+	files := []testFile{
+		{"first.txt", []byte("first")},
+		{"large.bin", make([]byte, 3*maxBlockSize)},
+		{"First.TXT", []byte("second")},
+		{"LAST.txt", []byte("last")},
+	}
+	cabs, names := writeSet(t, 2*maxBlockSize, files)
+	if len(names) < 2 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want at least 2", len(names))
+	}
+	s, err := NewLazyCabinetSet(bytes.NewReader(cabs[names[0]]), func(name string) (io.ReadSeeker, error) {
+		return bytes.NewReader(cabs[name]), nil
+	}, IgnoreCase())
+	if err != nil {
+		t.Fatalf("NewLazyCabinetSet() failed: %v", err)
+	}
+	checkLookup(t, s.Content, "First.TXT", "second")
+	checkLookup(t, s.Content, "FIRST.txt", "first")
+	checkLookup(t, s.Content, "last.txt", "last")
+	checkLookup(t, s.Content, "missing", "")
+}
+
+func TestDuplicateNames(t *testing.T) {
+	files := []testFile{
+		{"dup.txt", []byte("1")},
+		{"other.txt", []byte("2")},
+		{"dup.txt", []byte("3")},
+		{"DUP.txt", []byte("4")},
+	}
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionNone, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	checkLookup(t, cab.Content, "dup.txt", "1")
+	idx := cab.Lookup("dup.txt")
+	if !reflect.DeepEqual(idx, []int{0, 2}) {
+		t.Fatalf("Lookup() = %v; want [0 2]", idx)
+	}
+	for i, want := range []string{"1", "3"} {
+		checkLookup(t, func(string) (io.Reader, error) { return cab.ContentIndex(idx[i]) }, "dup.txt", want)
+	}
+	if _, err := cab.ContentIndex(len(files)); err == nil {
+		t.Errorf("ContentIndex(%d) succeeded; want error", len(files))
+	}
+	if got := cab.Lookup("missing"); got != nil {
+		t.Errorf("Lookup() of a missing member = %v; want nil", got)
+	}
+
+	cab, err = New(bytes.NewReader(buildCabinet(t, CompressionNone, 256, files)), IgnoreCase())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if got := cab.Lookup("Dup.TXT"); !reflect.DeepEqual(got, []int{0, 2, 3}) {
+		t.Errorf("Lookup() with IgnoreCase = %v; want [0 2 3]", got)
+	}
+}
+
+func TestGlob(t *testing.T) {
+	files := []testFile{
+		{"setup.inf", []byte("1")},
+		{`drivers\net.INF`, []byte("2")},
+		{"firmware.metainfo.xml", []byte("3")},
+		{"firmware.bin", []byte("4")},
+	}
+	data := buildCabinet(t, CompressionNone, 256, files)
+	for _, tc := range []struct {
+		pattern    string
+		want       []string
+		wantIgnore []string
+	}{
+		{"*.inf", []string{"setup.inf"}, []string{"setup.inf", `drivers\net.INF`}},
+		{"*.metainfo.xml", []string{"firmware.metainfo.xml"}, []string{"firmware.metainfo.xml"}},
+		{"firmware.*", []string{"firmware.metainfo.xml", "firmware.bin"}, []string{"firmware.metainfo.xml", "firmware.bin"}},
+		{"?????.inf", []string{"setup.inf"}, []string{"setup.inf"}},
+		{`drivers\*`, []string{`drivers\net.INF`}, []string{`drivers\net.INF`}},
+		{"*i*e*.*", []string{`drivers\net.INF`, "firmware.metainfo.xml", "firmware.bin"}, []string{`drivers\net.INF`, "firmware.metainfo.xml", "firmware.bin"}},
+		{"*", []string{"setup.inf", `drivers\net.INF`, "firmware.metainfo.xml", "firmware.bin"}, []string{"setup.inf", `drivers\net.INF`, "firmware.metainfo.xml", "firmware.bin"}},
+		{"SETUP.INF", nil, []string{"setup.inf"}},
+		{"\u017fetup.*", nil, []string{"setup.inf"}}, // long s, as by strings.EqualFold
+		{"*.cab", nil, nil},
+	} {
+		cab, err := New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		if got := cab.Glob(tc.pattern); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Glob(%q) = %q; want %q", tc.pattern, got, tc.want)
+		}
+		if cab, err = New(bytes.NewReader(data), IgnoreCase()); err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		if got := cab.Glob(tc.pattern); !reflect.DeepEqual(got, tc.wantIgnore) {
+			t.Errorf("Glob(%q) with IgnoreCase = %q; want %q", tc.pattern, got, tc.wantIgnore)
+		}
+	}
+
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	var got []string
+	err = cab.ContentGlob("firmware.*", func(name string, r io.Reader) error {
+		data, err := io.ReadAll(r)
+		got = append(got, name+"="+string(data))
+		return err
+	})
+	if want := []string{"firmware.metainfo.xml=3", "firmware.bin=4"}; err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("ContentGlob() returned %q, %v; want %q, nil", got, err, want)
+	}
+	stop := errors.New("stop")
+	if err := cab.ContentGlob("*", func(string, io.Reader) error { return stop }); err != stop {
+		t.Errorf("ContentGlob() = %v; want the error of the callback", err)
+	}
+}
+
+// countingReader counts the bytes read from a Cabinet file.
+type countingReader struct {
+	*bytes.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func TestContentGlobSinglePass(t *testing.T) {
+	var files []testFile
+	for i := 0; i < 20; i++ {
+		data := make([]byte, 10000)
+		rand.New(rand.NewSource(int64(i))).Read(data)
+		files = append(files, testFile{fmt.Sprintf("file%02d.bin", i), data})
+	}
+	data := writeCabinetData(t, files, WithCompression(CompressionMSZIP))
+	r := &countingReader{Reader: bytes.NewReader(data)}
+	cab, err := New(r)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	r.n = 0
+	var i int
+	err = cab.ContentGlob("*.bin", func(name string, r io.Reader) error {
+		got, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if name != files[i].name || !bytes.Equal(got, files[i].data) {
+			t.Errorf("ContentGlob() visited %q with %d bytes; want %q", name, len(got), files[i].name)
+		}
+		i++
+		return nil
+	})
+	if err != nil || i != len(files) {
+		t.Fatalf("ContentGlob() visited %d members, %v; want %d, nil", i, err, len(files))
+	}
+	// Decompressing the folder once reads less than the entire file.
+	if r.n > int64(len(data)) {
+		t.Errorf("ContentGlob() read %d bytes of the %d byte Cabinet file", r.n, len(data))
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import "time"
+
+// Manifest describes the structures of a Cabinet file using only plain
+// values, so that it can be encoded, for example as JSON, to record what a
+// Cabinet file holds.
+type Manifest struct {
+	Header  CabinetHeader
+	Folders []ManifestFolder
+	Files   []ManifestFile
+}
+
+// ManifestFolder describes a folder of a Cabinet file.
+type ManifestFolder struct {
+	Compression string // as formatted by Compression.String, such as "LZX:21"
+	Blocks      int
+	DataOffset  int64
+}
+
+// ManifestFile describes a member of a Cabinet file.
+type ManifestFile struct {
+	Name         string
+	Size         int64
+	Modified     time.Time
+	Attributes   Attributes
+	Folder       int
+	FolderOffset int64
+}
+
+// Manifest returns a description of the header, the folders and the members
+// of the Cabinet file, in the order they are stored. Nothing is
+// decompressed.
+func (c *Cabinet) Manifest() *Manifest {
+	m := &Manifest{
+		Header:  c.Header(),
+		Folders: []ManifestFolder{},
+		Files:   []ManifestFile{},
+	}
+	for _, fi := range c.Folders() {
+		m.Folders = append(m.Folders, ManifestFolder{
+			Compression: fi.Compression.String(),
+			Blocks:      fi.Blocks,
+			DataOffset:  fi.DataOffset,
+		})
+	}
+	for _, fi := range c.Files() {
+		m.Files = append(m.Files, ManifestFile{
+			Name:         fi.Name,
+			Size:         fi.Size,
+			Modified:     fi.Modified,
+			Attributes:   fi.Attributes,
+			Folder:       fi.Folder,
+			FolderOffset: fi.FolderOffset,
+		})
+	}
+	return m
+}
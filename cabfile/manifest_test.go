@@ -0,0 +1,52 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManifest(t *testing.T) {
+	files := []testFile{{`dir\a.txt`, []byte("hello")}, {"b.txt", []byte("world!")}}
+	modified := time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)
+	cab := writeCabinet(t, files, WithCompression(CompressionMSZIP), WithReproducible(modified))
+	m := cab.Manifest()
+	want := &Manifest{
+		Header:  cab.Header(),
+		Folders: []ManifestFolder{{Compression: "MSZIP", Blocks: 1, DataOffset: 92}},
+		Files: []ManifestFile{
+			{Name: `dir\a.txt`, Size: 5, Modified: modified, Attributes: AttrArchive, Folder: 0, FolderOffset: 0},
+			{Name: "b.txt", Size: 6, Modified: modified, Attributes: AttrArchive, Folder: 0, FolderOffset: 5},
+		},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Manifest() = %+v; want %+v", m, want)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	var got Manifest
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if !reflect.DeepEqual(&got, want) {
+		t.Errorf("Manifest decoded from %s = %+v; want %+v", data, got, want)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"fmt"
+	"io"
+	"iter"
+)
+
+// Next advances to the next member of the Cabinet file, in the order of
+// FileList, and returns its header, or io.EOF after the last member. The
+// content of the member is read using Read; unread content is skipped by the
+// following call to Next. Reading all members using Next decompresses every
+// folder only once, and other members or folders may be read in between.
+func (c *Cabinet) Next() (*FileHeader, error) {
+	c.cur = nil
+	if c.next >= len(c.files) {
+		return nil, io.EOF
+	}
+	f := c.files[c.next]
+	c.next++
+	if err := c.limits.checkFile(f); err != nil {
+		return nil, err
+	}
+	if c.mr == nil {
+		c.mr = newMemberReader(c)
+	}
+	r, err := c.mr.open(int(f.IFolder), f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read content of %q: %w", f.name, err)
+	}
+	c.cur = &entryReader{r: r, left: int64(f.CBFile)}
+	return c.fileHeader(f), nil
+}
+
+// Reset positions Next before the first member again, so that the members
+// can be iterated over once more.
+func (c *Cabinet) Reset() {
+	c.next, c.mr, c.cur = 0, nil, nil
+}
+
+// SeekIndex positions Next at the member with the given index in FileList,
+// which the following call to Next returns. The content of the members in
+// between is skipped without being handed out.
+func (c *Cabinet) SeekIndex(i int) error {
+	if i < 0 || i > len(c.files) {
+		return fmt.Errorf("member index %d out of range [0, %d]", i, len(c.files))
+	}
+	c.next, c.cur = i, nil
+	return nil
+}
+
+// SeekName positions Next at the member of the given name, found as by
+// Content, which the following call to Next returns.
+func (c *Cabinet) SeekName(name string) error {
+	i := c.lookupIndex(name)
+	if i < 0 {
+		return fmt.Errorf("could not find %q: %w", name, ErrFileNotFound)
+	}
+	return c.SeekIndex(i)
+}
+
+// All returns an iterator over the headers and the content of the members of
+// the Cabinet file, in the order of FileList, which decompresses every folder
+// only once. The content is only valid during its iteration. Errors reading
+// a member are returned by its reader. The iteration is independent of Next.
+func (c *Cabinet) All() iter.Seq2[*FileHeader, io.Reader] {
+	return func(yield func(*FileHeader, io.Reader) bool) {
+		mr := newMemberReader(c)
+		for _, f := range c.files {
+			var r io.Reader
+			if err := c.limits.checkFile(f); err != nil {
+				r = errReader{err}
+			} else if data, err := mr.open(int(f.IFolder), f); err != nil {
+				r = errReader{fmt.Errorf("could not read content of %q: %w", f.name, err)}
+			} else {
+				r = &entryReader{r: data, left: int64(f.CBFile)}
+			}
+			if !yield(c.fileHeader(f), r) {
+				return
+			}
+		}
+	}
+}
+
+// Walk calls fn with the header and the content of every member of the
+// Cabinet file, in the order of FileList, decompressing every folder only
+// once. The content is only valid during the call. Walk stops at the first
+// error reading a member or returned by fn, which it returns.
+func (c *Cabinet) Walk(fn func(hdr *FileHeader, r io.Reader) error) error {
+	mr := newMemberReader(c)
+	for _, f := range c.files {
+		if err := c.limits.checkFile(f); err != nil {
+			return err
+		}
+		data, err := mr.open(int(f.IFolder), f)
+		if err != nil {
+			return fmt.Errorf("could not read content of %q: %w", f.name, err)
+		}
+		if err := fn(c.fileHeader(f), &entryReader{r: data, left: int64(f.CBFile)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileHeader returns the header of the member f, which reproduces f when
+// passed to Writer.CreateHeader.
+func (c *Cabinet) fileHeader(f *file) *FileHeader {
+	fi := c.fileInfo(f)
+	return fi.Header()
+}
+
+// errReader fails every read with err.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// Read reads from the content of the current member returned by Next. It
+// returns io.EOF at the end of the content, as well as before the first
+// call to Next and once Next returned io.EOF. Content ending prematurely is
+// reported as io.ErrUnexpectedEOF.
+func (c *Cabinet) Read(p []byte) (int, error) {
+	if c.cur == nil {
+		return 0, io.EOF
+	}
+	return c.cur.Read(p)
+}
+
+// entryReader reads the content of the current member of Next.
+type entryReader struct {
+	r    io.Reader
+	left int64 // bytes of the content not read yet
+}
+
+func (er *entryReader) Read(p []byte) (int, error) {
+	if er.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > er.left {
+		p = p[:er.left]
+	}
+	n, err := er.r.Read(p)
+	er.left -= int64(n)
+	if err == io.EOF && er.left > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
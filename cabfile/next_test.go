@@ -0,0 +1,261 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	files := []testFile{{"big.bin", make([]byte, 3*maxBlockSize)}, {"small.txt", []byte("tiny")}, {"last.txt", []byte("last")}}
+	rand.New(rand.NewSource(1)).Read(files[0].data)
+	modified := time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)
+	data := writeCabinetData(t, files, WithCompression(CompressionMSZIP), WithReproducible(modified))
+	cab := checkCabinet(t, bytes.NewReader(data), files)
+	if n, err := cab.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read() before Next() = %d, %v; want 0, io.EOF", n, err)
+	}
+
+	// Read the first member partially, reading another member in between,
+	// and skip the second one.
+	hdr, err := cab.Next()
+	if err != nil {
+		t.Fatalf("Next() failed: %v", err)
+	}
+	if hdr.Name != "big.bin" || hdr.Size != int64(len(files[0].data)) || !hdr.Modified.Equal(modified) {
+		t.Errorf("Next() = %q, %d bytes, modified %v; want big.bin, %d bytes, modified %v", hdr.Name, hdr.Size, hdr.Modified, len(files[0].data), modified)
+	}
+	got := make([]byte, maxBlockSize+100)
+	if _, err := io.ReadFull(cab, got[:100]); err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if _, err := cab.Content("last.txt"); err != nil {
+		t.Fatalf("Content() failed: %v", err)
+	}
+	if _, err := io.ReadFull(cab, got[100:]); err != nil {
+		t.Fatalf("Read() after Content() failed: %v", err)
+	}
+	if !bytes.Equal(got, files[0].data[:len(got)]) {
+		t.Error("Read() returned content not matching big.bin")
+	}
+	if _, err := cab.Next(); err != nil {
+		t.Fatalf("Next() failed: %v", err)
+	}
+	if hdr, err = cab.Next(); err != nil || hdr.Name != "last.txt" {
+		t.Fatalf("Next() = %v, %v; want last.txt", hdr, err)
+	}
+	if data, err := io.ReadAll(cab); err != nil || !bytes.Equal(data, files[2].data) {
+		t.Errorf("Read() of last.txt = %q, %v; want %q", data, err, files[2].data)
+	}
+	if _, err := cab.Next(); err != io.EOF {
+		t.Errorf("Next() after the last member = %v; want io.EOF", err)
+	}
+	if n, err := cab.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Errorf("Read() after the last member = %d, %v; want 0, io.EOF", n, err)
+	}
+
+	// Headers returned by Next reproduce the members.
+	cab = checkCabinet(t, bytes.NewReader(data), files)
+	var out bytes.Buffer
+	cw := NewWriter(&out, WithCompression(CompressionMSZIP))
+	for {
+		hdr, err := cab.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		fw, err := cw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", hdr.Name, err)
+		}
+		if _, err := io.Copy(fw, cab); err != nil {
+			t.Fatalf("Copying %q failed: %v", hdr.Name, err)
+		}
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Error("Cabinet file written from the headers returned by Next differs from the original")
+	}
+}
+
+func TestNextTruncated(t *testing.T) {
+	files := []testFile{{"big.bin", make([]byte, 2*maxBlockSize)}}
+	data := writeCabinetData(t, files)
+	// Claim a larger size of the member than its folder holds.
+	c := parseRaw(t, data)
+	off := int(c.hdr.COFFFiles)
+	data[off]++
+	cab, err := New(bytes.NewReader(data), Lenient())
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if _, err := cab.Next(); err != nil {
+		t.Fatalf("Next() failed: %v", err)
+	}
+	if _, err := io.ReadAll(cab); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Read() of truncated content = %v; want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	files := testFiles()
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	var i int
+	for hdr, r := range cab.All() {
+		f := files[i]
+		i++
+		if hdr.Name != f.name || hdr.Size != int64(len(f.data)) {
+			t.Errorf("All() yielded %q of %d bytes; want %q of %d bytes", hdr.Name, hdr.Size, f.name, len(f.data))
+		}
+		if data, err := io.ReadAll(r); err != nil || !bytes.Equal(data, f.data) {
+			t.Errorf("Content of %q yielded by All() = %q, %v; want %q", hdr.Name, data, err, f.data)
+		}
+	}
+	if i != len(files) {
+		t.Errorf("All() yielded %d members; want %d", i, len(files))
+	}
+
+	i = 0
+	for range cab.All() {
+		i++
+		break
+	}
+	if i != 1 {
+		t.Errorf("All() yielded %d members after break; want 1", i)
+	}
+
+	cab, err = New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)), WithLimits(Limits{MaxFileSize: 100}))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	for hdr, r := range cab.All() {
+		_, err := io.ReadAll(r)
+		if tooBig := hdr.Size > 100; tooBig != errors.Is(err, ErrSizeLimitExceeded) {
+			t.Errorf("Reading %q of %d bytes with a limit of 100 bytes = %v", hdr.Name, hdr.Size, err)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	files := testFiles()
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	for pass := 0; pass < 2; pass++ {
+		for _, f := range files {
+			hdr, err := cab.Next()
+			if err != nil {
+				t.Fatalf("Next() in pass %d failed: %v", pass, err)
+			}
+			if data, err := io.ReadAll(cab); hdr.Name != f.name || err != nil || !bytes.Equal(data, f.data) {
+				t.Errorf("Next() in pass %d = %q with %q, %v; want %q with %q", pass, hdr.Name, data, err, f.name, f.data)
+			}
+		}
+		if _, err := cab.Next(); err != io.EOF {
+			t.Errorf("Next() after the last member = %v; want io.EOF", err)
+		}
+		cab.Reset()
+		if n, err := cab.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+			t.Errorf("Read() after Reset() = %d, %v; want 0, io.EOF", n, err)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	files := testFiles()
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	var i int
+	err = cab.Walk(func(hdr *FileHeader, r io.Reader) error {
+		f := files[i]
+		i++
+		// Leave the content of the first member unread.
+		if i == 1 {
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		if hdr.Name != f.name || !bytes.Equal(data, f.data) {
+			t.Errorf("Walk() called with %q holding %q; want %q holding %q", hdr.Name, data, f.name, f.data)
+		}
+		return err
+	})
+	if err != nil || i != len(files) {
+		t.Errorf("Walk() = %v after %d members; want nil after %d", err, i, len(files))
+	}
+
+	stop := errors.New("stop")
+	i = 0
+	err = cab.Walk(func(*FileHeader, io.Reader) error {
+		i++
+		return stop
+	})
+	if err != stop || i != 1 {
+		t.Errorf("Walk() = %v after %d members; want the error of fn after 1", err, i)
+	}
+}
+
+func TestSeekIndex(t *testing.T) {
+	files := append(testFiles(), testFile{"d.txt", []byte("last")})
+	cab, err := New(bytes.NewReader(buildCabinet(t, CompressionMSZIP, 256, files)))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	next := func(want testFile) {
+		t.Helper()
+		hdr, err := cab.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		if data, err := io.ReadAll(cab); hdr.Name != want.name || err != nil || !bytes.Equal(data, want.data) {
+			t.Errorf("Next() = %q with %q, %v; want %q with %q", hdr.Name, data, err, want.name, want.data)
+		}
+	}
+	if err := cab.SeekIndex(2); err != nil {
+		t.Fatalf("SeekIndex(2) failed: %v", err)
+	}
+	next(files[2])
+	// Seeking backwards reads the folder again.
+	if err := cab.SeekName("b.bin"); err != nil {
+		t.Fatalf("SeekName() failed: %v", err)
+	}
+	next(files[1])
+	next(files[2])
+	if err := cab.SeekIndex(len(files)); err != nil {
+		t.Fatalf("SeekIndex(%d) failed: %v", len(files), err)
+	}
+	if _, err := cab.Next(); err != io.EOF {
+		t.Errorf("Next() after seeking to the end = %v; want io.EOF", err)
+	}
+	if err := cab.SeekIndex(len(files) + 1); err == nil {
+		t.Errorf("SeekIndex(%d) succeeded; want error", len(files)+1)
+	}
+	if err := cab.SeekName("missing"); !errors.Is(err, ErrFileNotFound) {
+		t.Errorf("SeekName() of a missing member = %v; want ErrFileNotFound", err)
+	}
+}
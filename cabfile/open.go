@@ -0,0 +1,95 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// ReadCloser is a Cabinet read from a file opened by OpenReader, which must
+// be closed once the Cabinet is no longer used.
+type ReadCloser struct {
+	*Cabinet
+	f *os.File
+}
+
+// OpenReader opens the Cabinet file at the given path and reads it according
+// to the options, like New.
+func OpenReader(path string, opts ...Option) (*ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	cab, err := New(f, opts...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &ReadCloser{Cabinet: cab, f: f}, nil
+}
+
+// Close closes the Cabinet file, rendering the Cabinet unusable.
+func (rc *ReadCloser) Close() error {
+	return rc.f.Close()
+}
+
+// NewReaderAt returns a new Cabinet reading the Cabinet file of the given
+// size from ra, like New. Unlike the io.ReadSeeker passed to New, ra has no
+// cursor shared with other users: every folder is read through a cursor of
+// its own, so that members may be read concurrently using Content,
+// ContentBytes and ContentIndex, as well as through Open and Stat. Next,
+// Blocks and the other methods are not safe for concurrent use; use Clone
+// for those.
+func NewReaderAt(ra io.ReaderAt, size int64, opts ...Option) (*Cabinet, error) {
+	c, err := New(io.NewSectionReader(ra, 0, size), opts...)
+	if err != nil {
+		return nil, err
+	}
+	c.ra = ra
+	return c, nil
+}
+
+// Clone returns a Cabinet sharing the parsed structures of c, but reading
+// the Cabinet file through its own cursor, so that the Cabinet and its clone
+// can be used independently, also concurrently. The clone starts iterating
+// with Next at the first member. This requires the reader of the Cabinet
+// file to implement io.ReaderAt, as do *os.File, *bytes.Reader and the
+// readers of Cabinets returned by NewReaderAt and OpenReader. The bytes
+// decompressed by the clone count against a MaxDecompressed limit of its
+// own. Closing a ReadCloser also renders its clones unusable.
+func (c *Cabinet) Clone() (*Cabinet, error) {
+	ra, ok := c.r.(io.ReaderAt)
+	if !ok {
+		return nil, errors.New("could not clone Cabinet: reader does not implement io.ReaderAt")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clone := *c
+	clone.r = io.NewSectionReader(ra, 0, c.size)
+	clone.Reset()
+	clone.mu = new(sync.Mutex)
+	clone.decompressed = 0
+	clone.warnings = append([]error(nil), c.warnings...)
+	if c.damage != nil {
+		clone.damage = make(map[damage]bool, len(c.damage))
+		for d := range c.damage {
+			clone.damage[d] = true
+		}
+	}
+	return &clone, nil
+}
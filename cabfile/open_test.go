@@ -0,0 +1,158 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestOpenReader(t *testing.T) {
+	files := testFiles()
+	path := filepath.Join(t.TempDir(), "test.cab")
+	if err := os.WriteFile(path, buildCabinet(t, CompressionMSZIP, 256, files), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	rc, err := OpenReader(path)
+	if err != nil {
+		t.Fatalf("OpenReader() failed: %v", err)
+	}
+	for _, f := range files {
+		got, err := rc.ContentBytes(f.name)
+		if err != nil || string(got) != string(f.data) {
+			t.Errorf("ContentBytes(%q) = %q, %v; want %q", f.name, got, err, f.data)
+		}
+	}
+	if err := rc.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+	if _, err := rc.ContentBytes(files[0].name); err == nil {
+		t.Error("ContentBytes() after Close() succeeded; want error")
+	}
+
+	if _, err := OpenReader(filepath.Join(t.TempDir(), "missing.cab")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("OpenReader() of a missing file = %v; want fs.ErrNotExist", err)
+	}
+	if err := os.WriteFile(path, make([]byte, 100), 0644); err != nil {
+		t.Fatalf("WriteFile() failed: %v", err)
+	}
+	if _, err := OpenReader(path); !errors.Is(err, ErrNotCabinet) {
+		t.Errorf("OpenReader() of a non-Cabinet file = %v; want ErrNotCabinet", err)
+	}
+}
+
+func TestNewReaderAt(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionMSZIP, 256, files)
+	cab, err := NewReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("NewReaderAt() failed: %v", err)
+	}
+	// The members of a single Cabinet are read concurrently.
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			for _, f := range files {
+				got, err := cab.ContentBytes(f.name)
+				if err != nil || !bytes.Equal(got, f.data) {
+					errs <- fmt.Errorf("ContentBytes(%q) = %q, %v; want %q", f.name, got, err, f.data)
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	files := testFiles()
+	data := buildCabinet(t, CompressionMSZIP, 256, files)
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	clone, err := cab.Clone()
+	if err != nil {
+		t.Fatalf("Clone() failed: %v", err)
+	}
+	// Interleaved reads of the folder do not interfere.
+	r1, _, err := cab.FolderReader(0)
+	if err != nil {
+		t.Fatalf("FolderReader() failed: %v", err)
+	}
+	r2, _, err := clone.FolderReader(0)
+	if err != nil {
+		t.Fatalf("FolderReader() of the clone failed: %v", err)
+	}
+	for _, f := range files {
+		for _, r := range []io.Reader{r1, r2} {
+			got := make([]byte, len(f.data))
+			if _, err := io.ReadFull(r, got); err != nil || !bytes.Equal(got, f.data) {
+				t.Errorf("Reading %q from the folder = %q, %v; want %q", f.name, got, err, f.data)
+			}
+		}
+	}
+	if !reflect.DeepEqual(clone.Files(), cab.Files()) {
+		t.Errorf("Files() of the clone = %v; want %v", clone.Files(), cab.Files())
+	}
+
+	// The clone counts decompressed bytes against the limit on its own.
+	var total int64
+	for _, f := range files {
+		total += int64(len(f.data))
+	}
+	cab, err = New(bytes.NewReader(data), WithLimits(Limits{MaxDecompressed: total}))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	readAll := func(c *Cabinet) error {
+		return c.Walk(func(_ *FileHeader, r io.Reader) error {
+			_, err := io.Copy(io.Discard, r)
+			return err
+		})
+	}
+	if err := readAll(cab); err != nil {
+		t.Fatalf("Walk() failed: %v", err)
+	}
+	if clone, err = cab.Clone(); err != nil {
+		t.Fatalf("Clone() failed: %v", err)
+	}
+	if err := readAll(clone); err != nil {
+		t.Errorf("Walk() of the clone after reading the Cabinet failed: %v", err)
+	}
+	if err := readAll(cab); !errors.Is(err, ErrSizeLimitExceeded) {
+		t.Errorf("Walk() of the Cabinet once more = %v; want ErrSizeLimitExceeded", err)
+	}
+
+	cab, err = New(struct{ io.ReadSeeker }{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if _, err := cab.Clone(); err == nil {
+		t.Error("Clone() without io.ReaderAt succeeded; want error")
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"crypto"
+	_ "crypto/sha1" // digest algorithms of signatures
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// Object identifiers of the PKCS #7 and Authenticode structures.
+var (
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidCounterSignature       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 6}
+	oidTSTInfo                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidSpcIndirectDataContent = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 4}
+	oidSpcCabData             = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 25}
+	oidRFC3161CounterSign     = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 3, 3, 1}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+// contentInfo is the PKCS #7 ContentInfo structure. Content holds the
+// explicitly tagged content, whose DER encoding are its Bytes.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+// signedData is the PKCS #7 SignedData structure.
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+// signerInfo is the PKCS #7 SignerInfo structure.
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue `asn1:"optional,tag:0"`
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+	UnauthenticatedAttributes asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// issuerAndSerialNumber identifies a certificate by its issuer and serial
+// number.
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+// attribute is a PKCS #9 attribute.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+// spcIndirectDataContent is the content signed by Authenticode, holding
+// the digest of the Cabinet file.
+type spcIndirectDataContent struct {
+	Data          spcAttributeTypeAndOptionalValue
+	MessageDigest digestInfo
+}
+
+type spcAttributeTypeAndOptionalValue struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"optional"`
+}
+
+type digestInfo struct {
+	DigestAlgorithm pkix.AlgorithmIdentifier
+	Digest          []byte
+}
+
+// tstInfo is the leading part of the TSTInfo structure of an RFC 3161
+// timestamp token.
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint digestInfo
+	SerialNumber   *big.Int
+	GenTime        time.Time `asn1:"generalized"`
+}
+
+// parseSignedData parses a DER-encoded ContentInfo holding SignedData.
+func parseSignedData(der []byte) (*signedData, error) {
+	var ci contentInfo
+	if rest, err := asn1.Unmarshal(der, &ci); err != nil {
+		return nil, fmt.Errorf("could not parse ContentInfo: %v", err)
+	} else if len(rest) > 0 {
+		return nil, errors.New("trailing data after ContentInfo")
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("content type %v is not SignedData", ci.ContentType)
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("could not parse SignedData: %v", err)
+	}
+	return &sd, nil
+}
+
+// parseAttributes parses the attributes held by a context-specific SET.
+func parseAttributes(raw asn1.RawValue) ([]attribute, error) {
+	var attrs []attribute
+	for rest := raw.Bytes; len(rest) > 0; {
+		var attr attribute
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+			return nil, fmt.Errorf("could not parse attribute: %v", err)
+		}
+		attrs = append(attrs, attr)
+	}
+	return attrs, nil
+}
+
+// findAttribute returns the single value of the attribute of the given
+// type, reporting whether there is one.
+func findAttribute(attrs []attribute, oid asn1.ObjectIdentifier) (asn1.RawValue, bool) {
+	for _, attr := range attrs {
+		if attr.Type.Equal(oid) {
+			var v asn1.RawValue
+			if _, err := asn1.Unmarshal(attr.Values.Bytes, &v); err != nil {
+				return v, false
+			}
+			return v, true
+		}
+	}
+	return asn1.RawValue{}, false
+}
+
+// oidFromHash returns the object identifier of the hash function h.
+func oidFromHash(h crypto.Hash) (asn1.ObjectIdentifier, error) {
+	switch h {
+	case crypto.SHA1:
+		return oidSHA1, nil
+	case crypto.SHA256:
+		return oidSHA256, nil
+	case crypto.SHA384:
+		return oidSHA384, nil
+	case crypto.SHA512:
+		return oidSHA512, nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %v", h)
+}
+
+// hashFromOID returns the hash function identified by oid.
+func hashFromOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for _, h := range []struct {
+		oid  asn1.ObjectIdentifier
+		hash crypto.Hash
+	}{
+		{oidSHA1, crypto.SHA1},
+		{oidSHA256, crypto.SHA256},
+		{oidSHA384, crypto.SHA384},
+		{oidSHA512, crypto.SHA512},
+	} {
+		if oid.Equal(h.oid) {
+			if !h.hash.Available() {
+				break
+			}
+			return h.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %v", oid)
+}
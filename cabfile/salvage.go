@@ -0,0 +1,102 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"io"
+	"sort"
+)
+
+// Salvage reads damaged Cabinet files on a best-effort basis. Data blocks
+// failing their checksum or decompression are replaced with zeros, and the
+// content of members is padded with zeros if a folder ends prematurely.
+// Incomplete reports the members affected by the damage found so far. With
+// MS-ZIP compression, blocks following a damaged block may refer to its
+// content and thus also be recovered incorrectly, which goes unnoticed
+// unless their checksums fail, too. Folders using compression methods this
+// package cannot decompress still fail with ErrUnsupportedCompression.
+func Salvage() Option {
+	return func(c *Cabinet) {
+		c.damage = make(map[damage]bool)
+	}
+}
+
+// damage is a range of uncompressed data of a folder which could not be
+// recovered in salvage mode.
+type damage struct {
+	fldr uint16
+	off  int64
+	n    int64 // negative up to the end of the folder
+}
+
+// record returns a function recording damage in the folder with the given
+// index for a folderReader, or nil if not in salvage mode.
+func (c *Cabinet) record(fldr uint16) func(off, n int64, err error) {
+	if c.damage == nil {
+		return nil
+	}
+	return func(off, n int64, err error) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.damage[damage{fldr: fldr, off: off, n: n}] = true
+	}
+}
+
+// truncated reports whether err, encountered after reading n bytes of the
+// content of f, ends the data of a truncated folder in salvage mode, in
+// which case the missing range is recorded.
+func (c *Cabinet) truncated(f *file, n int, err error) bool {
+	if c.damage == nil || !(errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.damage[damage{fldr: f.IFolder, off: int64(f.UOffFolderStart) + int64(n), n: -1}] = true
+	return true
+}
+
+// Incomplete returns the sorted names of the members whose content could
+// only partially be recovered from a Cabinet file opened with the Salvage
+// option, based on the data read so far. Reading all folders first, for
+// example using Verify, finds all damage.
+func (c *Cabinet) Incomplete() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for _, f := range c.files {
+		start := int64(f.UOffFolderStart)
+		end := start + int64(f.CBFile)
+		for d := range c.damage {
+			if d.fldr == f.IFolder && d.off < end && (d.n < 0 || d.off+d.n > start) {
+				names = append(names, f.name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// zeroReader reads an endless stream of zeros, which pads the content of
+// members of truncated folders.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
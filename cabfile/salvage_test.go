@@ -0,0 +1,83 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestSalvage(t *testing.T) {
+	big := make([]byte, 40000)
+	rand.New(rand.NewSource(1)).Read(big)
+	files := []testFile{{"big.bin", big}, {"small.txt", []byte("tiny")}}
+	data := writeCabinetData(t, files)
+
+	content := func(t *testing.T, cab *Cabinet, name string) []byte {
+		t.Helper()
+		r, err := cab.Content(name)
+		if err != nil {
+			t.Fatalf("Content(%q) failed: %v", name, err)
+		}
+		data, _ := io.ReadAll(r)
+		return data
+	}
+
+	t.Run("checksum", func(t *testing.T) {
+		data := append([]byte(nil), data...)
+		c := parseRaw(t, data)
+		data[c.fldrs[0].COFFCabStart+cfDataSize+100] ^= 0xff
+		cab, err := New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		if _, err := cab.Content("big.bin"); err == nil {
+			t.Error("Content() of a corrupted member succeeded; want error")
+		}
+		if cab, err = New(bytes.NewReader(data), Salvage()); err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		want := append(make([]byte, maxBlockSize), big[maxBlockSize:]...)
+		if got := content(t, cab, "big.bin"); !bytes.Equal(got, want) {
+			t.Error("Content() of a corrupted member is not zero-filled in the corrupted block")
+		}
+		if got := content(t, cab, "small.txt"); !bytes.Equal(got, files[1].data) {
+			t.Errorf("Content() of an intact member = %q; want %q", got, files[1].data)
+		}
+		if got, want := cab.Incomplete(), []string{"big.bin"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Incomplete() = %q; want %q", got, want)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		data := data[:len(data)-2]
+		cab, err := New(bytes.NewReader(data), Salvage())
+		if err != nil {
+			t.Fatalf("New() failed: %v", err)
+		}
+		if got := content(t, cab, "small.txt"); !bytes.Equal(got, make([]byte, 4)) {
+			t.Errorf("Content() of a truncated member = %q; want zeros", got)
+		}
+		if got := content(t, cab, "big.bin"); !bytes.Equal(got[:maxBlockSize], big[:maxBlockSize]) || len(got) != len(big) {
+			t.Error("Content() of a truncated member does not hold its intact data")
+		}
+		if got, want := cab.Incomplete(), []string{"big.bin", "small.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Incomplete() = %q; want %q", got, want)
+		}
+	})
+}
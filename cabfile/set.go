@@ -0,0 +1,429 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CabinetSet provides access to a multi-part set of Cabinet files as if it
+// was a single Cabinet file.
+type CabinetSet struct {
+	open  func(name string) (io.ReadSeeker, error)
+	opts  []Option
+	lazy  bool // open Cabinet files on demand and release consumed ones
+	parts []*setPart
+	fldrs [][]setSegment // segments of every folder of the set
+	files []*setFile
+
+	continues bool // the last folder of the last loaded part continues
+	complete  bool // all Cabinet files of the set have been loaded
+
+	next int           // index of the member returned by Next
+	mr   *memberReader // reader of the member content for Next
+	cur  *entryReader  // content of the current member of Next
+}
+
+// setPart is a Cabinet file of a set.
+type setPart struct {
+	name   string // empty for the first Cabinet file
+	cab    *Cabinet
+	closer io.Closer // closer of cab.r if opened by the set
+}
+
+// SetError reports a Cabinet file that does not belong to a set, because its
+// SetID differs from the one of the first Cabinet file or because it is not
+// numbered as the successor of the previous Cabinet file.
+type SetError struct {
+	Name         string // name of the offending Cabinet file
+	SetID        uint16
+	WantSetID    uint16
+	ICabinet     uint16
+	WantICabinet uint16
+}
+
+func (e *SetError) Error() string {
+	if e.SetID != e.WantSetID {
+		return fmt.Sprintf("Cabinet file %q has SetID %d; want %d", e.Name, e.SetID, e.WantSetID)
+	}
+	return fmt.Sprintf("Cabinet file %q has number %d in the set; want %d", e.Name, e.ICabinet, e.WantICabinet)
+}
+
+// setSegment is the part of a folder stored in one Cabinet file of a set.
+type setSegment struct {
+	part int    // index of the Cabinet file in the set
+	fldr uint16 // index of the folder within the Cabinet file
+}
+
+// setFile is a member of a set with its folder index within the set.
+type setFile struct {
+	*file
+	fldr int
+}
+
+// NewCabinetSet returns a new CabinetSet starting with the Cabinet file read
+// from r. The following Cabinet files are opened by calling open with the
+// names recorded in their predecessors. A *SetError is returned if any of
+// them does not share the SetID of the first one or is not numbered
+// sequentially. The options apply to all Cabinet files of the set.
+func NewCabinetSet(r io.ReadSeeker, open func(name string) (io.ReadSeeker, error), opts ...Option) (*CabinetSet, error) {
+	s, err := newCabinetSet(r, open, opts)
+	if err != nil {
+		return nil, err
+	}
+	for !s.complete {
+		if err := s.load(); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewLazyCabinetSet is like NewCabinetSet, but only opens the following
+// Cabinet files once reading the set reaches them, which suits sets
+// delivered over the network. Cabinet files holding only members already
+// returned by Next are released, closing them if open returned an
+// io.Closer, and opened again if needed by Content. FileList only lists the
+// members of the Cabinet files opened so far.
+func NewLazyCabinetSet(r io.ReadSeeker, open func(name string) (io.ReadSeeker, error), opts ...Option) (*CabinetSet, error) {
+	s, err := newCabinetSet(r, open, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.lazy = true
+	return s, nil
+}
+
+func newCabinetSet(r io.ReadSeeker, open func(name string) (io.ReadSeeker, error), opts []Option) (*CabinetSet, error) {
+	cab, err := parse(r, opts)
+	if err != nil {
+		return nil, err
+	}
+	if (cab.hdr.Flags & hdrPrevCabinet) != 0 {
+		return nil, fmt.Errorf("Cabinet file continues %q, which is missing from the set", cab.hdr.CabinetPrev)
+	}
+	s := &CabinetSet{open: open, opts: opts, parts: []*setPart{{cab: cab}}}
+	s.mr = &memberReader{folderData: s.folderData}
+	if err := s.index(0); err != nil {
+		return nil, err
+	}
+	s.complete = (cab.hdr.Flags & hdrNextCabinet) == 0
+	return s, nil
+}
+
+// load opens and indexes the Cabinet file following the last loaded one.
+func (s *CabinetSet) load() error {
+	prev := s.parts[len(s.parts)-1].cab
+	name := prev.hdr.CabinetNext
+	r, err := s.open(name)
+	if err != nil {
+		return fmt.Errorf("could not open Cabinet file %q: %v", name, err)
+	}
+	part := &setPart{name: name}
+	part.closer, _ = r.(io.Closer)
+	if part.cab, err = parse(r, s.opts); err != nil {
+		part.release()
+		return fmt.Errorf("could not parse Cabinet file %q: %w", name, err)
+	}
+	if part.cab.hdr.SetID != s.parts[0].cab.hdr.SetID || part.cab.hdr.ICabinet != prev.hdr.ICabinet+1 {
+		part.release()
+		return &SetError{
+			Name:         name,
+			SetID:        part.cab.hdr.SetID,
+			WantSetID:    s.parts[0].cab.hdr.SetID,
+			ICabinet:     part.cab.hdr.ICabinet,
+			WantICabinet: prev.hdr.ICabinet + 1,
+		}
+	}
+	s.parts = append(s.parts, part)
+	if err := s.index(len(s.parts) - 1); err != nil {
+		return err
+	}
+	s.complete = (part.cab.hdr.Flags & hdrNextCabinet) == 0
+	if s.complete && s.continues {
+		return errors.New("last Cabinet file of the set continues a folder")
+	}
+	return nil
+}
+
+// index assigns the folders of the Cabinet file with index k to folders of
+// the set, merging a folder continued from the previous Cabinet file, and
+// lists every member once.
+func (s *CabinetSet) index(k int) error {
+	part := s.parts[k].cab
+	var fromPrev, toNext bool
+	for _, f := range part.files {
+		switch f.IFolder {
+		case ifoldContinuedFromPrev:
+			fromPrev = true
+		case ifoldContinuedToNext:
+			toNext = true
+		case ifoldContinuedPrevAndNext:
+			fromPrev, toNext = true, true
+		}
+	}
+	if fromPrev && k == 0 {
+		return errors.New("first Cabinet file of the set continues a folder")
+	}
+	if len(part.fldrs) == 0 && (fromPrev || toNext) {
+		return fmt.Errorf("Cabinet file %d continues a folder, but has none", k)
+	}
+
+	fldrs := make([]int, len(part.fldrs)) // folder indices within the set
+	for j := range part.fldrs {
+		if j == 0 && k > 0 && (s.continues || fromPrev) && len(s.fldrs) > 0 {
+			fldrs[j] = len(s.fldrs) - 1
+		} else {
+			fldrs[j] = len(s.fldrs)
+			s.fldrs = append(s.fldrs, nil)
+		}
+		s.fldrs[fldrs[j]] = append(s.fldrs[fldrs[j]], setSegment{part: k, fldr: uint16(j)})
+	}
+
+	for _, f := range part.files {
+		var fldr int
+		switch f.IFolder {
+		case ifoldContinuedFromPrev, ifoldContinuedPrevAndNext:
+			// Listed in the Cabinet file the member starts in.
+			continue
+		case ifoldContinuedToNext:
+			fldr = fldrs[len(fldrs)-1]
+		default:
+			if int(f.IFolder) >= len(fldrs) {
+				return fmt.Errorf("file %q of Cabinet file %d refers to missing folder %d", f.name, k, f.IFolder)
+			}
+			fldr = fldrs[f.IFolder]
+		}
+		s.files = append(s.files, &setFile{file: f, fldr: fldr})
+	}
+	s.continues = toNext
+	return nil
+}
+
+// reader returns the reader of the Cabinet file with index k, opening it
+// again if it was released.
+func (s *CabinetSet) reader(k int) (io.ReadSeeker, error) {
+	part := s.parts[k]
+	if part.cab.r == nil {
+		r, err := s.open(part.name)
+		if err != nil {
+			return nil, fmt.Errorf("could not open Cabinet file %q: %v", part.name, err)
+		}
+		part.cab.r = r
+		part.closer, _ = r.(io.Closer)
+	}
+	return part.cab.r, nil
+}
+
+// release drops the reader of the Cabinet file, closing it if it was opened
+// by the set.
+func (p *setPart) release() error {
+	if p.closer == nil {
+		return nil
+	}
+	err := p.closer.Close()
+	p.closer = nil
+	p.cab.r = nil
+	return err
+}
+
+// Close closes the Cabinet files opened by the set. The reader of the first
+// Cabinet file passed to NewCabinetSet or NewLazyCabinetSet is left open.
+func (s *CabinetSet) Close() error {
+	var err error
+	for _, p := range s.parts {
+		if cerr := p.release(); err == nil && cerr != nil {
+			err = fmt.Errorf("could not close Cabinet file %q: %v", p.name, cerr)
+		}
+	}
+	return err
+}
+
+// FileList returns the list of filenames in the set. For a set returned by
+// NewLazyCabinetSet, only the members of the Cabinet files loaded so far are
+// listed.
+func (s *CabinetSet) FileList() []string {
+	var names []string
+	for _, f := range s.files {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// Files returns information about the members of the set, in the order of
+// FileList. Folder is the index of the folder within the set, counting a
+// folder continued across Cabinet files once, and FolderOffset the offset
+// in its uncompressed data. Nothing is decompressed.
+func (s *CabinetSet) Files() []FileInfo {
+	var infos []FileInfo
+	for _, f := range s.files {
+		seg := s.fldrs[f.fldr][0]
+		fi := s.parts[seg.part].cab.fileInfo(f.file)
+		fi.Folder = f.fldr
+		fi.Compression = parseCompression(s.parts[seg.part].cab.fldrs[seg.fldr].TypeCompress)
+		infos = append(infos, fi)
+	}
+	return infos
+}
+
+// SetID returns the SetID shared by the Cabinet files of the set.
+func (s *CabinetSet) SetID() uint16 {
+	return s.parts[0].cab.hdr.SetID
+}
+
+// folderData returns a reader for the uncompressed data of the folder of the
+// set with the given index. The segments of folders spanning Cabinet files
+// are decompressed as one, including blocks split across Cabinet files. The
+// following Cabinet file of a lazy set is only loaded once the data of the
+// last loaded folder is exhausted.
+func (s *CabinetSet) folderData(idx int) (io.Reader, error) {
+	seg := s.fldrs[idx][0]
+	if _, err := s.reader(seg.part); err != nil {
+		return nil, err
+	}
+	fr, err := s.parts[seg.part].cab.folderData(seg.fldr)
+	if err != nil {
+		return nil, err
+	}
+	fr.idx = idx
+	// All Cabinet files of the set share the limit of decompressed bytes.
+	fr.decompressed = &s.parts[0].cab.decompressed
+	n := 1 // number of segments read
+	fr.more = func() (io.Reader, *cfFolder, error) {
+		if n == len(s.fldrs[idx]) && idx == len(s.fldrs)-1 && !s.complete {
+			if err := s.load(); err != nil {
+				return nil, nil, err
+			}
+		}
+		if n == len(s.fldrs[idx]) {
+			return nil, nil, nil
+		}
+		seg := s.fldrs[idx][n]
+		n++
+		r, err := s.reader(seg.part)
+		if err != nil {
+			return nil, nil, err
+		}
+		cab := s.parts[seg.part].cab
+		fldr := cab.fldrs[seg.fldr]
+		if _, err := r.Seek(int64(fldr.COFFCabStart), io.SeekStart); err != nil {
+			return nil, nil, fmt.Errorf("could not seek to start of data section: %v", err)
+		}
+		// The parts of a set may reserve different areas.
+		fr.reserve = int64(cab.hdr.CBCFData)
+		return r, fldr, nil
+	}
+	return fr, nil
+}
+
+// Next advances to the next member of the set, in the order of FileList,
+// and returns its header, or io.EOF after the last member. The content of
+// the member is read using Read; unread content is skipped by the following
+// call to Next. Reading all members using Next decompresses every folder
+// only once.
+func (s *CabinetSet) Next() (*FileHeader, error) {
+	s.cur = nil
+	for s.next >= len(s.files) {
+		if s.complete {
+			return nil, io.EOF
+		}
+		if err := s.load(); err != nil {
+			return nil, err
+		}
+	}
+	f := s.files[s.next]
+	s.next++
+	if err := s.parts[0].cab.limits.checkFile(f.file); err != nil {
+		return nil, err
+	}
+	seg := s.fldrs[f.fldr][0]
+	if s.lazy {
+		// Earlier Cabinet files hold no data of this or following members.
+		for _, p := range s.parts[:seg.part] {
+			p.release()
+		}
+	}
+	r, err := s.mr.open(f.fldr, f.file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read content of %q: %w", f.name, err)
+	}
+	s.cur = &entryReader{r: r, left: int64(f.CBFile)}
+	return s.parts[seg.part].cab.fileHeader(f.file), nil
+}
+
+// Read reads from the content of the current member returned by Next, like
+// Cabinet.Read.
+func (s *CabinetSet) Read(p []byte) (int, error) {
+	if s.cur == nil {
+		return 0, io.EOF
+	}
+	return s.cur.Read(p)
+}
+
+// lookup returns the member of the given name according to the IgnoreCase
+// option, loading Cabinet files of a lazy set until it is found. A member
+// matching only case-insensitively is returned once the set is complete.
+func (s *CabinetSet) lookup(name string) (*setFile, error) {
+	m := nameMatcher{name: name, ignoreCase: s.parts[0].cab.ignoreCase}
+	var fold *setFile
+	for i := 0; ; i++ {
+		for i >= len(s.files) {
+			if s.complete {
+				if fold == nil {
+					return nil, fmt.Errorf("could not read %q: %w", name, ErrFileNotFound)
+				}
+				return fold, nil
+			}
+			if err := s.load(); err != nil {
+				return nil, err
+			}
+		}
+		f := s.files[i]
+		if m.match(f.file) {
+			return f, nil
+		}
+		if fold == nil && m.fold != nil {
+			fold = f
+		}
+	}
+}
+
+// Content returns the content of the file specified by its filename as an
+// io.Reader, which also implements io.Seeker and io.ReaderAt.
+func (s *CabinetSet) Content(name string) (io.Reader, error) {
+	f, err := s.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.parts[0].cab.limits.checkFile(f.file); err != nil {
+		return nil, err
+	}
+	data, err := s.folderData(f.fldr)
+	if err != nil {
+		return nil, fmt.Errorf("could not acquire uncompressed data for folder %d: %v", f.fldr, err)
+	}
+	if _, err := io.CopyN(io.Discard, data, int64(f.UOffFolderStart)); err != nil {
+		return nil, fmt.Errorf("could not skip to start of data: %w", err)
+	}
+	blob := make([]byte, f.CBFile)
+	if n, err := io.ReadFull(data, blob); err != nil {
+		return nil, fmt.Errorf("invalid read of size %d of file data; expected %d: %w", n, f.CBFile, err)
+	}
+	return bytes.NewReader(blob), nil
+}
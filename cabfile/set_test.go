@@ -0,0 +1,464 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// openSet returns a CabinetSet for Cabinet files written by writeSet.
+func openSet(t *testing.T, cabs map[string][]byte, names []string) *CabinetSet {
+	t.Helper()
+	s, err := NewCabinetSet(bytes.NewReader(cabs[names[0]]), func(name string) (io.ReadSeeker, error) {
+		data, ok := cabs[name]
+		if !ok {
+			return nil, fmt.Errorf("no such Cabinet file %q", name)
+		}
+		return bytes.NewReader(data), nil
+	})
+	if err != nil {
+		t.Fatalf("NewCabinetSet() failed: %v", err)
+	}
+	return s
+}
+
+// checkSet verifies that the set holds exactly files.
+func checkSet(t *testing.T, s *CabinetSet, files []testFile) {
+	t.Helper()
+	var want []string
+	for _, f := range files {
+		want = append(want, f.name)
+	}
+	if got := s.FileList(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FileList() = %q; want %q", got, want)
+	}
+	for _, f := range files {
+		r, err := s.Content(f.name)
+		if err != nil {
+			t.Errorf("Content(%q) failed: %v", f.name, err)
+			continue
+		}
+		if got, _ := io.ReadAll(r); !bytes.Equal(got, f.data) {
+			t.Errorf("Content(%q) = %d bytes; want %d bytes", f.name, len(got), len(f.data))
+		}
+	}
+	for _, f := range files {
+		hdr, err := s.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		name := hdr.Name
+		if name != f.name {
+			t.Errorf("Next() = %q; want %q", name, f.name)
+		}
+		if got, _ := io.ReadAll(s); !bytes.Equal(got, f.data) {
+			t.Errorf("Next() content of %q = %d bytes; want %d bytes", name, len(got), len(f.data))
+		}
+	}
+	if _, err := s.Next(); err != io.EOF {
+		t.Errorf("Next() after the last member = %v; want io.EOF", err)
+	}
+}
+
+func TestCabinetSet(t *testing.T) {
+	// With a folder per file of a single block, no folder spans Cabinet
+	// files.
+	var files []testFile
+	for i := 0; i < 6; i++ {
+		files = append(files, testFile{fmt.Sprintf("file%d.bin", i), bytes.Repeat([]byte{byte(i)}, 5000)})
+	}
+	cabs, names := writeSet(t, 12000, files, WithFolderPerFile(), WithSetID(3))
+	if len(names) < 3 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want at least 3", len(names))
+	}
+	s := openSet(t, cabs, names)
+	checkSet(t, s, files)
+	if got, want := s.SetID(), uint16(3); got != want {
+		t.Errorf("SetID() = %d; want %d", got, want)
+	}
+
+	if _, err := New(bytes.NewReader(cabs[names[0]])); err == nil {
+		t.Error("New() of a multi-part Cabinet file succeeded; want error")
+	}
+	if _, err := NewCabinetSet(bytes.NewReader(cabs[names[1]]), nil); err == nil {
+		t.Error("NewCabinetSet() starting with the second Cabinet file succeeded; want error")
+	}
+	delete(cabs, names[2])
+	if _, err := NewCabinetSet(bytes.NewReader(cabs[names[0]]), func(name string) (io.ReadSeeker, error) {
+		data, ok := cabs[name]
+		if !ok {
+			return nil, fmt.Errorf("no such Cabinet file %q", name)
+		}
+		return bytes.NewReader(data), nil
+	}); err == nil {
+		t.Error("NewCabinetSet() with a missing Cabinet file succeeded; want error")
+	}
+}
+
+// trackedReader records when a Cabinet file of a set is closed.
+type trackedReader struct {
+	*bytes.Reader
+	closed *bool
+}
+
+func (r trackedReader) Close() error {
+	*r.closed = true
+	return nil
+}
+
+func TestLazyCabinetSet(t *testing.T) {
+	chunk := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(chunk)
+	files := []testFile{
+		{"first.txt", []byte("first")},
+		{"repeated.bin", bytes.Repeat(chunk, 30)},
+		{"middle.txt", []byte("middle")},
+		{"random.bin", chunk},
+		{"last.txt", []byte("last")},
+	}
+	cabs, names := writeSet(t, 21000, files, WithCompression(CompressionMSZIP), WithFolderPerFile())
+	if len(names) < 3 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want at least 3", len(names))
+	}
+	closed := make(map[string]*bool)
+	var opened []string
+	s, err := NewLazyCabinetSet(bytes.NewReader(cabs[names[0]]), func(name string) (io.ReadSeeker, error) {
+		opened = append(opened, name)
+		closed[name] = new(bool)
+		return trackedReader{bytes.NewReader(cabs[name]), closed[name]}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewLazyCabinetSet() failed: %v", err)
+	}
+	if len(opened) != 0 {
+		t.Errorf("NewLazyCabinetSet() opened %q; want none", opened)
+	}
+	for _, f := range files {
+		hdr, err := s.Next()
+		if err != nil {
+			t.Fatalf("Next() failed: %v", err)
+		}
+		name := hdr.Name
+		if name != f.name {
+			t.Errorf("Next() = %q; want %q", name, f.name)
+		}
+		if got, _ := io.ReadAll(s); !bytes.Equal(got, f.data) {
+			t.Errorf("Next() content of %q = %d bytes; want %d bytes", name, len(got), len(f.data))
+		}
+		if name == "first.txt" && len(opened) != 0 {
+			t.Errorf("Reading %q opened %q; want none", name, opened)
+		}
+	}
+	if _, err := s.Next(); err != io.EOF {
+		t.Errorf("Next() after the last member = %v; want io.EOF", err)
+	}
+	if !reflect.DeepEqual(opened, names[1:]) {
+		t.Errorf("Opened Cabinet files %q; want %q", opened, names[1:])
+	}
+	for _, name := range names[1 : len(names)-1] {
+		if !*closed[name] {
+			t.Errorf("Cabinet file %q was not released", name)
+		}
+	}
+
+	// Released Cabinet files are opened again.
+	r, err := s.Content("repeated.bin")
+	if err != nil {
+		t.Fatalf("Content(%q) failed: %v", "repeated.bin", err)
+	}
+	if got, _ := io.ReadAll(r); !bytes.Equal(got, files[1].data) {
+		t.Errorf("Content(%q) = %d bytes; want %d bytes", "repeated.bin", len(got), len(files[1].data))
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	for _, name := range names[1:] {
+		if !*closed[name] {
+			t.Errorf("Cabinet file %q was not closed by Close()", name)
+		}
+	}
+}
+
+func TestCabinetSetCloseOnError(t *testing.T) {
+	files := []testFile{
+		{"a.bin", bytes.Repeat([]byte{1}, 5000)},
+		{"b.bin", bytes.Repeat([]byte{2}, 5000)},
+		{"c.bin", bytes.Repeat([]byte{3}, 5000)},
+	}
+	cabs, names := writeSet(t, 6000, files, WithFolderPerFile())
+	if len(names) < 3 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want at least 3", len(names))
+	}
+	// Break the set after the second Cabinet file.
+	last := cabs[names[len(names)-1]]
+	binary.LittleEndian.PutUint16(last[34:], 0xffff) // ICabinet
+	closed := make(map[string]*bool)
+	_, err := NewCabinetSet(bytes.NewReader(cabs[names[0]]), func(name string) (io.ReadSeeker, error) {
+		closed[name] = new(bool)
+		return trackedReader{bytes.NewReader(cabs[name]), closed[name]}, nil
+	})
+	var se *SetError
+	if !errors.As(err, &se) {
+		t.Fatalf("NewCabinetSet() = %v; want *SetError", err)
+	}
+	for _, name := range names[1:] {
+		if !*closed[name] {
+			t.Errorf("Cabinet file %q was not closed", name)
+		}
+	}
+}
+
+func TestCabinetSetOptions(t *testing.T) {
+	var files []testFile
+	for i := 0; i < 6; i++ {
+		files = append(files, testFile{fmt.Sprintf("file%d.bin", i), bytes.Repeat([]byte{byte(i)}, 5000)})
+	}
+	cabs, names := writeSet(t, 12000, files, WithFolderPerFile())
+	// Corrupt the content of the last file.
+	last := cabs[names[len(names)-1]]
+	last[len(last)-1] ^= 0xff
+	open := func(name string) (io.ReadSeeker, error) {
+		return bytes.NewReader(cabs[name]), nil
+	}
+	s, err := NewCabinetSet(bytes.NewReader(cabs[names[0]]), open)
+	if err != nil {
+		t.Fatalf("NewCabinetSet() failed: %v", err)
+	}
+	if _, err := s.Content("file5.bin"); err == nil {
+		t.Error("Content() of a corrupted file succeeded; want error")
+	}
+	if s, err = NewCabinetSet(bytes.NewReader(cabs[names[0]]), open, IgnoreChecksums()); err != nil {
+		t.Fatalf("NewCabinetSet() failed: %v", err)
+	}
+	if _, err := s.Content("file5.bin"); err != nil {
+		t.Errorf("Content() of a corrupted file with IgnoreChecksums() failed: %v", err)
+	}
+}
+
+func TestCabinetSetMismatch(t *testing.T) {
+	var files []testFile
+	for i := 0; i < 6; i++ {
+		files = append(files, testFile{fmt.Sprintf("file%d.bin", i), bytes.Repeat([]byte{byte(i)}, 5000)})
+	}
+	for _, tc := range []struct {
+		name string
+		off  int // offset of the patched header field
+		val  uint16
+		want SetError
+	}{
+		{"setid", 32, 8, SetError{SetID: 8, WantSetID: 7, ICabinet: 3, WantICabinet: 3}},
+		{"icabinet", 34, 4, SetError{SetID: 7, WantSetID: 7, ICabinet: 4, WantICabinet: 3}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cabs, names := writeSet(t, 12000, files, WithFolderPerFile(), WithSetID(7), WithCabinetIndex(1))
+			if len(names) < 3 {
+				t.Fatalf("SetWriter wrote %d Cabinet files; want at least 3", len(names))
+			}
+			binary.LittleEndian.PutUint16(cabs[names[2]][tc.off:], tc.val)
+			_, err := NewCabinetSet(bytes.NewReader(cabs[names[0]]), func(name string) (io.ReadSeeker, error) {
+				return bytes.NewReader(cabs[name]), nil
+			})
+			var serr *SetError
+			if !errors.As(err, &serr) {
+				t.Fatalf("NewCabinetSet() = %v; want *SetError", err)
+			}
+			tc.want.Name = names[2]
+			if *serr != tc.want {
+				t.Errorf("NewCabinetSet() = %+v; want %+v", *serr, tc.want)
+			}
+		})
+	}
+}
+
+func TestCabinetSetSpanningFolder(t *testing.T) {
+	// Repeated random data compresses well, but only with the history of
+	// preceding blocks.
+	chunk := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(chunk)
+	files := []testFile{
+		{"first.txt", []byte("first")},
+		{"repeated.bin", bytes.Repeat(chunk, 30)},
+		{"last.txt", []byte("last")},
+	}
+	cabs, names := writeSet(t, 21000, files, WithCompression(CompressionMSZIP))
+	if len(names) < 2 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want at least 2", len(names))
+	}
+	checkSet(t, openSet(t, cabs, names), files)
+}
+
+func TestCabinetSetNextContent(t *testing.T) {
+	chunk := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(chunk)
+	files := []testFile{
+		{"repeated.bin", bytes.Repeat(chunk, 30)},
+		{"last.txt", []byte("last")},
+	}
+	cabs, names := writeSet(t, 21000, files, WithCompression(CompressionMSZIP))
+	s := openSet(t, cabs, names)
+	if _, err := s.Next(); err != nil {
+		t.Fatalf("Next() failed: %v", err)
+	}
+	head := make([]byte, 1000)
+	if _, err := io.ReadFull(s, head); err != nil {
+		t.Fatalf("Reading content of Next() failed: %v", err)
+	}
+	// Content repositions the readers of the Cabinet files the content of
+	// Next is still being read from.
+	if _, err := s.Content("last.txt"); err != nil {
+		t.Fatalf("Content() failed: %v", err)
+	}
+	rest, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("Reading content of Next() after Content() failed: %v", err)
+	}
+	if got := append(head, rest...); !bytes.Equal(got, files[0].data) {
+		t.Errorf("Next() content after Content() = %d bytes; want %d bytes", len(got), len(files[0].data))
+	}
+}
+
+func TestCabinetSetFiles(t *testing.T) {
+	data := make([]byte, 5*maxBlockSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	files := []testFile{
+		{"first.txt", []byte("first")},
+		{"random.bin", data},
+		{"last.txt", []byte("last")},
+	}
+	cabs, names := writeSet(t, 2*maxBlockSize+1000, files)
+	if len(names) != 3 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want 3", len(names))
+	}
+	s := openSet(t, cabs, names)
+	var got []string
+	for _, fi := range s.Files() {
+		got = append(got, fmt.Sprintf("%s:%d:%d", fi.Name, fi.Folder, fi.FolderOffset))
+	}
+	want := []string{"first.txt:0:0", "random.bin:0:5", fmt.Sprintf("last.txt:0:%d", 5+len(data))}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Files() = %q; want %q", got, want)
+	}
+
+	// Each Cabinet file holds the continued member in its only folder.
+	for _, name := range names {
+		cab, err := parse(bytes.NewReader(cabs[name]), nil)
+		if err != nil {
+			t.Fatalf("parse(%s) failed: %v", name, err)
+		}
+		for _, fi := range cab.Files() {
+			if fi.Folder != 0 {
+				t.Errorf("%s: Files() reports %q in folder %d; want 0", name, fi.Name, fi.Folder)
+			}
+		}
+	}
+}
+
+// buildSplitSet assembles a set of two Cabinet files holding the files in a
+// single MS-ZIP folder of blocks of 500 bytes, with the second block split
+// across the Cabinet files. The first file ends in the split block.
+func buildSplitSet(t *testing.T, files []testFile) (map[string][]byte, []string) {
+	t.Helper()
+	var data []byte
+	for _, f := range files {
+		data = append(data, f.data...)
+	}
+	comp, err := compressor(CompressionMSZIP)(Compression{Type: CompressionMSZIP}, 6)
+	if err != nil {
+		t.Fatalf("Could not create compressor: %v", err)
+	}
+	var blocks [][]byte
+	var uncomp []uint16
+	for off := 0; off < len(data); off += 500 {
+		end := off + 500
+		if end > len(data) {
+			end = len(data)
+		}
+		cb, err := comp.Compress(data[off:end])
+		if err != nil {
+			t.Fatalf("Compress() failed: %v", err)
+		}
+		blocks = append(blocks, append([]byte(nil), cb...))
+		uncomp = append(uncomp, uint16(end-off))
+	}
+	if len(blocks) < 3 || len(files[0].data) <= 500 || len(files[0].data) > 1000 {
+		t.Fatal("Test files do not fit the layout of the set")
+	}
+
+	block := func(buf *bytes.Buffer, cb []byte, uncomp uint16) {
+		d := cfData{CBData: uint16(len(cb)), CBUncomp: uncomp}
+		d.Checksum = blockChecksum(&d, cb)
+		binary.Write(buf, binary.LittleEndian, &d)
+		buf.Write(cb)
+	}
+	half := len(blocks[1]) / 2
+	var data1, data2 bytes.Buffer
+	block(&data1, blocks[0], uncomp[0])
+	block(&data1, blocks[1][:half], 0)
+	block(&data2, blocks[1][half:], uncomp[1])
+	for i := 2; i < len(blocks); i++ {
+		block(&data2, blocks[i], uncomp[i])
+	}
+
+	entry := func(i int, ifold uint16) *file {
+		var off uint32
+		for _, f := range files[:i] {
+			off += uint32(len(f.data))
+		}
+		return &file{cfFile: &cfFile{CBFile: uint32(len(files[i].data)), UOffFolderStart: off, IFolder: ifold}, name: files[i].name}
+	}
+	cab1 := &cabinet{
+		hdr:      NewWriter(nil).header(),
+		fldrs:    []cfFolder{{CCFData: 2, TypeCompress: uint16(CompressionMSZIP)}},
+		files:    []*file{entry(0, ifoldContinuedToNext)},
+		dataSize: uint32(data1.Len()),
+	}
+	cab1.hdr.Flags |= hdrNextCabinet
+	cab1.hdr.CabinetNext = "part2.cab"
+	cab2 := &cabinet{
+		hdr:      NewWriter(nil).header(),
+		fldrs:    []cfFolder{{CCFData: uint16(len(blocks) - 1), TypeCompress: uint16(CompressionMSZIP)}},
+		files:    []*file{entry(0, ifoldContinuedFromPrev)},
+		dataSize: uint32(data2.Len()),
+	}
+	for i := 1; i < len(files); i++ {
+		cab2.files = append(cab2.files, entry(i, 0))
+	}
+	cab2.hdr.Flags |= hdrPrevCabinet
+	cab2.hdr.ICabinet = 1
+	cab2.hdr.CabinetPrev = "part1.cab"
+
+	var out1, out2 bytes.Buffer
+	if err := cab1.write(&out1, &data1); err != nil {
+		t.Fatalf("Could not write first Cabinet file: %v", err)
+	}
+	if err := cab2.write(&out2, &data2); err != nil {
+		t.Fatalf("Could not write second Cabinet file: %v", err)
+	}
+	return map[string][]byte{"part1.cab": out1.Bytes(), "part2.cab": out2.Bytes()}, []string{"part1.cab", "part2.cab"}
+}
+
+func TestCabinetSetSplitBlock(t *testing.T) {
+	files := testFiles()
+	cabs, names := buildSplitSet(t, files)
+	checkSet(t, openSet(t, cabs, names), files)
+}
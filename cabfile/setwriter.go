@@ -0,0 +1,284 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SetWriter creates a multi-part Cabinet set. Members are added using the
+// methods of the embedded Writer. On Close, the folders are distributed over
+// as many Cabinet files as necessary to keep each of them within the size
+// limit, continuing folders and the members within them from one Cabinet
+// file to the next. CFDATA blocks are never split, so a Cabinet file holding
+// a single block may exceed the limit.
+//
+// All Cabinet files of the set share the SetID set using WithSetID. The
+// first Cabinet file has the index set using WithCabinetIndex, and every
+// following one the next higher index.
+type SetWriter struct {
+	*Writer
+
+	maxSize int64
+	name    func(i int) string
+	create  func(name string) (io.WriteCloser, error)
+}
+
+// NewSetWriter returns a new SetWriter creating Cabinet files of at most
+// maxSize bytes. The name function returns the file name of the i-th Cabinet
+// file of the set, which is recorded in the neighboring Cabinet files, and
+// create is called to create it. The Cabinet files are closed once written.
+func NewSetWriter(maxSize int64, name func(i int) string, create func(name string) (io.WriteCloser, error), opts ...WriterOption) *SetWriter {
+	return &SetWriter{
+		Writer:  NewWriter(nil, opts...),
+		maxSize: maxSize,
+		name:    name,
+		create:  create,
+	}
+}
+
+// setItem is a CFDATA block of a folder to be placed in a Cabinet file of the
+// set. Folders without any blocks are represented by a single empty item.
+type setItem struct {
+	fldr   int    // index of the folder
+	first  bool   // item holds the first block of the folder
+	last   bool   // item holds the last block of the folder
+	start  int64  // uncompressed offset of the block in the folder
+	end    int64  // uncompressed offset of the end of the block
+	off    int64  // offset of the block in the spilled data
+	size   uint32 // size of the block including its CFDATA header
+	blocks uint16 // number of blocks, zero for the empty item
+}
+
+// setCabinet is a range of items placed in a single Cabinet file.
+type setCabinet struct {
+	items []setItem
+	files []int // indices of the member files intersecting the items
+}
+
+// Close distributes the folders over the Cabinet files of the set, writes
+// them and removes any temporary file.
+func (sw *SetWriter) Close() error {
+	if sw.closed {
+		return errors.New("writer is already closed")
+	}
+	defer sw.closeData()
+	if err := sw.finish(); err != nil {
+		return err
+	}
+
+	cabs := sw.split()
+	for i, sc := range cabs {
+		if err := sw.ctx.Err(); err != nil {
+			return err
+		}
+		cab := sw.cabinet(i, cabs)
+		name := sw.name(i)
+		out, err := sw.create(name)
+		if err != nil {
+			return fmt.Errorf("could not create Cabinet file %q: %v", name, err)
+		}
+		var off int64
+		if len(sc.items) > 0 {
+			off = sc.items[0].off
+		}
+		err = sw.writeCabinet(out, cab, func() io.Reader { return sw.data.section(off, int64(cab.dataSize)) })
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return fmt.Errorf("could not write Cabinet file %q: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// items returns the blocks of all folders in order.
+func (sw *SetWriter) items() []setItem {
+	var items []setItem
+	for i, fldr := range sw.fldrs {
+		if len(fldr.blocks) == 0 {
+			items = append(items, setItem{fldr: i, first: true, last: true, off: int64(fldr.COFFCabStart)})
+			continue
+		}
+		off, start := int64(fldr.COFFCabStart), int64(0)
+		for j, b := range fldr.blocks {
+			items = append(items, setItem{
+				fldr:   i,
+				first:  j == 0,
+				last:   j == len(fldr.blocks)-1,
+				start:  start,
+				end:    start + int64(b.uncomp),
+				off:    off,
+				size:   b.size,
+				blocks: 1,
+			})
+			off += int64(b.size)
+			start += int64(b.uncomp)
+		}
+	}
+	return items
+}
+
+// intersects reports whether the member file f has data in the item.
+func (it *setItem) intersects(f *file) bool {
+	if int(f.IFolder) != it.fldr {
+		return false
+	}
+	o, n := int64(f.UOffFolderStart), int64(f.CBFile)
+	if n == 0 {
+		return (it.start <= o && o < it.end) || (it.last && o == it.end)
+	}
+	return o < it.end && o+n > it.start
+}
+
+// split greedily distributes the items over Cabinet files, starting a new
+// one whenever the next item would push the current one over the limit.
+func (sw *SetWriter) split() []*setCabinet {
+	// The name of the next Cabinet file is assumed to be present, which
+	// overestimates the header size of the last one.
+	headerSize := func(i int) int64 {
+		hdr := sw.header()
+		hdr.Flags = hdrNextCabinet
+		hdr.CabinetNext = sw.name(i + 1)
+		if i > 0 {
+			hdr.Flags |= hdrPrevCabinet
+			hdr.CabinetPrev = sw.name(i - 1)
+		}
+		return int64(hdr.size())
+	}
+	cur := &setCabinet{}
+	cabs := []*setCabinet{cur}
+	size := headerSize(0)
+	var lastFldr int
+	next := 0 // index of the first member file possibly intersecting an item
+	for _, it := range sw.items() {
+		// Member files are ordered by folder and offset, so the files
+		// intersecting an item follow the ones intersecting the
+		// previous item.
+		for ; next < len(sw.files); next++ {
+			f := sw.files[next]
+			o, n := int64(f.UOffFolderStart), int64(f.CBFile)
+			if int(f.IFolder) > it.fldr || (int(f.IFolder) == it.fldr && (o+n > it.start || o >= it.start)) {
+				break
+			}
+		}
+		var files []int
+		for i := next; i < len(sw.files) && int(sw.files[i].IFolder) == it.fldr; i++ {
+			if f := sw.files[i]; it.intersects(f) {
+				files = append(files, i)
+			} else if int64(f.UOffFolderStart) >= it.end {
+				break
+			}
+		}
+
+		// A new Cabinet file starts with the continued folder and the
+		// files continued from the previous Cabinet file.
+		newFiles, newFldr := files, len(cur.items) == 0 || lastFldr != it.fldr
+		if len(cur.files) > 0 {
+			newFiles = nil
+			for _, i := range files {
+				if i > cur.files[len(cur.files)-1] {
+					newFiles = append(newFiles, i)
+				}
+			}
+		}
+		fldrSize := int64(cfFolderSize) + int64(sw.reserveFolder)
+		cost := int64(it.size)
+		if newFldr {
+			cost += fldrSize
+		}
+		for _, i := range newFiles {
+			cost += int64(sw.files[i].size())
+		}
+		if len(cur.items) > 0 && size+cost > sw.maxSize {
+			cur = &setCabinet{}
+			cabs = append(cabs, cur)
+			size = headerSize(len(cabs) - 1)
+			newFiles = files
+			cost = int64(it.size) + fldrSize
+			for _, i := range files {
+				cost += int64(sw.files[i].size())
+			}
+		}
+		size += cost
+		cur.items = append(cur.items, it)
+		cur.files = append(cur.files, newFiles...)
+		lastFldr = it.fldr
+	}
+	return cabs
+}
+
+// cabinet returns the structures of the i-th Cabinet file of the set.
+func (sw *SetWriter) cabinet(i int, cabs []*setCabinet) *cabinet {
+	sc := cabs[i]
+	cab := &cabinet{hdr: sw.header()}
+	cab.hdr.ICabinet += uint16(i)
+	if i > 0 {
+		cab.hdr.Flags |= hdrPrevCabinet
+		cab.hdr.CabinetPrev = sw.name(i - 1)
+	}
+	if i < len(cabs)-1 {
+		cab.hdr.Flags |= hdrNextCabinet
+		cab.hdr.CabinetNext = sw.name(i + 1)
+	}
+
+	// Folders and the uncompressed range of their blocks in this Cabinet
+	// file.
+	type span struct {
+		first, last bool
+		start, end  int64
+	}
+	var spans []span
+	var firstFldr int
+	for j, it := range sc.items {
+		if j == 0 {
+			firstFldr = it.fldr
+		}
+		if j == 0 || it.fldr != sc.items[j-1].fldr {
+			cab.fldrs = append(cab.fldrs, cfFolder{
+				COFFCabStart: cab.dataSize,
+				TypeCompress: sw.fldrs[it.fldr].TypeCompress,
+			})
+			spans = append(spans, span{first: it.first, start: it.start})
+		}
+		cab.fldrs[len(cab.fldrs)-1].CCFData += it.blocks
+		spans[len(spans)-1].last = it.last
+		spans[len(spans)-1].end = it.end
+		cab.dataSize += it.size
+	}
+
+	for _, idx := range sc.files {
+		f := sw.files[idx]
+		e := *f.cfFile
+		local := int(f.IFolder) - firstFldr
+		sp := spans[local]
+		e.IFolder = uint16(local)
+		fromPrev := !sp.first && int64(f.UOffFolderStart) < sp.start
+		toNext := !sp.last && int64(f.UOffFolderStart)+int64(f.CBFile) > sp.end
+		switch {
+		case fromPrev && toNext:
+			e.IFolder = ifoldContinuedPrevAndNext
+		case fromPrev:
+			e.IFolder = ifoldContinuedFromPrev
+		case toNext:
+			e.IFolder = ifoldContinuedToNext
+		}
+		cab.files = append(cab.files, &file{cfFile: &e, name: f.name})
+	}
+	return cab
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// nopCloser turns a bytes.Buffer into an io.WriteCloser.
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+// writeSet writes files to a Cabinet set with the given size limit and
+// returns the Cabinet files by name, along with the names in order.
+func writeSet(t *testing.T, maxSize int64, files []testFile, opts ...WriterOption) (map[string][]byte, []string) {
+	t.Helper()
+	bufs := make(map[string]*bytes.Buffer)
+	var names []string
+	sw := NewSetWriter(maxSize, func(i int) string {
+		return fmt.Sprintf("disk%d.cab", i+1)
+	}, func(name string) (io.WriteCloser, error) {
+		bufs[name] = new(bytes.Buffer)
+		names = append(names, name)
+		return nopCloser{bufs[name]}, nil
+	}, opts...)
+	for _, f := range files {
+		if err := sw.AddFile(f.name, time.Now(), bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cabs := make(map[string][]byte)
+	for name, buf := range bufs {
+		cabs[name] = buf.Bytes()
+	}
+	return cabs, names
+}
+
+// rawCabinet holds the structures of a Cabinet file parsed without any
+// validation.
+type rawCabinet struct {
+	hdr        cfHeader
+	prev, next string
+	fldrs      []cfFolder
+	files      []cfFile
+	names      []string
+}
+
+func parseRaw(t *testing.T, data []byte) *rawCabinet {
+	t.Helper()
+	var c rawCabinet
+	r := bytes.NewReader(data)
+	h := &c.hdr
+	for _, v := range []interface{}{
+		&h.Signature, &h.Reserved1, &h.CBCabinet, &h.Reserved2, &h.COFFFiles,
+		&h.Reserved3, &h.VersionMinor, &h.VersionMajor, &h.CFolders, &h.CFiles,
+		&h.Flags, &h.SetID, &h.ICabinet,
+	} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			t.Fatalf("Could not parse header: %v", err)
+		}
+	}
+	n := cfHeaderSize
+	if h.Flags&hdrReservePresent != 0 {
+		binary.Read(r, binary.LittleEndian, &h.CBCFHeader)
+		binary.Read(r, binary.LittleEndian, &h.CBCFFolder)
+		binary.Read(r, binary.LittleEndian, &h.CBCFData)
+		n += 4 + int(h.CBCFHeader)
+	}
+	br := bufio.NewReader(io.NewSectionReader(r, int64(n), int64(len(data))))
+	readString := func() string {
+		s, err := br.ReadString(0)
+		if err != nil {
+			t.Fatalf("Could not parse string: %v", err)
+		}
+		return s[:len(s)-1]
+	}
+	if h.Flags&hdrPrevCabinet != 0 {
+		c.prev = readString()
+		n += len(c.prev) + len(readString()) + 2
+	}
+	if h.Flags&hdrNextCabinet != 0 {
+		c.next = readString()
+		n += len(c.next) + len(readString()) + 2
+	}
+	r.Seek(int64(n), io.SeekStart)
+	c.fldrs = make([]cfFolder, h.CFolders)
+	for i := range c.fldrs {
+		binary.Read(r, binary.LittleEndian, &c.fldrs[i])
+		r.Seek(int64(h.CBCFFolder), io.SeekCurrent)
+	}
+	br = bufio.NewReader(io.NewSectionReader(r, int64(h.COFFFiles), int64(len(data))))
+	for i := 0; i < int(h.CFiles); i++ {
+		var f cfFile
+		binary.Read(br, binary.LittleEndian, &f)
+		c.files = append(c.files, f)
+		c.names = append(c.names, readString())
+	}
+	return &c
+}
+
+func TestSetWriter(t *testing.T) {
+	data := make([]byte, 5*maxBlockSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	files := []testFile{
+		{"first.txt", []byte("first")},
+		{"random.bin", data},
+		{"last.txt", []byte("last")},
+	}
+	const maxSize = 2*maxBlockSize + 1000
+	cabs, names := writeSet(t, maxSize, files, WithSetID(42), WithCabinetIndex(1))
+	if len(names) != 3 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want 3", len(names))
+	}
+	var blocks int
+	for i, name := range names {
+		c := parseRaw(t, cabs[name])
+		if int(c.hdr.CBCabinet) != len(cabs[name]) || len(cabs[name]) > maxSize {
+			t.Errorf("%s: CBCabinet = %d, size = %d; want equal and at most %d", name, c.hdr.CBCabinet, len(cabs[name]), maxSize)
+		}
+		if c.hdr.SetID != 42 || int(c.hdr.ICabinet) != i+1 {
+			t.Errorf("%s: SetID, ICabinet = %d, %d; want 42, %d", name, c.hdr.SetID, c.hdr.ICabinet, i+1)
+		}
+		var wantPrev, wantNext string
+		if i > 0 {
+			wantPrev = names[i-1]
+		}
+		if i < len(names)-1 {
+			wantNext = names[i+1]
+		}
+		if c.prev != wantPrev || c.next != wantNext {
+			t.Errorf("%s: previous, next = %q, %q; want %q, %q", name, c.prev, c.next, wantPrev, wantNext)
+		}
+		if len(c.fldrs) != 1 {
+			t.Fatalf("%s: %d folders; want 1", name, len(c.fldrs))
+		}
+		blocks += int(c.fldrs[0].CCFData)
+	}
+	if blocks != 6 {
+		t.Errorf("Cabinet files hold %d blocks in total; want 6", blocks)
+	}
+
+	// The random data spans all Cabinet files.
+	for i, want := range []struct {
+		names   []string
+		ifolder []uint16
+	}{
+		{[]string{"first.txt", "random.bin"}, []uint16{0, ifoldContinuedToNext}},
+		{[]string{"random.bin"}, []uint16{ifoldContinuedPrevAndNext}},
+		{[]string{"random.bin", "last.txt"}, []uint16{ifoldContinuedFromPrev, 0}},
+	} {
+		c := parseRaw(t, cabs[names[i]])
+		var ifolder []uint16
+		for _, f := range c.files {
+			ifolder = append(ifolder, f.IFolder)
+		}
+		if fmt.Sprint(c.names, ifolder) != fmt.Sprint(want.names, want.ifolder) {
+			t.Errorf("%s: files, folder indices = %q, %#04x; want %q, %#04x", names[i], c.names, ifolder, want.names, want.ifolder)
+		}
+	}
+}
+
+func TestSetWriterSingle(t *testing.T) {
+	files := testFiles()
+	cabs, names := writeSet(t, 1<<20, files)
+	if len(names) != 1 {
+		t.Fatalf("SetWriter wrote %d Cabinet files; want 1", len(names))
+	}
+	checkCabinet(t, bytes.NewReader(cabs[names[0]]), files)
+}
@@ -0,0 +1,261 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf16"
+)
+
+// Signer holds the key and the certificates used to sign Cabinet files
+// with Authenticode.
+type Signer struct {
+	// Key is the private key of the signing certificate. RSA and ECDSA
+	// keys are supported.
+	Key crypto.Signer
+
+	// Certificates holds the signing certificate, followed by any
+	// intermediate certificates to embed in the signature.
+	Certificates []*x509.Certificate
+
+	// Hash is the digest algorithm, crypto.SHA256 if zero.
+	Hash crypto.Hash
+
+	// Timestamp, if not nil, obtains an RFC 3161 timestamp token for the
+	// signature value, typically from a timestamping authority. The token
+	// returned is a DER-encoded ContentInfo, which is embedded as an
+	// unauthenticated attribute.
+	Timestamp func(signature []byte) ([]byte, error)
+}
+
+// WithSigner signs the Cabinet files written with Authenticode, allocating
+// the header reserve area holding the location of the signature, which is
+// appended to every Cabinet file. It cannot be combined with a header
+// reserve area allocated by WithReserve.
+func WithSigner(s *Signer) WriterOption {
+	return func(w *Writer) {
+		w.signer = s
+	}
+}
+
+// Object identifiers of the structures written when signing.
+var (
+	oidSpcSpOpusInfo         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 12}
+	oidSpcStatementType      = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 11}
+	oidSpcIndividualCodeSign = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 1, 21}
+	oidRSAEncryption         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA1         = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512       = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+)
+
+// hash returns the digest algorithm of the signer.
+func (s *Signer) hash() crypto.Hash {
+	if s.Hash == 0 {
+		return crypto.SHA256
+	}
+	return s.Hash
+}
+
+// check validates the settings of the signer.
+func (s *Signer) check() error {
+	if s.Key == nil {
+		return errors.New("signer has no key")
+	}
+	if len(s.Certificates) == 0 {
+		return errors.New("signer has no certificate")
+	}
+	if _, err := oidFromHash(s.hash()); err != nil {
+		return err
+	}
+	if _, err := s.signatureAlgorithm(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// signatureAlgorithm returns the identifier of the signature algorithm of
+// the signer.
+func (s *Signer) signatureAlgorithm() (pkix.AlgorithmIdentifier, error) {
+	switch s.Key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	case *ecdsa.PublicKey:
+		switch s.hash() {
+		case crypto.SHA1:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA1}, nil
+		case crypto.SHA256:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}, nil
+		case crypto.SHA384:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA384}, nil
+		case crypto.SHA512:
+			return pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA512}, nil
+		}
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported signing key of type %T", s.Key.Public())
+	}
+	return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported digest algorithm %v for ECDSA", s.hash())
+}
+
+// sign returns the DER-encoded PKCS #7 signature of a Cabinet file with
+// the given Authenticode digest.
+func (s *Signer) sign(digest []byte) ([]byte, error) {
+	oid, err := oidFromHash(s.hash())
+	if err != nil {
+		return nil, err
+	}
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue}
+	sigAlg, err := s.signatureAlgorithm()
+	if err != nil {
+		return nil, err
+	}
+
+	// The content, recording the digest of the Cabinet file.
+	obsolete := utf16.Encode([]rune("<<<Obsolete>>>"))
+	link := make([]byte, 2*len(obsolete))
+	for i, c := range obsolete {
+		binary.BigEndian.PutUint16(link[2*i:], c)
+	}
+	file, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: link})
+	if err != nil {
+		return nil, err
+	}
+	idc, err := asn1.Marshal(spcIndirectDataContent{
+		Data: spcAttributeTypeAndOptionalValue{
+			Type:  oidSpcCabData,
+			Value: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: file},
+		},
+		MessageDigest: digestInfo{DigestAlgorithm: digestAlg, Digest: digest},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not encode SpcIndirectDataContent: %v", err)
+	}
+
+	// The authenticated attributes, covering the digest of the content
+	// without its tag and length.
+	var content asn1.RawValue
+	if _, err := asn1.Unmarshal(idc, &content); err != nil {
+		return nil, err
+	}
+	h := s.hash().New()
+	h.Write(content.Bytes)
+	opus, err := asn1.Marshal(struct{}{})
+	if err != nil {
+		return nil, err
+	}
+	attrs, err := marshalAttributes(
+		attributeValue{oidContentType, oidSpcIndirectDataContent},
+		attributeValue{oidMessageDigest, h.Sum(nil)},
+		attributeValue{oidSpcSpOpusInfo, asn1.RawValue{FullBytes: opus}},
+		attributeValue{oidSpcStatementType, []asn1.ObjectIdentifier{oidSpcIndividualCodeSign}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode authenticated attributes: %v", err)
+	}
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	h = s.hash().New()
+	h.Write(signed)
+	sig, err := s.Key.Sign(rand.Reader, h.Sum(nil), s.hash())
+	if err != nil {
+		return nil, fmt.Errorf("could not sign: %v", err)
+	}
+
+	signer := s.Certificates[0]
+	si := signerInfo{
+		Version:                   1,
+		IssuerAndSerialNumber:     issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: signer.RawIssuer}, SerialNumber: signer.SerialNumber},
+		DigestAlgorithm:           digestAlg,
+		AuthenticatedAttributes:   asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+		DigestEncryptionAlgorithm: sigAlg,
+		EncryptedDigest:           sig,
+	}
+	if s.Timestamp != nil {
+		token, err := s.Timestamp(sig)
+		if err != nil {
+			return nil, fmt.Errorf("could not obtain timestamp: %v", err)
+		}
+		var tok asn1.RawValue
+		if rest, err := asn1.Unmarshal(token, &tok); err != nil || len(rest) > 0 {
+			return nil, errors.New("timestamp token is not a single DER value")
+		}
+		unauth, err := marshalAttributes(attributeValue{oidRFC3161CounterSign, tok})
+		if err != nil {
+			return nil, fmt.Errorf("could not encode timestamp: %v", err)
+		}
+		si.UnauthenticatedAttributes = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: unauth}
+	}
+
+	var certs []byte
+	for _, cert := range s.Certificates {
+		certs = append(certs, cert.Raw...)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		ContentInfo:      contentInfo{ContentType: oidSpcIndirectDataContent, Content: explicit(idc)},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos:      []signerInfo{si},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not encode SignedData: %v", err)
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: explicit(sd)})
+}
+
+// explicit returns the value with the DER encoding der, explicitly tagged
+// as the context-specific [0] element of a ContentInfo.
+func explicit(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// attributeValue is an attribute with a single value to be encoded.
+type attributeValue struct {
+	typ   asn1.ObjectIdentifier
+	value interface{}
+}
+
+// marshalAttributes encodes attributes in the order DER requires of the
+// elements of a SET OF.
+func marshalAttributes(attrs ...attributeValue) ([]byte, error) {
+	var encoded [][]byte
+	for _, a := range attrs {
+		val, err := asn1.Marshal(a.value)
+		if err != nil {
+			return nil, err
+		}
+		attr, err := asn1.Marshal(attribute{Type: a.typ, Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: val}})
+		if err != nil {
+			return nil, err
+		}
+		encoded = append(encoded, attr)
+	}
+	sort.Slice(encoded, func(i, j int) bool { return bytes.Compare(encoded[i], encoded[j]) < 0 })
+	return bytes.Join(encoded, nil), nil
+}
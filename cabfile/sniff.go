@@ -0,0 +1,41 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// Sniff reports whether r starts with a Cabinet file, checking the signature
+// and the sanity of the fixed part of the header without parsing any further.
+// It reads at most 36 bytes from r. Streams too short to hold a header are
+// not Cabinet files, while other errors reading r are returned.
+func Sniff(r io.Reader) (bool, error) {
+	var b [cfHeaderSize]byte
+	if _, err := io.ReadFull(r, b[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(b[:4], []byte("MSCF")) {
+		return false, nil
+	}
+	cbCabinet := binary.LittleEndian.Uint32(b[8:])
+	coffFiles := binary.LittleEndian.Uint32(b[16:])
+	versionMajor := b[25]
+	return versionMajor == 1 && cbCabinet >= cfHeaderSize && coffFiles >= cfHeaderSize && coffFiles <= cbCabinet, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSniff(t *testing.T) {
+	cab := buildCabinet(t, CompressionNone, 256, testFiles())
+	bad := append([]byte(nil), cab...)
+	bad[25] = 2 // version 2.3
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"cabinet", cab, true},
+		{"header", cab[:cfHeaderSize], true},
+		{"empty", nil, false},
+		{"short", cab[:cfHeaderSize-1], false},
+		{"zip", append([]byte("PK\x03\x04"), cab[4:]...), false},
+		{"version", bad, false},
+	} {
+		if got, err := Sniff(bytes.NewReader(tc.data)); got != tc.want || err != nil {
+			t.Errorf("Sniff(%s) = %t, %v; want %t, nil", tc.name, got, err, tc.want)
+		}
+	}
+
+	errRead := errors.New("read error")
+	if _, err := Sniff(iotest.ErrReader(errRead)); err != errRead {
+		t.Errorf("Sniff() of a failing reader = %v; want %v", err, errRead)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// FileEntry holds the fields of the CFFILE entry of a member as they are
+// stored. It is returned by the Sys method of the fs.FileInfo of a member.
+type FileEntry struct {
+	CBFile          uint32 // uncompressed size of the member in bytes
+	UOffFolderStart uint32 // uncompressed offset of the member in the folder
+	IFolder         uint16 // index of the folder, or a special value of continued members
+	Date            uint16 // MS-DOS date of the member
+	Time            uint16 // MS-DOS time of the member
+	Attribs         uint16 // attribute flags of the member
+}
+
+// fileStat implements fs.FileInfo for a member of a Cabinet file.
+type fileStat struct {
+	fi    FileInfo
+	entry FileEntry
+}
+
+// Name returns the base name of the member, following the last backslash or
+// slash.
+func (s *fileStat) Name() string {
+	return s.fi.Name[strings.LastIndexAny(s.fi.Name, `\/`)+1:]
+}
+
+func (s *fileStat) Size() int64        { return s.fi.Size }
+func (s *fileStat) ModTime() time.Time { return s.fi.Modified }
+func (s *fileStat) IsDir() bool        { return false }
+func (s *fileStat) Sys() interface{}   { return &s.entry }
+
+// Mode returns the permissions of a regular file derived from the
+// attributes: members are writable by their owner unless read-only, and
+// executable if they are to be run after extraction.
+func (s *fileStat) Mode() fs.FileMode {
+	mode := fs.FileMode(0644)
+	if s.fi.Attributes.ReadOnly() {
+		mode = 0444
+	}
+	if s.fi.Attributes.Exec() {
+		mode |= 0111
+	}
+	return mode
+}
+
+// Stat returns information about the member or directory of the given
+// slash-separated path, as opened by Open, without decompressing anything,
+// implementing fs.StatFS. As with os.Stat, a missing member is reported as
+// an *fs.PathError wrapping fs.ErrNotExist.
+func (c *Cabinet) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := c.fsEntries()[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return c.fsStat(name, e), nil
+}
+
+// stat returns the fs.FileInfo of the member f.
+func (c *Cabinet) stat(f *file) *fileStat {
+	return &fileStat{fi: c.fileInfo(f), entry: FileEntry(*f.cfFile)}
+}
@@ -0,0 +1,77 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+)
+
+func TestStat(t *testing.T) {
+	files := []testFile{{`dir\a.txt`, []byte("hello")}, {"b.txt", []byte("world!")}}
+	modified := time.Date(2019, 5, 1, 12, 34, 56, 0, time.UTC)
+	cab := writeCabinet(t, files, WithReproducible(modified))
+
+	fi, err := cab.Stat("dir/a.txt")
+	if err != nil {
+		t.Fatalf("Stat() failed: %v", err)
+	}
+	if fi.Name() != "a.txt" || fi.Size() != 5 || !fi.ModTime().Equal(modified) || fi.IsDir() || !fi.Mode().IsRegular() {
+		t.Errorf("Stat() = %q, %d bytes, modified %v, directory %t, mode %v; want a.txt, 5 bytes, modified %v, regular file",
+			fi.Name(), fi.Size(), fi.ModTime(), fi.IsDir(), fi.Mode(), modified)
+	}
+
+	fi, err = cab.Stat("b.txt")
+	if err != nil {
+		t.Fatalf("Stat() failed: %v", err)
+	}
+	want := FileEntry{CBFile: 6, UOffFolderStart: 5, Date: 0x4ea1, Time: 0x645c, Attribs: uint16(AttrArchive)}
+	if e, ok := fi.Sys().(*FileEntry); !ok || *e != want {
+		t.Errorf("Stat().Sys() = %+v; want %+v", fi.Sys(), &want)
+	}
+
+	_, err = cab.Stat("missing")
+	var perr *fs.PathError
+	if !errors.Is(err, fs.ErrNotExist) || !errors.As(err, &perr) || perr.Path != "missing" {
+		t.Errorf("Stat() of a missing member = %v; want *fs.PathError wrapping fs.ErrNotExist", err)
+	}
+
+	// Names rejected by Open are rejected by Stat, too.
+	for name, wantErr := range map[string]error{`dir\a.txt`: fs.ErrNotExist, "../b.txt": fs.ErrInvalid} {
+		if _, err := cab.Stat(name); !errors.Is(err, wantErr) {
+			t.Errorf("Stat(%q) = %v; want %v", name, err, wantErr)
+		}
+	}
+}
+
+func TestStatMode(t *testing.T) {
+	for _, tc := range []struct {
+		attrs Attributes
+		want  fs.FileMode
+	}{
+		{0, 0644},
+		{AttrArchive | AttrHidden, 0644},
+		{AttrReadOnly, 0444},
+		{AttrExec, 0755},
+		{AttrReadOnly | AttrExec, 0555},
+	} {
+		s := &fileStat{fi: FileInfo{Attributes: tc.attrs}}
+		if got := s.Mode(); got != tc.want {
+			t.Errorf("Mode() with attributes %#04x = %v; want %v", uint16(tc.attrs), got, tc.want)
+		}
+	}
+}
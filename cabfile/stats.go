@@ -0,0 +1,73 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import "fmt"
+
+// SizeStats summarizes the size of the data blocks of one or more folders.
+type SizeStats struct {
+	Blocks       int
+	Compressed   int64 // bytes of compressed data, excluding the CFDATA headers and reserve areas
+	Uncompressed int64
+}
+
+// Ratio returns the ratio of compressed to uncompressed bytes, which is less
+// than 1 if compression saves space, or 0 if there is no data.
+func (s SizeStats) Ratio() float64 {
+	if s.Uncompressed == 0 {
+		return 0
+	}
+	return float64(s.Compressed) / float64(s.Uncompressed)
+}
+
+// FolderStats summarizes the size of the data blocks of a folder.
+type FolderStats struct {
+	Compression Compression
+	SizeStats
+}
+
+// Stats summarizes the size of the data blocks of every folder of a Cabinet
+// file and of all folders together.
+type Stats struct {
+	Folders []FolderStats
+	Total   SizeStats
+}
+
+// Stats reads the headers of all data blocks of the Cabinet file to
+// summarize their sizes. Nothing is decompressed.
+func (c *Cabinet) Stats() (*Stats, error) {
+	s := &Stats{Folders: []FolderStats{}}
+	for i, fldr := range c.fldrs {
+		size, end, err := c.folderExtent(uint16(i))
+		if err != nil {
+			return nil, fmt.Errorf("could not read data blocks of folder %d: %v", i, err)
+		}
+		// Every block is preceded by its header and reserve area.
+		headers := int64(fldr.CCFData) * (cfDataSize + int64(c.hdr.CBCFData))
+		fs := FolderStats{
+			Compression: parseCompression(fldr.TypeCompress),
+			SizeStats: SizeStats{
+				Blocks:       int(fldr.CCFData),
+				Compressed:   end - int64(fldr.COFFCabStart) - headers,
+				Uncompressed: size,
+			},
+		}
+		s.Folders = append(s.Folders, fs)
+		s.Total.Blocks += fs.Blocks
+		s.Total.Compressed += fs.Compressed
+		s.Total.Uncompressed += fs.Uncompressed
+	}
+	return s, nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	random := make([]byte, 2*maxBlockSize)
+	rand.New(rand.NewSource(1)).Read(random)
+	files := []testFile{
+		{"zeros.bin", make([]byte, 2*maxBlockSize+1)},
+		{"random.bin", random},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(CompressionMSZIP))
+	for i, f := range files {
+		fw, err := w.CreateHeader(&FileHeader{Name: f.name, Store: i == 1})
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", f.name, err)
+		}
+		fw.Write(f.data)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(buf.Bytes()), files)
+	s, err := cab.Stats()
+	if err != nil {
+		t.Fatalf("Stats() failed: %v", err)
+	}
+	if len(s.Folders) != 2 {
+		t.Fatalf("Stats() reports %d folders; want 2", len(s.Folders))
+	}
+	zeros, stored := s.Folders[0], s.Folders[1]
+	if zeros.Compression.Type != CompressionMSZIP || zeros.Blocks != 3 || zeros.Uncompressed != int64(len(files[0].data)) || zeros.Ratio() > 0.1 {
+		t.Errorf("Stats() of the compressed folder = %+v with ratio %f; want MSZIP, 3 blocks, %d bytes, ratio below 0.1", zeros, zeros.Ratio(), len(files[0].data))
+	}
+	if stored.Compression.Type != CompressionNone || stored.Blocks != 2 || stored.Compressed != int64(len(random)) || stored.Ratio() != 1 {
+		t.Errorf("Stats() of the stored folder = %+v with ratio %f; want NONE, 2 blocks, %d bytes, ratio 1", stored, stored.Ratio(), len(random))
+	}
+	want := SizeStats{
+		Blocks:       zeros.Blocks + stored.Blocks,
+		Compressed:   zeros.Compressed + stored.Compressed,
+		Uncompressed: zeros.Uncompressed + stored.Uncompressed,
+	}
+	if s.Total != want {
+		t.Errorf("Stats().Total = %+v; want %+v", s.Total, want)
+	}
+	if r := (SizeStats{}).Ratio(); r != 0 {
+		t.Errorf("Ratio() without data = %f; want 0", r)
+	}
+}
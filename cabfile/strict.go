@@ -0,0 +1,118 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrOverlap is returned in strict mode if structures of a Cabinet file,
+// such as the CFFILE table and the data of a folder, share bytes. Parsers
+// disagree on such files, which is why they are used to confuse scanners.
+var ErrOverlap = errors.New("cabfile: overlapping structures")
+
+// Strict validates the layout of Cabinet files beyond what is needed to read
+// them: the size recorded in the header must not exceed the length of the
+// stream, and the CFFILE entries and the data of every folder must lie
+// within the Cabinet file, as must the structures declared by the counts of
+// folders and files. The header reserve area must not exceed 60000 bytes.
+// The header, the CFFOLDER and CFFILE tables and the data of every folder
+// must not overlap, which is reported as ErrOverlap. The reserved header
+// fields have to be zero.
+func Strict() Option {
+	return func(c *Cabinet) {
+		c.strict = true
+	}
+}
+
+// checkHeader validates the header fields of a Cabinet file read from a
+// stream of the given size in strict mode. end is the offset of the end of
+// the CFHEADER structure.
+func checkHeader(hdr *cfHeader, end, size int64) error {
+	if hdr.CBCFHeader > maxHeaderReserve {
+		return fmt.Errorf("cbCFHeader %d exceeds the maximum of %d bytes", hdr.CBCFHeader, maxHeaderReserve)
+	}
+	cb := int64(hdr.CBCabinet)
+	if cb > size {
+		return fmt.Errorf("cbCabinet %d exceeds the stream length %d", cb, size)
+	}
+	if fldrs := end + int64(hdr.CFolders)*(cfFolderSize+int64(hdr.CBCFFolder)); fldrs > cb {
+		return fmt.Errorf("cFolders %d declares folders up to offset %d beyond cbCabinet %d", hdr.CFolders, fldrs, cb)
+	}
+	if off := int64(hdr.COFFFiles); off < end || off > cb {
+		return fmt.Errorf("coffFiles %d lies outside of the Cabinet file from %d to %d", off, end, cb)
+	}
+	// Every CFFILE entry holds at least the terminating NUL of its name.
+	if files := int64(hdr.COFFFiles) + int64(hdr.CFiles)*(cfFileSize+1); files > cb {
+		return fmt.Errorf("cFiles %d declares files up to offset %d beyond cbCabinet %d", hdr.CFiles, files, cb)
+	}
+	return nil
+}
+
+// checkFolder validates the offset of the data of a folder in strict mode.
+func checkFolder(hdr *cfHeader, i int, fldr *cfFolder) error {
+	cb := int64(hdr.CBCabinet)
+	end := int64(fldr.COFFCabStart) + int64(fldr.CCFData)*(cfDataSize+int64(hdr.CBCFData))
+	if end > cb {
+		return fmt.Errorf("coffCabStart %d of folder %d with %d data blocks exceeds cbCabinet %d", fldr.COFFCabStart, i, fldr.CCFData, cb)
+	}
+	return nil
+}
+
+// region is a range of bytes of a Cabinet file taken by a structure.
+type region struct {
+	name       string
+	start, end int64
+}
+
+// checkOverlaps validates in strict mode that the header, the CFFOLDER and
+// CFFILE tables and the data of the folders do not overlap, given the
+// offsets of the end of the header and of both tables. Folders whose data
+// cannot be located are left to fail when reading it.
+func (c *Cabinet) checkOverlaps(hdrEnd, fldrsEnd, filesEnd int64) error {
+	regions := []region{
+		{"CFHEADER", 0, hdrEnd},
+		{"CFFOLDER table", hdrEnd, fldrsEnd},
+		{"CFFILE table", int64(c.hdr.COFFFiles), filesEnd},
+	}
+	for i, fldr := range c.fldrs {
+		_, end, err := c.folderExtent(uint16(i))
+		if err != nil {
+			continue
+		}
+		regions = append(regions, region{fmt.Sprintf("data of folder %d", i), int64(fldr.COFFCabStart), end})
+	}
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].start < regions[j].start })
+	var last *region // region reaching furthest so far
+	for i := range regions {
+		r := &regions[i]
+		if r.start == r.end {
+			continue
+		}
+		if last != nil && r.start < last.end {
+			return &ParseError{
+				Structure: r.name,
+				Offset:    r.start,
+				Err:       fmt.Errorf("ends at %d, overlapping %s from %d to %d: %w", r.end, last.name, last.start, last.end, ErrOverlap),
+			}
+		}
+		if last == nil || r.end > last.end {
+			last = r
+		}
+	}
+	return nil
+}
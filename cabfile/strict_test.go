@@ -0,0 +1,81 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStrict(t *testing.T) {
+	data := writeCabinetData(t, testFiles())
+	if _, err := New(bytes.NewReader(data), Strict()); err != nil {
+		t.Fatalf("New() with Strict() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		field string
+		off   int // offset of the field in the Cabinet file
+		val   uint32
+		size  int // size of the field in bytes
+	}{
+		{"cbCabinet", 8, uint32(len(data) + 1), 4},
+		{"coffFiles", 16, uint32(len(data) + 1), 4},
+		{"cFolders", 26, 0xffff, 2},
+		{"cFiles", 28, 0xffff, 2},
+		{"coffCabStart", cfHeaderSize, uint32(len(data)), 4},
+	} {
+		t.Run(tc.field, func(t *testing.T) {
+			data := append([]byte(nil), data...)
+			if tc.size == 2 {
+				binary.LittleEndian.PutUint16(data[tc.off:], uint16(tc.val))
+			} else {
+				binary.LittleEndian.PutUint32(data[tc.off:], tc.val)
+			}
+			_, err := New(bytes.NewReader(data), Strict())
+			var perr *ParseError
+			if !errors.As(err, &perr) || !strings.HasPrefix(perr.Err.Error(), tc.field) {
+				t.Errorf("New() with Strict() = %v; want error naming %s", err, tc.field)
+			}
+		})
+	}
+
+	// Only strict mode checks the size of the Cabinet file.
+	binary.LittleEndian.PutUint32(data[8:], uint32(len(data)+1))
+	if _, err := New(bytes.NewReader(data)); err != nil {
+		t.Errorf("New() of a Cabinet file exceeding the stream failed: %v", err)
+	}
+}
+
+func TestStrictOverlap(t *testing.T) {
+	data := writeCabinetData(t, testFiles(), WithFolderPerFile())
+	if _, err := New(bytes.NewReader(data), Strict()); err != nil {
+		t.Fatalf("New() with Strict() failed: %v", err)
+	}
+
+	// Let the second folder alias the data of the first.
+	copy(data[cfHeaderSize+cfFolderSize:], data[cfHeaderSize:cfHeaderSize+4])
+	_, err := New(bytes.NewReader(data), Strict())
+	var perr *ParseError
+	if !errors.Is(err, ErrOverlap) || !errors.As(err, &perr) || perr.Offset != int64(binary.LittleEndian.Uint32(data[cfHeaderSize:])) {
+		t.Errorf("New() with Strict() of aliased folders = %v; want ErrOverlap at the data of the first folder", err)
+	}
+	if errors.Is(err, ErrOverlap) && !strings.Contains(err.Error(), "data of folder 0") {
+		t.Errorf("New() with Strict() of aliased folders = %v; want error naming the data of folder 0", err)
+	}
+}
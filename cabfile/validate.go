@@ -0,0 +1,151 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ChecksumStatus summarizes the checksums of the data blocks of a folder.
+type ChecksumStatus int
+
+// Checksum states of a folder.
+const (
+	ChecksumsAbsent  ChecksumStatus = iota // no block has a checksum
+	ChecksumsValid                         // all checksums present are valid
+	ChecksumsInvalid                       // some checksum is invalid
+)
+
+func (s ChecksumStatus) String() string {
+	switch s {
+	case ChecksumsAbsent:
+		return "absent"
+	case ChecksumsValid:
+		return "valid"
+	case ChecksumsInvalid:
+		return "invalid"
+	}
+	return fmt.Sprintf("ChecksumStatus(%d)", int(s))
+}
+
+// FolderCheck describes a folder checked by Validate.
+type FolderCheck struct {
+	Compression Compression
+	Blocks      int
+	Checksums   ChecksumStatus
+
+	// Unsupported is set if the folder is compressed with a method this
+	// package cannot decompress, such as LZX or Quantum. Its checksums are
+	// still checked.
+	Unsupported bool
+}
+
+// ValidationReport describes the health of a Cabinet file checked by
+// Validate.
+type ValidationReport struct {
+	VersionMajor uint8
+	VersionMinor uint8
+	Folders      int
+	Files        int
+	Compressions []Compression // compressions used, in order of first use
+	FolderChecks []FolderCheck
+
+	// Warnings lists problems which do not prevent reading the Cabinet
+	// file, Errors those which do, at least for some members.
+	Warnings []string
+	Errors   []string
+}
+
+// OK reports whether no errors were found.
+func (r *ValidationReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Validate checks the Cabinet file read from r in a single call, reading it
+// leniently and accepting any version to report as many problems as
+// possible. Every folder is decompressed in full, as by Cabinet.Verify.
+// Folders compressed with unsupported methods are reported with a warning
+// instead of an error. An error is only returned if r does not hold a
+// Cabinet file at all.
+func Validate(r io.ReadSeeker) (*ValidationReport, error) {
+	c, err := New(r, Lenient(), AllowUnknownVersion())
+	if err != nil {
+		return nil, err
+	}
+	rep := &ValidationReport{
+		VersionMajor: c.hdr.VersionMajor,
+		VersionMinor: c.hdr.VersionMinor,
+		Folders:      len(c.fldrs),
+		Files:        len(c.files),
+	}
+	if c.hdr.VersionMajor != 1 || c.hdr.VersionMinor != 3 {
+		rep.Warnings = append(rep.Warnings, fmt.Sprintf("unknown version %d.%d", c.hdr.VersionMajor, c.hdr.VersionMinor))
+	}
+	used := make(map[Compression]bool)
+	for i, fldr := range c.fldrs {
+		comp := parseCompression(fldr.TypeCompress)
+		if !used[comp] {
+			used[comp] = true
+			rep.Compressions = append(rep.Compressions, comp)
+		}
+		check := FolderCheck{Compression: comp, Blocks: int(fldr.CCFData)}
+		if comp.Type != CompressionNone && comp.Type != CompressionMSZIP {
+			check.Unsupported = true
+			rep.Warnings = append(rep.Warnings, fmt.Sprintf("folder %d compressed with unsupported %v", i, comp))
+		}
+		if check.Checksums, err = c.checksumStatus(uint16(i)); err != nil {
+			rep.Errors = append(rep.Errors, fmt.Sprintf("could not read data blocks of folder %d: %v", i, err))
+		}
+		rep.FolderChecks = append(rep.FolderChecks, check)
+	}
+	for _, err := range c.Verify().Errors {
+		if errors.Is(err, ErrUnsupportedCompression) {
+			continue // already warned about
+		}
+		rep.Errors = append(rep.Errors, err.Error())
+	}
+	for _, err := range c.Warnings() {
+		rep.Warnings = append(rep.Warnings, err.Error())
+	}
+	return rep, nil
+}
+
+// checksumStatus reads the data blocks of the folder with the given index,
+// without decompressing them, and checks their checksums.
+func (c *Cabinet) checksumStatus(idx uint16) (ChecksumStatus, error) {
+	it, err := c.Blocks(int(idx))
+	if err != nil {
+		return ChecksumsAbsent, err
+	}
+	status := ChecksumsAbsent
+	for {
+		b, err := it.Next()
+		if err == io.EOF {
+			return status, nil
+		}
+		if err != nil {
+			return status, err
+		}
+		switch {
+		case b.Checksum == 0:
+		case !b.ChecksumOK():
+			status = ChecksumsInvalid
+		case status == ChecksumsAbsent:
+			status = ChecksumsValid
+		}
+	}
+}
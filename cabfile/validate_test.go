@@ -0,0 +1,78 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	files := testFiles()
+	data := writeCabinetData(t, files, WithCompression(CompressionMSZIP))
+	mszip := Compression{Type: CompressionMSZIP}
+
+	for _, tc := range []struct {
+		name      string
+		data      []byte
+		checksums ChecksumStatus
+		ok        bool
+	}{
+		{"writer", data, ChecksumsValid, true},
+		{"absent", buildCabinet(t, CompressionMSZIP, 256, files), ChecksumsAbsent, true},
+		{"corrupted", append(append([]byte(nil), data[:len(data)-1]...), data[len(data)-1]^0xff), ChecksumsInvalid, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rep, err := Validate(bytes.NewReader(tc.data))
+			if err != nil {
+				t.Fatalf("Validate() failed: %v", err)
+			}
+			if rep.VersionMajor != 1 || rep.VersionMinor != 3 || rep.Folders != 1 || rep.Files != 3 {
+				t.Errorf("Validate() = %+v; want version 1.3, 1 folder and 3 files", rep)
+			}
+			if len(rep.Compressions) != 1 || rep.Compressions[0] != mszip {
+				t.Errorf("Compressions = %v; want [%v]", rep.Compressions, mszip)
+			}
+			if len(rep.FolderChecks) != 1 || rep.FolderChecks[0].Checksums != tc.checksums {
+				t.Errorf("FolderChecks = %+v; want checksums %v", rep.FolderChecks, tc.checksums)
+			}
+			if rep.OK() != tc.ok {
+				t.Errorf("OK() = %t with errors %q; want %t", rep.OK(), rep.Errors, tc.ok)
+			}
+		})
+	}
+
+	t.Run("unsupported", func(t *testing.T) {
+		rep, err := Validate(bytes.NewReader(writeLZXCabinet(t, files)))
+		if err != nil {
+			t.Fatalf("Validate() failed: %v", err)
+		}
+		lzx := Compression{Type: CompressionLZX, LZXWindow: 21}
+		if len(rep.Compressions) != 1 || rep.Compressions[0] != lzx {
+			t.Errorf("Compressions = %v; want [%v]", rep.Compressions, lzx)
+		}
+		if len(rep.FolderChecks) != 1 || !rep.FolderChecks[0].Unsupported || rep.FolderChecks[0].Checksums != ChecksumsValid {
+			t.Errorf("FolderChecks = %+v; want unsupported folder with valid checksums", rep.FolderChecks)
+		}
+		if !rep.OK() || len(rep.Warnings) != 1 {
+			t.Errorf("Validate() = errors %q, warnings %q; want a single warning", rep.Errors, rep.Warnings)
+		}
+	})
+
+	if _, err := Validate(bytes.NewReader([]byte("not a Cabinet file at all, just some text"))); !errors.Is(err, ErrNotCabinet) {
+		t.Errorf("Validate() of text = %v; want ErrNotCabinet", err)
+	}
+}
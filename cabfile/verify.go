@@ -0,0 +1,75 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"fmt"
+	"io"
+)
+
+// VerifyReport describes the outcome of Cabinet.Verify.
+type VerifyReport struct {
+	Folders int   // number of folders checked
+	Blocks  int   // number of CFDATA blocks decompressed
+	Bytes   int64 // number of uncompressed bytes
+	Files   int   // number of members checked
+
+	// Errors lists the problems found, in the order they were found. A
+	// *ChecksumError is reported for every folder with a corrupted block.
+	Errors []error
+}
+
+// OK reports whether no problems were found.
+func (r *VerifyReport) OK() bool {
+	return len(r.Errors) == 0
+}
+
+// Verify checks the integrity of the Cabinet file without extracting any
+// members: every folder is decompressed in full, verifying the checksums of
+// its blocks, and the content of every member has to lie within its folder.
+// A folder is only checked up to its first problem.
+func (c *Cabinet) Verify() *VerifyReport {
+	r := &VerifyReport{}
+	sizes := make([]int64, len(c.fldrs)) // uncompressed size, -1 if unknown
+	for i := range c.fldrs {
+		r.Folders++
+		fr, err := c.folderData(uint16(i))
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Errorf("could not acquire uncompressed data for folder %d: %w", i, err))
+			sizes[i] = -1
+			continue
+		}
+		n, err := io.Copy(io.Discard, fr)
+		r.Blocks += int(fr.blk)
+		r.Bytes += n
+		sizes[i] = n
+		if err != nil {
+			r.Errors = append(r.Errors, fmt.Errorf("could not decompress folder %d: %w", i, err))
+			sizes[i] = -1
+		}
+	}
+	for _, f := range c.files {
+		r.Files++
+		if int(f.IFolder) >= len(c.fldrs) {
+			r.Errors = append(r.Errors, fmt.Errorf("file %q refers to missing folder %d", f.name, f.IFolder))
+			continue
+		}
+		size := sizes[f.IFolder]
+		if end := int64(f.UOffFolderStart) + int64(f.CBFile); size >= 0 && end > size {
+			r.Errors = append(r.Errors, fmt.Errorf("file %q ends at offset %d beyond the end of folder %d at %d", f.name, end, f.IFolder, size))
+		}
+	}
+	return r
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	files := testFiles()
+	data := writeCabinetData(t, files, WithFolderPerFile())
+	cab, err := New(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	r := cab.Verify()
+	var size int64
+	for _, f := range files {
+		size += int64(len(f.data))
+	}
+	if !r.OK() || r.Folders != 3 || r.Blocks != 3 || r.Files != 3 || r.Bytes != size {
+		t.Errorf("Verify() = %+v; want no errors, 3 folders, blocks and files, %d bytes", r, size)
+	}
+
+	// A member exceeding its folder.
+	cab.files[1].CBFile++
+	if r := cab.Verify(); len(r.Errors) != 1 {
+		t.Errorf("Verify() of a member exceeding its folder reported %v; want 1 error", r.Errors)
+	}
+	cab.files[1].CBFile--
+
+	// A corrupted block of the last folder.
+	data[len(data)-1] ^= 0xff
+	r = cab.Verify()
+	var cerr *ChecksumError
+	if len(r.Errors) != 1 || !errors.As(r.Errors[0], &cerr) {
+		t.Fatalf("Verify() of a corrupted block reported %v; want 1 *ChecksumError", r.Errors)
+	}
+	if cerr.Folder != 2 {
+		t.Errorf("ChecksumError for folder %d; want 2", cerr.Folder)
+	}
+}
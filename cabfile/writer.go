@@ -0,0 +1,1289 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// maxBlockSize is the maximum number of uncompressed bytes in a CFDATA block.
+const maxBlockSize = 32768
+
+// Limits of the Cabinet file format.
+const (
+	maxFiles       = 0xffff
+	maxFolders     = 0xfffd // higher indices mark folders continued across Cabinet files
+	maxFileSize    = 0x7fff8000
+	maxFolderSize  = 0x7fff8000
+	maxCabinetSize = 0xffffffff
+)
+
+// Errors returned by the Writer when exceeding the limits of the Cabinet
+// file format.
+var (
+	ErrTooManyFiles    = errors.New("cabfile: too many files")
+	ErrTooManyFolders  = errors.New("cabfile: too many folders")
+	ErrFileTooLarge    = errors.New("cabfile: file too large")
+	ErrFolderTooLarge  = errors.New("cabfile: folder too large")
+	ErrCabinetTooLarge = errors.New("cabfile: Cabinet file too large")
+)
+
+// spillThreshold is the amount of compressed data the Writer holds in memory
+// before moving it to a temporary file.
+const spillThreshold = 8 << 20
+
+// Writer creates Cabinet files. By default, all members are stored in a
+// single folder.
+//
+// Member content is compressed as it is written. As the Cabinet file
+// structures preceding the data can only be written once all members are
+// known, the compressed data is held back until Close: in memory at first,
+// and in a temporary file once it grows large.
+type Writer struct {
+	// compressed counts the bytes of CFDATA blocks emitted. It is accessed
+	// atomically and comes first to be 64-bit aligned.
+	compressed int64
+
+	w      io.Writer
+	files  []*file
+	fldrs  []*writerFolder
+	data   spill       // CFDATA blocks of all folders, in order
+	cur    *fileWriter // writer of the most recently added member
+	err    error       // sticky error, the Writer is unusable once set
+	closed bool
+
+	compression Compression
+	level       int // compression level passed to the Compressor
+	compressors map[CompressionType]Compressor
+
+	setID    uint16
+	iCabinet uint16
+
+	nameEncoding NameEncoding
+	noChecksum   bool
+	dedupe       bool
+	autoStore    bool
+
+	// workers limits the number of folders compressed concurrently, sem
+	// holds a slot for every folder being compressed.
+	workers int
+	sem     chan struct{}
+
+	// Sizes of the reserve areas in the header, every folder and every
+	// data block.
+	reserveHeader uint16
+	reserveFolder uint8
+	reserveData   uint8
+
+	signer *Signer // signs the Cabinet files written, if not nil
+
+	progress   Progress
+	onProgress func(Progress)
+
+	ctx context.Context
+
+	// modified, if not nil, overrides the modification time of all members.
+	modified *time.Time
+
+	// newFolder reports whether a new member should start a new folder
+	// instead of being appended to fldr.
+	newFolder func(fldr *writerFolder) bool
+}
+
+// writerFolder compresses the members of a folder into CFDATA blocks.
+type writerFolder struct {
+	cfFolder // COFFCabStart is relative to the start of the spilled data
+
+	comp       BlockCompressor
+	pending    []byte // uncompressed data not yet making up a full block
+	size       int64  // uncompressed bytes in the folder
+	files      int    // number of members in the folder
+	reserve    uint8  // size of the reserve area of every data block
+	noChecksum bool   // leave the checksum of every data block zero
+	blocks     []writerBlock
+	ended      bool      // whether the remaining data has been emitted
+	out        io.Writer // destination of the CFDATA blocks
+	emitted    *int64    // bytes written to out, accessed atomically
+	ctx        context.Context
+
+	// When compressing in the background, full blocks are sent to work
+	// and done is closed once all have been compressed, with err holding
+	// the first failure.
+	data *spill // CFDATA blocks held back until the Writer is closed
+	work chan []byte
+	done chan struct{}
+	err  error
+
+	// contents maps the SHA-256 digests of the members stored in the folder
+	// to their offsets when deduplicating.
+	contents map[[sha256.Size]byte]uint32
+}
+
+// writerBlock records the size of an emitted CFDATA block.
+type writerBlock struct {
+	size   uint32 // size of the block including its CFDATA header
+	uncomp uint16 // uncompressed bytes in the block
+}
+
+// WriterOption configures a Writer.
+type WriterOption func(*Writer)
+
+// WithCompression sets the compression method of the folders written. It
+// defaults to CompressionNone. CompressionNone and CompressionMSZIP are
+// supported out of the box, other methods require a registered Compressor.
+func WithCompression(t CompressionType) WriterOption {
+	return WithCompressionParameters(Compression{Type: t})
+}
+
+// WithCompressionParameters is like WithCompression, but also sets the
+// parameters of the compression method, like the LZX window size, which are
+// recorded in the folders and passed to the Compressor.
+func WithCompressionParameters(c Compression) WriterOption {
+	return func(w *Writer) {
+		w.compression = c
+	}
+}
+
+// WithCompressionLevel sets the compression level passed to the Compressor.
+// For MS-ZIP it takes the levels defined by compress/flate. It defaults to
+// flate.DefaultCompression.
+func WithCompressionLevel(level int) WriterOption {
+	return func(w *Writer) {
+		w.level = level
+	}
+}
+
+// WithSolidFolder stores all members in a single folder. This yields the best
+// compression ratio, but extracting a member requires decompressing all
+// members stored before it. This is the default.
+func WithSolidFolder() WriterOption {
+	return func(w *Writer) {
+		w.newFolder = func(*writerFolder) bool { return false }
+	}
+}
+
+// WithFolderPerFile stores every member in a folder of its own. This allows
+// for fast random access to the members at the expense of compression ratio.
+func WithFolderPerFile() WriterOption {
+	return func(w *Writer) {
+		w.newFolder = func(fldr *writerFolder) bool { return fldr.files > 0 }
+	}
+}
+
+// WithFolderSize starts a new folder for the next member once the current
+// folder holds at least size uncompressed bytes. As members are never split
+// across folders, folders may exceed size by up to the size of their last
+// member.
+func WithFolderSize(size int64) WriterOption {
+	return func(w *Writer) {
+		w.newFolder = func(fldr *writerFolder) bool { return fldr.size >= size }
+	}
+}
+
+// WithDeduplication stores the content of members identical to a member
+// added before to the same folder only once, pointing both file entries at
+// the same data. To detect duplicates, the content of every member is held
+// in memory until the next member is added or the Writer is closed.
+// Deduplication has no effect with WithFolderPerFile.
+func WithDeduplication() WriterOption {
+	return func(w *Writer) {
+		w.dedupe = true
+	}
+}
+
+// WithAutoStore places members holding already compressed content, like zip
+// or gzip archives and JPEG images, in uncompressed folders instead of
+// compressing them again. Such content is detected by the extension of the
+// member name and, for AddFile, by the leading bytes of the content. As the
+// members of a folder share its compression, a new folder is started
+// whenever a stored member follows a compressed one and vice versa.
+func WithAutoStore() WriterOption {
+	return func(w *Writer) {
+		w.autoStore = true
+	}
+}
+
+// WithConcurrency sets the number of folders compressed concurrently. It
+// defaults to GOMAXPROCS. As the blocks of a folder depend on each other,
+// concurrency only helps when members are spread across several folders.
+// A value of 1 compresses all data on the calling goroutine.
+//
+// Every folder uses a BlockCompressor of its own, so Compressors must not
+// return BlockCompressors sharing state.
+func WithConcurrency(n int) WriterOption {
+	return func(w *Writer) {
+		w.workers = n
+	}
+}
+
+// Progress reports how far a Writer got.
+type Progress struct {
+	Files int   // number of members completely added
+	Bytes int64 // uncompressed bytes of member content consumed
+
+	// Compressed is the number of bytes of CFDATA blocks emitted, including
+	// their headers. It lags behind Bytes as data is compressed in blocks
+	// and, possibly, in the background.
+	Compressed int64
+}
+
+// WithProgress calls fn whenever member content has been consumed, when a
+// member is complete and once all data has been compressed on Close. It is
+// called on the goroutine adding members or closing the Writer.
+func WithProgress(fn func(Progress)) WriterOption {
+	return func(w *Writer) {
+		w.onProgress = fn
+	}
+}
+
+// WithContext makes the Writer stop compressing once ctx is done. Adding
+// members and closing the Writer then fail with the error of ctx, and any
+// temporary file is removed right away.
+func WithContext(ctx context.Context) WriterOption {
+	return func(w *Writer) {
+		w.ctx = ctx
+	}
+}
+
+// WithTempDir sets the directory of the temporary file holding compressed
+// data before it is written on Close. It defaults to os.TempDir.
+func WithTempDir(dir string) WriterOption {
+	return func(w *Writer) {
+		w.data.dir = dir
+	}
+}
+
+// WithReproducible makes the Cabinet file a function of the members added,
+// their content and the order they are added in, so that identical inputs
+// yield byte-identical output. All members are stamped with the modification
+// time t instead of FileHeader.Modified or the time passed to AddFile; the
+// zero time selects the earliest representable time, 1980-01-01 00:00:00.
+// Explicit FileHeader.DOSDate and DOSTime values are still honored. The
+// SetID header field is zero unless set explicitly using WithSetID, and the
+// compression is deterministic for a given compression method and level.
+func WithReproducible(t time.Time) WriterOption {
+	return func(w *Writer) {
+		w.modified = &t
+	}
+}
+
+// WithSetID sets the SetID header field, an arbitrary value which must be the
+// same for all Cabinet files of a multi-part set. It defaults to zero.
+func WithSetID(id uint16) WriterOption {
+	return func(w *Writer) {
+		w.setID = id
+	}
+}
+
+// WithCabinetIndex sets the ICabinet header field, the zero-based index of
+// the Cabinet file within a multi-part set. It defaults to zero.
+func WithCabinetIndex(i uint16) WriterOption {
+	return func(w *Writer) {
+		w.iCabinet = i
+	}
+}
+
+// WithReserve allocates zero-filled reserve areas of the given sizes in the
+// header, in every folder entry and in every data block. Tools signing
+// Cabinet files, like signtool, require a header reserve area to be present.
+// The header reserve area may hold up to 60000 bytes.
+func WithReserve(header uint16, folder, data uint8) WriterOption {
+	return func(w *Writer) {
+		w.reserveHeader = header
+		w.reserveFolder = folder
+		w.reserveData = data
+	}
+}
+
+// WithoutChecksums writes zero checksums, which readers treat as absent,
+// instead of computing the checksum of every data block.
+func WithoutChecksums() WriterOption {
+	return func(w *Writer) {
+		w.noChecksum = true
+	}
+}
+
+// NameEncoding selects how the Writer encodes member names.
+type NameEncoding int
+
+const (
+	// NameEncodingAuto writes names consisting of ASCII characters only as
+	// is and sets AttrNameIsUTF on all other names, which are written as
+	// UTF-8.
+	NameEncodingAuto NameEncoding = iota
+	// NameEncodingUTF writes all names as UTF-8 with AttrNameIsUTF set.
+	NameEncodingUTF
+	// NameEncodingOEM writes all names in code page 437 with AttrNameIsUTF
+	// cleared. Names with characters not in code page 437 are rejected.
+	NameEncodingOEM
+)
+
+// WithNameEncoding sets how member names are encoded. It defaults to
+// NameEncodingAuto, other encodings are mainly useful to test the
+// compatibility of extraction tools.
+func WithNameEncoding(e NameEncoding) WriterOption {
+	return func(w *Writer) {
+		w.nameEncoding = e
+	}
+}
+
+// encodeName returns the name as stored in the CFFILE entry and the
+// attributes adjusted to its encoding.
+func (w *Writer) encodeName(name string, attrs Attributes) (string, Attributes, error) {
+	switch w.nameEncoding {
+	case NameEncodingAuto:
+		if isASCII(name) {
+			return name, attrs &^ AttrNameIsUTF, nil
+		}
+	case NameEncodingUTF:
+	case NameEncodingOEM:
+		oem, err := encodeOEM(name)
+		return oem, attrs &^ AttrNameIsUTF, err
+	default:
+		return "", 0, fmt.Errorf("unknown name encoding %d", w.nameEncoding)
+	}
+	if !utf8.ValidString(name) {
+		return "", 0, fmt.Errorf("name %q is not valid UTF-8", name)
+	}
+	return name, attrs | AttrNameIsUTF, nil
+}
+
+// NewWriter returns a new Writer writing a Cabinet file to w.
+func NewWriter(w io.Writer, opts ...WriterOption) *Writer {
+	cw := &Writer{
+		w:       w,
+		level:   flate.DefaultCompression,
+		workers: runtime.GOMAXPROCS(0),
+		ctx:     context.Background(),
+	}
+	WithSolidFolder()(cw)
+	for _, opt := range opts {
+		opt(cw)
+	}
+	return cw
+}
+
+// RegisterCompressor registers or overrides a Compressor for the given
+// compression method for this Writer only. Compressors registered with the
+// package level RegisterCompressor function are used otherwise.
+func (w *Writer) RegisterCompressor(method CompressionType, comp Compressor) {
+	if w.compressors == nil {
+		w.compressors = make(map[CompressionType]Compressor)
+	}
+	w.compressors[method] = comp
+}
+
+func (w *Writer) compressor(c Compression) (BlockCompressor, error) {
+	comp := w.compressors[c.Type]
+	if comp == nil {
+		comp = compressor(c.Type)
+	}
+	if comp == nil {
+		return nil, fmt.Errorf("could not compress using %v: %w", c.Type, ErrUnsupportedCompression)
+	}
+	return comp(c, w.level)
+}
+
+// FileHeader describes a member to be added to a Cabinet file, or a member
+// returned by Cabinet.Next.
+type FileHeader struct {
+	// Name is the name of the member. Directories are separated by
+	// backslashes.
+	Name string
+
+	// Modified is the modification time of the member. It is stored with
+	// a resolution of two seconds.
+	Modified time.Time
+
+	// DOSDate and DOSTime, if either is non-zero, are stored verbatim as
+	// the MS-DOS date and time of the member instead of Modified.
+	DOSDate uint16
+	DOSTime uint16
+
+	// Attributes are stored as the attribute flags of the member, except
+	// for AttrNameIsUTF, which is set according to the NameEncoding.
+	Attributes Attributes
+
+	// Store places the member in an uncompressed folder regardless of the
+	// compression of the Writer.
+	Store bool
+
+	// Size is the size of the content of a member returned by Cabinet.Next.
+	// It is ignored by the Writer.
+	Size int64
+
+	// dosVerbatim stores DOSDate and DOSTime even if both are zero.
+	dosVerbatim bool
+}
+
+// Create adds a member of the given name to the Cabinet file, using the
+// current time as modification time and setting the archive attribute. It
+// returns a Writer to which the content of the member should be written.
+// The member's content must be written before the next call to Create,
+// CreateHeader, AddFile or Close.
+func (w *Writer) Create(name string) (io.Writer, error) {
+	return w.CreateHeader(&FileHeader{
+		Name:       name,
+		Modified:   time.Now(),
+		Attributes: AttrArchive,
+	})
+}
+
+// CreateHeader adds a member described by fh to the Cabinet file. It returns
+// a Writer to which the content of the member should be written. The
+// member's content must be written before the next call to Create,
+// CreateHeader, AddFile or Close. The Writer takes a copy of fh.
+func (w *Writer) CreateHeader(fh *FileHeader) (io.Writer, error) {
+	if w.closed {
+		return nil, errors.New("writer is closed")
+	}
+	if err := w.checkContext(); err != nil {
+		return nil, err
+	}
+	if fh.Name == "" {
+		return nil, errors.New("member name must not be empty")
+	}
+	name, attrs, err := w.encodeName(fh.Name, fh.Attributes)
+	if err != nil {
+		return nil, err
+	}
+	if strings.IndexByte(name, 0) >= 0 {
+		return nil, fmt.Errorf("name %q contains a NUL byte", fh.Name)
+	}
+	if len(name) >= maxNameSize {
+		return nil, fmt.Errorf("name %q exceeds %d bytes", fh.Name, maxNameSize-1)
+	}
+	if err := w.endMember(); err != nil {
+		return nil, err
+	}
+	if len(w.files) >= maxFiles {
+		return nil, ErrTooManyFiles
+	}
+	c := w.compression
+	if fh.Store || (w.autoStore && incompressibleName(fh.Name)) {
+		c = Compression{Type: CompressionNone}
+	}
+	var last *writerFolder
+	if len(w.fldrs) > 0 {
+		last = w.fldrs[len(w.fldrs)-1]
+	}
+	// Folders copied verbatim are ended right away.
+	if last == nil || last.ended || last.TypeCompress != c.typeCompress() || w.newFolder(last) {
+		if err := w.startFolder(c); err != nil {
+			return nil, err
+		}
+	}
+	fldr := w.fldrs[len(w.fldrs)-1]
+	fldr.files++
+	modified := fh.Modified
+	if w.modified != nil {
+		modified = *w.modified
+	}
+	date, tm := EncodeDOSTime(modified)
+	if fh.DOSDate != 0 || fh.DOSTime != 0 || fh.dosVerbatim {
+		date, tm = fh.DOSDate, fh.DOSTime
+	}
+	f := &file{
+		cfFile: &cfFile{
+			UOffFolderStart: uint32(fldr.size),
+			IFolder:         uint16(len(w.fldrs) - 1),
+			Date:            date,
+			Time:            tm,
+			Attribs:         uint16(attrs),
+		},
+		name: name,
+	}
+	w.files = append(w.files, f)
+	w.cur = &fileWriter{w: w, f: f, fldr: fldr}
+	return w.cur, nil
+}
+
+// AddFile adds a member of the given name to the Cabinet file, reading its
+// content from r until EOF. The content is streamed into the Cabinet file,
+// so r may be arbitrarily large. The modification time is stored with a
+// resolution of two seconds and the archive attribute is set.
+//
+// As content read before a failure has already been compressed, a failure
+// to read from r renders the Writer unusable.
+func (w *Writer) AddFile(name string, modified time.Time, r io.Reader) error {
+	fh := &FileHeader{Name: name, Modified: modified, Attributes: AttrArchive}
+	if w.autoStore {
+		br := bufio.NewReader(r)
+		head, _ := br.Peek(maxMagicSize)
+		fh.Store = incompressibleContent(head)
+		r = br
+	}
+	fw, err := w.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, r); err != nil {
+		if w.err == nil {
+			w.err = fmt.Errorf("could not read content of %q: %v", name, err)
+		}
+		return w.err
+	}
+	return nil
+}
+
+// AddFS adds all regular files of fsys to the Cabinet file, walking it in
+// lexical order. Member names are the slash-separated paths within fsys
+// converted to backslash form, and modification times are taken from the
+// files. Other file types, like directories and symbolic links, are skipped.
+func (w *Writer) AddFS(fsys fs.FS) error {
+	return w.addFS(fsys, func(string, fs.DirEntry) (bool, error) { return true, nil })
+}
+
+// DirOptions configures which files AddDir adds.
+type DirOptions struct {
+	// Include, if not empty, restricts the files added to those matching
+	// at least one of the patterns.
+	Include []string
+
+	// Exclude skips files and directories matching any of the patterns.
+	Exclude []string
+
+	// MaxDepth limits how deep AddDir descends: files directly within the
+	// directory are at depth 1. Zero means no limit.
+	MaxDepth int
+}
+
+// match reports whether the slash-separated path name matches any of the
+// patterns. Patterns use the syntax of path.Match and are matched against
+// the base name if they do not contain a slash, and against the whole path
+// otherwise.
+func match(patterns []string, name string) bool {
+	for _, p := range patterns {
+		target := path.Base(name)
+		if strings.Contains(p, "/") {
+			target = name
+		}
+		if ok, _ := path.Match(p, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AddDir adds the regular files within the directory tree rooted at dir to
+// the Cabinet file like AddFS, subject to opts, which may be nil.
+func (w *Writer) AddDir(dir string, opts *DirOptions) error {
+	if opts == nil {
+		opts = &DirOptions{}
+	}
+	for _, p := range append(append([]string(nil), opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+	}
+	return w.addFS(os.DirFS(dir), func(name string, d fs.DirEntry) (bool, error) {
+		if name == "." {
+			return true, nil
+		}
+		if match(opts.Exclude, name) {
+			if d.IsDir() {
+				return false, fs.SkipDir
+			}
+			return false, nil
+		}
+		if depth := strings.Count(name, "/") + 1; opts.MaxDepth > 0 && depth >= opts.MaxDepth && d.IsDir() {
+			return false, fs.SkipDir
+		}
+		if !d.IsDir() && len(opts.Include) > 0 && !match(opts.Include, name) {
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// addFS walks fsys in lexical order and adds all regular files accepted by
+// filter. The filter is also called for directories and may return
+// fs.SkipDir to skip them.
+func (w *Writer) addFS(fsys fs.FS, filter func(name string, d fs.DirEntry) (bool, error)) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ok, err := filter(name, d); !ok || err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return w.AddFile(strings.ReplaceAll(name, "/", `\`), info.ModTime(), f)
+	})
+}
+
+// fileWriter streams the content of a member into its folder.
+type fileWriter struct {
+	w    *Writer
+	f    *file
+	fldr *writerFolder
+	buf  []byte // content held back when deduplicating
+}
+
+func (fw *fileWriter) Write(p []byte) (int, error) {
+	if fw.w.cur != fw {
+		return 0, errors.New("write to member after a subsequent member was added or the writer was closed")
+	}
+	if err := fw.w.checkContext(); err != nil {
+		return 0, err
+	}
+	if err := fw.checkLimits(len(p)); err != nil {
+		fw.w.err = err
+		return 0, err
+	}
+	if fw.w.dedupe {
+		fw.buf = append(fw.buf, p...)
+	} else if err := fw.fldr.write(p); err != nil {
+		fw.w.err = fmt.Errorf("could not compress content of %q: %v", fw.f.name, err)
+		return 0, fw.w.err
+	}
+	fw.f.CBFile += uint32(len(p))
+	fw.w.progress.Bytes += int64(len(p))
+	fw.w.report()
+	return len(p), nil
+}
+
+// checkLimits reports whether writing n more bytes to the member would
+// exceed the limits of the Cabinet file format.
+func (fw *fileWriter) checkLimits(n int) error {
+	switch {
+	case int64(fw.f.CBFile)+int64(n) > maxFileSize:
+		return fmt.Errorf("could not add content to %q: %w", fw.f.name, ErrFileTooLarge)
+	case fw.fldr.size+int64(len(fw.buf))+int64(n) > maxFolderSize:
+		return fmt.Errorf("could not add content to %q: %w", fw.f.name, ErrFolderTooLarge)
+	case atomic.LoadInt64(&fw.w.compressed)+int64(n) > maxCabinetSize:
+		return fmt.Errorf("could not add content to %q: %w", fw.f.name, ErrCabinetTooLarge)
+	}
+	return nil
+}
+
+// startFolder completes the current folder, if any, and starts a new one.
+func (w *Writer) startFolder(c Compression) error {
+	if len(w.fldrs) >= maxFolders {
+		return ErrTooManyFolders
+	}
+	if err := w.endFolder(); err != nil {
+		return err
+	}
+	comp, err := w.compressor(c)
+	if err != nil {
+		return fmt.Errorf("could not create compressor: %v", err)
+	}
+	w.appendFolder(c.typeCompress(), comp)
+	return nil
+}
+
+// appendFolder appends a folder compressed by comp. Folders without a
+// BlockCompressor are written to by the caller right away.
+func (w *Writer) appendFolder(typeCompress uint16, comp BlockCompressor) *writerFolder {
+	fldr := &writerFolder{
+		cfFolder:   cfFolder{TypeCompress: typeCompress},
+		comp:       comp,
+		reserve:    w.reserveData,
+		noChecksum: w.noChecksum,
+		out:        &w.data,
+		emitted:    &w.compressed,
+		ctx:        w.ctx,
+	}
+	if w.workers > 1 {
+		if w.sem == nil {
+			w.sem = make(chan struct{}, w.workers)
+		}
+		// Only the first folder can be written to the spill right away,
+		// all others are stitched together in order once complete. Their
+		// offsets are set then, as the spill is being written to.
+		if len(w.fldrs) > 0 {
+			fldr.data = &spill{dir: w.data.dir}
+			fldr.out = fldr.data
+		}
+		if comp != nil {
+			fldr.background(w.sem)
+		}
+	}
+	if fldr.data == nil {
+		fldr.COFFCabStart = uint32(w.data.size)
+	}
+	w.fldrs = append(w.fldrs, fldr)
+	return fldr
+}
+
+// endFolder completes the current folder, if any.
+func (w *Writer) endFolder() error {
+	if len(w.fldrs) == 0 {
+		return nil
+	}
+	i := len(w.fldrs) - 1
+	if err := w.fldrs[i].end(); err != nil && w.err == nil {
+		w.err = fmt.Errorf("could not compress folder %d: %v", i, err)
+	}
+	return w.err
+}
+
+// endFolders completes the current folder, waits for the compression of
+// all folders and appends the data of folders compressed in the background
+// to the spill, in order.
+func (w *Writer) endFolders() error {
+	w.endFolder()
+	for i, fldr := range w.fldrs {
+		if err := fldr.wait(); err != nil && w.err == nil {
+			w.err = fmt.Errorf("could not compress folder %d: %v", i, err)
+		}
+	}
+	if w.err != nil {
+		return w.err
+	}
+	for i, fldr := range w.fldrs {
+		if fldr.data == nil {
+			continue
+		}
+		fldr.COFFCabStart = uint32(w.data.size)
+		if _, err := io.Copy(&w.data, fldr.data.section(0, fldr.data.size)); err != nil {
+			w.err = fmt.Errorf("could not copy data of folder %d: %v", i, err)
+			return w.err
+		}
+		if err := fldr.data.Close(); err != nil {
+			w.err = fmt.Errorf("could not remove temporary data of folder %d: %v", i, err)
+			return w.err
+		}
+		fldr.data = nil
+	}
+	return nil
+}
+
+// checkContext returns the sticky error, which it sets to the error of the
+// context of the Writer once it is done, aborting all compression.
+func (w *Writer) checkContext() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.ctx.Err(); err != nil {
+		w.err = err
+		if len(w.fldrs) > 0 {
+			w.fldrs[len(w.fldrs)-1].pending = nil
+		}
+		w.endFolder()
+		for _, fldr := range w.fldrs {
+			fldr.wait()
+		}
+		w.closeData()
+	}
+	return w.err
+}
+
+// closeData removes the temporary data of the Writer.
+func (w *Writer) closeData() error {
+	err := w.data.Close()
+	for _, fldr := range w.fldrs {
+		if fldr.data == nil {
+			continue
+		}
+		if cerr := fldr.data.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// write appends p to the folder, emitting a CFDATA block for every full
+// block of uncompressed data.
+func (f *writerFolder) write(p []byte) error {
+	for len(p) > 0 {
+		n := maxBlockSize - len(f.pending)
+		if n > len(p) {
+			n = len(p)
+		}
+		f.pending = append(f.pending, p[:n]...)
+		f.size += int64(n)
+		p = p[n:]
+		if len(f.pending) == maxBlockSize {
+			if err := f.emit(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// emit compresses the pending uncompressed data into a CFDATA block, or
+// hands it to the background compression.
+func (f *writerFolder) emit() error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	if f.work != nil {
+		f.work <- f.pending
+		f.pending = make([]byte, 0, maxBlockSize)
+		return nil
+	}
+	err := f.compressBlock(f.pending)
+	f.pending = f.pending[:0]
+	return err
+}
+
+// end emits the remaining uncompressed data of the folder.
+func (f *writerFolder) end() error {
+	if f.ended {
+		return nil
+	}
+	f.ended = true
+	err := f.emit()
+	if f.work != nil {
+		close(f.work)
+	}
+	return err
+}
+
+// background starts compressing the blocks of the folder in a goroutine,
+// holding a slot of sem while doing so.
+func (f *writerFolder) background(sem chan struct{}) {
+	f.work = make(chan []byte, 4)
+	f.done = make(chan struct{})
+	go func() {
+		defer close(f.done)
+		sem <- struct{}{}
+		defer func() { <-sem }()
+		for block := range f.work {
+			// Keep receiving after a failure so that the Writer never blocks.
+			if f.err == nil {
+				f.err = f.ctx.Err()
+			}
+			if f.err == nil {
+				f.err = f.compressBlock(block)
+			}
+		}
+	}()
+}
+
+// wait waits for the background compression of the folder, if any, and
+// returns its error.
+func (f *writerFolder) wait() error {
+	if f.done == nil {
+		return nil
+	}
+	<-f.done
+	return f.err
+}
+
+// compressBlock compresses block and writes it as a CFDATA block to the
+// output of the folder.
+func (f *writerFolder) compressBlock(block []byte) error {
+	cb, err := f.comp.Compress(block)
+	if err != nil {
+		return fmt.Errorf("could not compress data block %d: %v", f.CCFData, err)
+	}
+	d := cfData{CBData: uint16(len(cb)), CBUncomp: uint16(len(block))}
+	if !f.noChecksum {
+		d.Checksum = blockChecksum(&d, cb)
+	}
+	return f.writeBlock(&d, cb)
+}
+
+// writeBlock writes a CFDATA block with the given header and compressed data
+// to the output of the folder.
+func (f *writerFolder) writeBlock(d *cfData, cb []byte) error {
+	if err := binary.Write(f.out, binary.LittleEndian, d); err != nil {
+		return err
+	}
+	if _, err := f.out.Write(make([]byte, f.reserve)); err != nil {
+		return err
+	}
+	if _, err := f.out.Write(cb); err != nil {
+		return err
+	}
+	f.CCFData++
+	f.blocks = append(f.blocks, writerBlock{size: cfDataSize + uint32(f.reserve) + uint32(len(cb)), uncomp: d.CBUncomp})
+	atomic.AddInt64(f.emitted, int64(f.blocks[len(f.blocks)-1].size))
+	return nil
+}
+
+// endMember completes the most recently added member, if any.
+func (w *Writer) endMember() error {
+	if w.err != nil {
+		return w.err
+	}
+	fw := w.cur
+	if fw == nil {
+		return nil
+	}
+	w.cur = nil
+	if w.dedupe {
+		if err := w.dedupeMember(fw); err != nil {
+			return err
+		}
+	}
+	w.progress.Files++
+	w.report()
+	return nil
+}
+
+// report calls the progress callback, if any.
+func (w *Writer) report() {
+	if w.onProgress == nil {
+		return
+	}
+	p := w.progress
+	p.Compressed = atomic.LoadInt64(&w.compressed)
+	w.onProgress(p)
+}
+
+// dedupeMember writes the content of a member held back for deduplication,
+// unless the folder already holds identical content.
+func (w *Writer) dedupeMember(fw *fileWriter) error {
+	sum := sha256.Sum256(fw.buf)
+	if off, ok := fw.fldr.contents[sum]; ok {
+		fw.f.UOffFolderStart = off
+		fw.buf = nil
+		return nil
+	}
+	if fw.fldr.contents == nil {
+		fw.fldr.contents = make(map[[sha256.Size]byte]uint32)
+	}
+	fw.fldr.contents[sum] = fw.f.UOffFolderStart
+	err := fw.fldr.write(fw.buf)
+	fw.buf = nil
+	if err != nil {
+		w.err = fmt.Errorf("could not compress content of %q: %v", fw.f.name, err)
+	}
+	return w.err
+}
+
+// Close writes the Cabinet file and removes any temporary file. It does not
+// close the underlying writer, which does not need to be seekable.
+func (w *Writer) Close() error {
+	if w.closed {
+		return errors.New("writer is already closed")
+	}
+	defer w.closeData()
+	if err := w.finish(); err != nil {
+		return err
+	}
+
+	if w.data.size > maxCabinetSize {
+		return ErrCabinetTooLarge
+	}
+	cab := &cabinet{
+		hdr:      w.header(),
+		files:    w.files,
+		dataSize: uint32(w.data.size),
+	}
+	for _, fldr := range w.fldrs {
+		cab.fldrs = append(cab.fldrs, fldr.cfFolder)
+	}
+	return w.writeCabinet(w.w, cab, func() io.Reader { return w.data.section(0, w.data.size) })
+}
+
+// writeCabinet writes cab to out, taking the CFDATA blocks from a reader
+// returned by data, and signs it if the Writer has a signer. Signing reads
+// the blocks twice: once to compute the digest and once to write them.
+func (w *Writer) writeCabinet(out io.Writer, cab *cabinet, data func() io.Reader) error {
+	if w.signer == nil {
+		return cab.write(out, data())
+	}
+	if err := cab.layout(); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(cab.hdr.Reserve[4:], cab.hdr.CBCabinet)
+	h := w.signer.hash().New()
+	if err := cab.write(&digestWriter{h: h}, data()); err != nil {
+		return err
+	}
+	sig, err := w.signer.sign(h.Sum(nil))
+	if err != nil {
+		return fmt.Errorf("could not sign Cabinet file: %v", err)
+	}
+	binary.LittleEndian.PutUint32(cab.hdr.Reserve[8:], uint32(len(sig)))
+	if err := cab.write(out, data()); err != nil {
+		return err
+	}
+	if _, err := out.Write(sig); err != nil {
+		return fmt.Errorf("could not write signature: %v", err)
+	}
+	return nil
+}
+
+// finish marks the Writer as closed and compresses all remaining data.
+func (w *Writer) finish() error {
+	w.closed = true
+	err := w.checkContext()
+	if err == nil {
+		err = w.endMember()
+	}
+	w.cur = nil
+	if ferr := w.endFolders(); err == nil {
+		err = ferr
+	}
+	if err != nil {
+		return err
+	}
+	w.report()
+	if w.reserveHeader > maxHeaderReserve {
+		return fmt.Errorf("header reserve area of %d bytes exceeds the maximum of %d bytes", w.reserveHeader, maxHeaderReserve)
+	}
+	if w.signer != nil {
+		if w.reserveHeader != 0 {
+			return errors.New("cannot sign with a header reserve area allocated by WithReserve")
+		}
+		if err := w.signer.check(); err != nil {
+			return fmt.Errorf("invalid signer: %v", err)
+		}
+	}
+	// Report invalid compression settings even if there are no folders.
+	if _, err := w.compressor(w.compression); err != nil {
+		return fmt.Errorf("could not create compressor: %v", err)
+	}
+	return nil
+}
+
+// header returns the header fields common to all Cabinet files written.
+func (w *Writer) header() cfHeader {
+	h := cfHeader{
+		Signature:    [4]byte{'M', 'S', 'C', 'F'},
+		VersionMinor: 3,
+		VersionMajor: 1,
+		SetID:        w.setID,
+		ICabinet:     w.iCabinet,
+	}
+	reserveHeader := w.reserveHeader
+	if w.signer != nil {
+		reserveHeader = signatureReserveSize
+	}
+	if reserveHeader != 0 || w.reserveFolder != 0 || w.reserveData != 0 {
+		h.Flags |= hdrReservePresent
+		h.CBCFHeader = reserveHeader
+		h.CBCFFolder = w.reserveFolder
+		h.CBCFData = w.reserveData
+		h.Reserve = make([]byte, reserveHeader)
+		if w.signer != nil {
+			copy(h.Reserve, signatureMagic)
+		}
+	}
+	return h
+}
+
+// cabinet describes the structures of a Cabinet file to be written.
+type cabinet struct {
+	hdr      cfHeader
+	fldrs    []cfFolder // COFFCabStart is relative to the start of the data
+	files    []*file
+	dataSize uint32 // size of all CFDATA blocks
+}
+
+// foldersSize returns the size of the folder entries.
+func (c *cabinet) foldersSize() uint32 {
+	return uint32(len(c.fldrs)) * (cfFolderSize + uint32(c.hdr.CBCFFolder))
+}
+
+// size returns the size of the Cabinet file.
+func (c *cabinet) size() int64 {
+	n := int64(c.hdr.size()) + int64(c.foldersSize()) + int64(c.dataSize)
+	for _, f := range c.files {
+		n += int64(f.size())
+	}
+	return n
+}
+
+// layout lays out the Cabinet file: header, folders, files and data.
+func (c *cabinet) layout() error {
+	c.hdr.CFolders = uint16(len(c.fldrs))
+	c.hdr.CFiles = uint16(len(c.files))
+	c.hdr.COFFFiles = c.hdr.size() + c.foldersSize()
+	size := c.size()
+	if size > maxCabinetSize {
+		return ErrCabinetTooLarge
+	}
+	c.hdr.CBCabinet = uint32(size)
+	return nil
+}
+
+// write lays out the Cabinet file and writes it to w, taking the CFDATA
+// blocks from data.
+func (c *cabinet) write(w io.Writer, data io.Reader) error {
+	if err := c.layout(); err != nil {
+		return err
+	}
+	dataStart := c.hdr.CBCabinet - c.dataSize
+
+	if err := c.hdr.write(w); err != nil {
+		return fmt.Errorf("could not write header: %v", err)
+	}
+	for i, fldr := range c.fldrs {
+		fldr.COFFCabStart += dataStart
+		if err := binary.Write(w, binary.LittleEndian, &fldr); err != nil {
+			return fmt.Errorf("could not write folder %d: %v", i, err)
+		}
+		if _, err := w.Write(make([]byte, c.hdr.CBCFFolder)); err != nil {
+			return fmt.Errorf("could not write reserve area of folder %d: %v", i, err)
+		}
+	}
+	for _, f := range c.files {
+		if err := f.write(w); err != nil {
+			return fmt.Errorf("could not write file entry %q: %v", f.name, err)
+		}
+	}
+	if _, err := io.Copy(w, data); err != nil {
+		return fmt.Errorf("could not write folder data: %v", err)
+	}
+	return nil
+}
+
+// spill buffers data in memory and moves it to a temporary file once it
+// exceeds spillThreshold bytes.
+type spill struct {
+	dir  string // directory for the temporary file, os.TempDir if empty
+	mem  bytes.Buffer
+	f    *os.File
+	size int64
+}
+
+func (s *spill) Write(p []byte) (int, error) {
+	if s.f == nil && int64(s.mem.Len()+len(p)) > spillThreshold {
+		f, err := os.CreateTemp(s.dir, "cabfile")
+		if err != nil {
+			return 0, fmt.Errorf("could not create temporary file: %v", err)
+		}
+		s.f = f
+		if _, err := s.mem.WriteTo(s.f); err != nil {
+			return 0, fmt.Errorf("could not write to temporary file: %v", err)
+		}
+	}
+	var n int
+	var err error
+	if s.f != nil {
+		n, err = s.f.Write(p)
+	} else {
+		n, err = s.mem.Write(p)
+	}
+	s.size += int64(n)
+	return n, err
+}
+
+// section returns a reader for n bytes of the data written to s, starting at
+// offset off.
+func (s *spill) section(off, n int64) io.Reader {
+	if s.f == nil {
+		return bytes.NewReader(s.mem.Bytes()[off : off+n])
+	}
+	return io.NewSectionReader(s.f, off, n)
+}
+
+// Close removes the temporary file, if any.
+func (s *spill) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	s.f.Close()
+	err := os.Remove(s.f.Name())
+	s.f = nil
+	return err
+}
+
+// maxHeaderReserve is the maximum size of the header reserve area.
+const maxHeaderReserve = 60000
+
+// Sizes of the fixed-size portion of the Cabinet file structures.
+const (
+	cfHeaderSize = 36
+	cfFolderSize = 8
+	cfFileSize   = 16
+	cfDataSize   = 8
+)
+
+// size returns the serialized size of the header.
+func (h *cfHeader) size() uint32 {
+	n := uint32(cfHeaderSize)
+	if (h.Flags & hdrReservePresent) != 0 {
+		n += 4 + uint32(len(h.Reserve))
+	}
+	if (h.Flags & hdrPrevCabinet) != 0 {
+		n += uint32(len(h.CabinetPrev) + len(h.DiskPrev) + 2)
+	}
+	if (h.Flags & hdrNextCabinet) != 0 {
+		n += uint32(len(h.CabinetNext) + len(h.DiskNext) + 2)
+	}
+	return n
+}
+
+// size returns the serialized size of the file entry.
+func (f *file) size() uint32 {
+	return cfFileSize + uint32(len(f.name)) + 1
+}
+
+// write serializes the header, including the optional reserve area and the
+// names of the previous and next Cabinet files if the respective flags are
+// set.
+func (h *cfHeader) write(w io.Writer) error {
+	fields := []interface{}{
+		h.Signature, h.Reserved1, h.CBCabinet, h.Reserved2, h.COFFFiles,
+		h.Reserved3, h.VersionMinor, h.VersionMajor, h.CFolders, h.CFiles,
+		h.Flags, h.SetID, h.ICabinet,
+	}
+	if (h.Flags & hdrReservePresent) != 0 {
+		fields = append(fields, h.CBCFHeader, h.CBCFFolder, h.CBCFData, h.Reserve)
+	}
+	for _, f := range fields {
+		if err := binary.Write(w, binary.LittleEndian, f); err != nil {
+			return err
+		}
+	}
+	var names []string
+	if (h.Flags & hdrPrevCabinet) != 0 {
+		names = append(names, h.CabinetPrev, h.DiskPrev)
+	}
+	if (h.Flags & hdrNextCabinet) != 0 {
+		names = append(names, h.CabinetNext, h.DiskNext)
+	}
+	for _, n := range names {
+		if _, err := io.WriteString(w, n+"\x00"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// write serializes the file entry including its NUL-terminated name.
+func (f *file) write(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, f.cfFile); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, f.name+"\x00")
+	return err
+}
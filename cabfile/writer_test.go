@@ -0,0 +1,921 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// checkCabinet parses the Cabinet file in r and verifies that it holds
+// exactly the given files.
+func checkCabinet(t *testing.T, r io.ReadSeeker, files []testFile) *Cabinet {
+	t.Helper()
+	cab, err := New(r)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	var want []string
+	for _, f := range files {
+		want = append(want, f.name)
+	}
+	if got := cab.FileList(); !reflect.DeepEqual(got, want) {
+		t.Errorf("FileList() = %q; want %q", got, want)
+	}
+	for _, f := range files {
+		r, err := cab.Content(f.name)
+		if err != nil {
+			t.Fatalf("Content(%q) failed: %v", f.name, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("Reading content of %q failed: %v", f.name, err)
+		}
+		if !bytes.Equal(got, f.data) {
+			t.Errorf("Content(%q) = %d bytes; want %d bytes", f.name, len(got), len(f.data))
+		}
+	}
+	return cab
+}
+
+// writeCabinetData returns a Cabinet file holding the given files, written
+// using a Writer with the given options. The members are modified at the
+// zero time unless WithReproducible specifies another one.
+func writeCabinetData(t *testing.T, files []testFile, opts ...WriterOption) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, opts...)
+	for _, f := range files {
+		if err := w.AddFile(f.name, time.Time{}, bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// writeCabinet writes a Cabinet file as writeCabinetData does and parses it
+// using checkCabinet.
+func writeCabinet(t *testing.T, files []testFile, opts ...WriterOption) *Cabinet {
+	t.Helper()
+	return checkCabinet(t, bytes.NewReader(writeCabinetData(t, files, opts...)), files)
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []WriterOption
+	}{
+		{"none", nil},
+		{"mszip", []WriterOption{WithCompression(CompressionMSZIP)}},
+		{"mszip-best", []WriterOption{WithCompression(CompressionMSZIP), WithCompressionLevel(9)}},
+		{"mszip-solid", []WriterOption{WithCompression(CompressionMSZIP), WithSolidFolder()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			testWriterRoundTrip(t, tc.opts...)
+		})
+	}
+}
+
+func testWriterRoundTrip(t *testing.T, opts ...WriterOption) {
+	files := append(testFiles(), testFile{"large.bin", bytes.Repeat([]byte("0123456789abcdef"), 5000)})
+	tmpf, err := os.CreateTemp(t.TempDir(), "writer_test")
+	if err != nil {
+		t.Fatalf("Could not create temporary file: %v", err)
+	}
+	defer tmpf.Close()
+	// Some leading garbage to make sure offsets are relative to the start
+	// of the Cabinet file.
+	tmpf.WriteString("garbage")
+
+	w := NewWriter(tmpf, opts...)
+	mtime := time.Date(2019, 7, 1, 12, 30, 10, 0, time.UTC)
+	for _, f := range files {
+		if err := w.AddFile(f.name, mtime, bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if err := w.AddFile("late", mtime, bytes.NewReader(nil)); err == nil {
+		t.Error("AddFile() after Close() succeeded; want error")
+	}
+
+	data, err := os.ReadFile(tmpf.Name())
+	if err != nil {
+		t.Fatalf("Could not read back temporary file: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(data[len("garbage"):]), files)
+	if got, want := cab.hdr.CBCabinet, uint32(len(data)-len("garbage")); got != want {
+		t.Errorf("CBCabinet = %d; want %d", got, want)
+	}
+	if got, want := cab.fldrs[0].CCFData, uint16(3); got != want {
+		t.Errorf("CCFData = %d; want %d", got, want)
+	}
+	f := cab.files[0]
+	if f.Date != 0x4ee1 || f.Time != 0x63c5 {
+		t.Errorf("Date, Time = %#04x, %#04x; want 0x4ee1, 0x63c5", f.Date, f.Time)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	tmpf, err := os.CreateTemp(t.TempDir(), "writer_test")
+	if err != nil {
+		t.Fatalf("Could not create temporary file: %v", err)
+	}
+	defer tmpf.Close()
+	if err := NewWriter(tmpf).Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	tmpf.Seek(0, io.SeekStart)
+	checkCabinet(t, tmpf, nil)
+}
+
+func TestWriterInvalidCompression(t *testing.T) {
+	for _, opts := range [][]WriterOption{
+		{WithCompression(CompressionLZX)},
+		{WithCompression(CompressionMSZIP), WithCompressionLevel(42)},
+	} {
+		tmpf, err := os.CreateTemp(t.TempDir(), "writer_test")
+		if err != nil {
+			t.Fatalf("Could not create temporary file: %v", err)
+		}
+		defer tmpf.Close()
+		if err := NewWriter(tmpf, opts...).Close(); err == nil {
+			t.Error("Close() with invalid compression settings succeeded; want error")
+		}
+	}
+}
+
+// xorCompressor is a toy compression method flipping all bits.
+type xorCompressor struct{ buf []byte }
+
+func (c *xorCompressor) Compress(block []byte) ([]byte, error) {
+	c.buf = c.buf[:0]
+	for _, b := range block {
+		c.buf = append(c.buf, ^b)
+	}
+	return c.buf, nil
+}
+
+// writeLZXCabinet writes a Cabinet file holding the given files in a folder
+// declared as LZX compressed, which this package cannot decompress. The data
+// is really compressed by xorCompressor.
+func writeLZXCabinet(t *testing.T, files []testFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompressionParameters(Compression{Type: CompressionLZX, LZXWindow: 21}))
+	w.RegisterCompressor(CompressionLZX, func(Compression, int) (BlockCompressor, error) {
+		return &xorCompressor{}, nil
+	})
+	for _, f := range files {
+		if err := w.AddFile(f.name, time.Now(), bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriterRegisterCompressor(t *testing.T) {
+	tmpf, err := os.CreateTemp(t.TempDir(), "writer_test")
+	if err != nil {
+		t.Fatalf("Could not create temporary file: %v", err)
+	}
+	defer tmpf.Close()
+	var got Compression
+	w := NewWriter(tmpf, WithCompressionParameters(Compression{Type: CompressionLZX, LZXWindow: 21}))
+	w.RegisterCompressor(CompressionLZX, func(c Compression, level int) (BlockCompressor, error) {
+		got = c
+		return &xorCompressor{}, nil
+	})
+	if err := w.AddFile("a", time.Now(), bytes.NewReader([]byte{0x00, 0x0f})); err != nil {
+		t.Fatalf("AddFile() failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if want := (Compression{Type: CompressionLZX, LZXWindow: 21}); got != want {
+		t.Errorf("Compressor called with %v; want %v", got, want)
+	}
+
+	data, err := os.ReadFile(tmpf.Name())
+	if err != nil {
+		t.Fatalf("Could not read back temporary file: %v", err)
+	}
+	// The first CFFOLDER entry follows the 36 byte header.
+	if got := binary.LittleEndian.Uint16(data[36+6:]); got != 0x1503 {
+		t.Errorf("TypeCompress = %#04x; want 0x1503", got)
+	}
+	if !bytes.HasSuffix(data, []byte{0xff, 0xf0}) {
+		t.Errorf("Cabinet file ends in %x; want compressed data ff f0", data[len(data)-2:])
+	}
+}
+
+func TestWriterCreate(t *testing.T) {
+	tmpf, err := os.CreateTemp(t.TempDir(), "writer_test")
+	if err != nil {
+		t.Fatalf("Could not create temporary file: %v", err)
+	}
+	defer tmpf.Close()
+	w := NewWriter(tmpf, WithCompression(CompressionMSZIP))
+	files := testFiles()
+	var prev io.Writer
+	for i, f := range files {
+		var fw io.Writer
+		var err error
+		if i%2 == 0 {
+			fw, err = w.Create(f.name)
+		} else {
+			fw, err = w.CreateHeader(&FileHeader{Name: f.name, Modified: time.Now()})
+		}
+		if err != nil {
+			t.Fatalf("Creating member %q failed: %v", f.name, err)
+		}
+		// Write in small pieces to exercise streaming into the member.
+		for data := f.data; len(data) > 0; {
+			n := 7
+			if n > len(data) {
+				n = len(data)
+			}
+			if _, err := fw.Write(data[:n]); err != nil {
+				t.Fatalf("Writing to member %q failed: %v", f.name, err)
+			}
+			data = data[n:]
+		}
+		if prev != nil {
+			if _, err := prev.Write([]byte("stale")); err == nil {
+				t.Error("Writing to a previous member succeeded; want error")
+			}
+		}
+		prev = fw
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if _, err := prev.Write([]byte("stale")); err == nil {
+		t.Error("Writing to a member after Close() succeeded; want error")
+	}
+	tmpf.Seek(0, io.SeekStart)
+	checkCabinet(t, tmpf, files)
+}
+
+func TestWriterFolderGrouping(t *testing.T) {
+	files := append(testFiles(), testFile{"d.bin", bytes.Repeat([]byte{42}, 1000)})
+	for _, tc := range []struct {
+		name    string
+		opt     WriterOption
+		folders []uint16 // folder index of every file
+	}{
+		{"solid", WithSolidFolder(), []uint16{0, 0, 0, 0}},
+		{"per-file", WithFolderPerFile(), []uint16{0, 1, 2, 3}},
+		// a.txt holds 650 bytes, b.bin 800, c.txt 4 and d.bin 1000.
+		{"size", WithFolderSize(1000), []uint16{0, 0, 1, 1}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpf, err := os.CreateTemp(t.TempDir(), "writer_test")
+			if err != nil {
+				t.Fatalf("Could not create temporary file: %v", err)
+			}
+			defer tmpf.Close()
+			w := NewWriter(tmpf, WithCompression(CompressionMSZIP), tc.opt)
+			for _, f := range files {
+				if err := w.AddFile(f.name, time.Now(), bytes.NewReader(f.data)); err != nil {
+					t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() failed: %v", err)
+			}
+			tmpf.Seek(0, io.SeekStart)
+			cab := checkCabinet(t, tmpf, files)
+			var got []uint16
+			for _, f := range cab.files {
+				got = append(got, f.IFolder)
+			}
+			if !reflect.DeepEqual(got, tc.folders) {
+				t.Errorf("Folder indices = %v; want %v", got, tc.folders)
+			}
+		})
+	}
+}
+
+func TestWriterNonSeekable(t *testing.T) {
+	files := testFiles()
+	pr, pw := io.Pipe()
+	go func() {
+		w := NewWriter(pw, WithCompression(CompressionMSZIP), WithFolderPerFile())
+		for _, f := range files {
+			if err := w.AddFile(f.name, time.Now(), bytes.NewReader(f.data)); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(w.Close())
+	}()
+	data, err := io.ReadAll(pr)
+	if err != nil {
+		t.Fatalf("Writing to pipe failed: %v", err)
+	}
+	checkCabinet(t, bytes.NewReader(data), files)
+}
+
+func TestWriterSpill(t *testing.T) {
+	// Random data does not compress, so the folder data exceeds the spill
+	// threshold.
+	data := make([]byte, spillThreshold+maxBlockSize+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	files := []testFile{{"random.bin", data}, {"c.txt", []byte("tiny")}}
+
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(CompressionMSZIP), WithTempDir(dir))
+	for _, f := range files {
+		if err := w.AddFile(f.name, time.Now(), bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if w.data.f == nil {
+		t.Error("Compressed data was not spilled to a temporary file")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("Temporary directory holds %v after Close(); want no entries", entries)
+	}
+	checkCabinet(t, bytes.NewReader(buf.Bytes()), files)
+}
+
+// failingReader returns an error after handing out some data.
+type failingReader struct{ n int }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errors.New("read failed")
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriterStickyError(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	if err := w.AddFile("a", time.Now(), &failingReader{100}); err == nil {
+		t.Fatal("AddFile() with failing reader succeeded; want error")
+	}
+	if _, err := w.Create("b"); err == nil {
+		t.Error("Create() after failure succeeded; want error")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close() after failure succeeded; want error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Writer wrote %d bytes after failure; want none", buf.Len())
+	}
+}
+
+func TestWriterReproducible(t *testing.T) {
+	build := func(modified time.Time) []byte {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WithCompression(CompressionMSZIP), WithReproducible(time.Time{}))
+		for _, f := range testFiles() {
+			fw, err := w.CreateHeader(&FileHeader{Name: f.name, Modified: modified})
+			if err != nil {
+				t.Fatalf("CreateHeader(%q) failed: %v", f.name, err)
+			}
+			fw.Write(f.data)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() failed: %v", err)
+		}
+		return buf.Bytes()
+	}
+	a := build(time.Now())
+	b := build(time.Now().Add(time.Hour))
+	if !bytes.Equal(a, b) {
+		t.Error("Writer with WithReproducible() produced differing output for identical inputs")
+	}
+	cab := checkCabinet(t, bytes.NewReader(a), testFiles())
+	for _, f := range cab.files {
+		if f.Date != 1<<5|1 || f.Time != 0 {
+			t.Errorf("Date, Time of %q = %#04x, %#04x; want 0x0021, 0x0000", f.name, f.Date, f.Time)
+		}
+	}
+}
+
+func TestWriterFileHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, fh := range []*FileHeader{
+		{Name: "plain", Modified: time.Date(2019, 7, 1, 12, 30, 10, 0, time.UTC)},
+		{Name: "setup.exe", DOSDate: 0x4ee1, DOSTime: 0x63c5, Attributes: AttrReadOnly | AttrHidden | AttrExec},
+		{Name: "system", Attributes: AttrSystem | AttrArchive},
+	} {
+		if _, err := w.CreateHeader(fh); err != nil {
+			t.Fatalf("CreateHeader(%q) failed: %v", fh.Name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab, err := New(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	for i, want := range []cfFile{
+		{Date: 0x4ee1, Time: 0x63c5},
+		{Date: 0x4ee1, Time: 0x63c5, Attribs: uint16(AttrReadOnly | AttrHidden | AttrExec)},
+		{Date: 1<<5 | 1, Attribs: uint16(AttrSystem | AttrArchive)},
+	} {
+		if got := *cab.files[i].cfFile; got != want {
+			t.Errorf("File entry %d = %+v; want %+v", i, got, want)
+		}
+	}
+}
+
+func TestWriterAddFS(t *testing.T) {
+	mtime := time.Date(2019, 7, 1, 12, 30, 10, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"setup.inf":            {Data: []byte("[Version]\n"), ModTime: mtime},
+		"firmware/fw.bin":      {Data: bytes.Repeat([]byte{0xff}, 1000), ModTime: mtime},
+		"firmware/doc/readme":  {Data: []byte("read me"), ModTime: mtime},
+		"firmware/empty":       {Data: nil, ModTime: mtime},
+		"firmware/doc/symlink": {Data: []byte("readme"), Mode: fs.ModeSymlink},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(CompressionMSZIP))
+	if err := w.AddFS(fsys); err != nil {
+		t.Fatalf("AddFS() failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(buf.Bytes()), []testFile{
+		{`firmware\doc\readme`, []byte("read me")},
+		{`firmware\empty`, nil},
+		{`firmware\fw.bin`, bytes.Repeat([]byte{0xff}, 1000)},
+		{`setup.inf`, []byte("[Version]\n")},
+	})
+	for _, f := range cab.files {
+		if f.Date != 0x4ee1 || f.Time != 0x63c5 {
+			t.Errorf("Date, Time of %q = %#04x, %#04x; want 0x4ee1, 0x63c5", f.name, f.Date, f.Time)
+		}
+	}
+}
+
+func TestWriterAddDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"setup.inf":               "inf",
+		"notes.txt":               "notes",
+		"drivers/x64/driver.sys":  "sys64",
+		"drivers/x64/driver.inf":  "inf64",
+		"drivers/x86/driver.sys":  "sys86",
+		"drivers/x86/deep/a.inf":  "deep",
+		"build/cache/driver.inf":  "cache",
+		"drivers/x64/driver.pdb":  "symbols",
+		"drivers/x64/.gitignore":  "*.pdb",
+		"drivers/arm64/README.md": "readme",
+	} {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatalf("Could not create directory: %v", err)
+		}
+		if err := os.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatalf("Could not create file: %v", err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		opts *DirOptions
+		want []string
+	}{
+		{"include", &DirOptions{Include: []string{"*.inf", "*.sys"}, Exclude: []string{"build"}}, []string{
+			`drivers\x64\driver.inf`, `drivers\x64\driver.sys`, `drivers\x86\deep\a.inf`, `drivers\x86\driver.sys`, `setup.inf`,
+		}},
+		{"depth", &DirOptions{Include: []string{"*.inf", "*.sys"}, MaxDepth: 3}, []string{
+			`build\cache\driver.inf`, `drivers\x64\driver.inf`, `drivers\x64\driver.sys`, `drivers\x86\driver.sys`, `setup.inf`,
+		}},
+		{"top-level", &DirOptions{MaxDepth: 1}, []string{`notes.txt`, `setup.inf`}},
+		{"path-pattern", &DirOptions{Include: []string{"drivers/x64/*"}, Exclude: []string{".*", "*.pdb"}}, []string{
+			`drivers\x64\driver.inf`, `drivers\x64\driver.sys`,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewWriter(&buf)
+			if err := w.AddDir(dir, tc.opts); err != nil {
+				t.Fatalf("AddDir() failed: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() failed: %v", err)
+			}
+			cab, err := New(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			if got := cab.FileList(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("FileList() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+
+	if err := NewWriter(io.Discard).AddDir(dir, &DirOptions{Include: []string{"["}}); err == nil {
+		t.Error("AddDir() with invalid pattern succeeded; want error")
+	}
+}
+
+func TestWriterSetID(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithSetID(0x1234), WithCabinetIndex(3), WithReproducible(time.Time{}))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab, err := New(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	if got, want := cab.SetID(), uint16(0x1234); got != want {
+		t.Errorf("SetID() = %#04x; want %#04x", got, want)
+	}
+	if got, want := cab.CabinetIndex(), uint16(3); got != want {
+		t.Errorf("CabinetIndex() = %d; want %d", got, want)
+	}
+}
+
+func TestWriterReserve(t *testing.T) {
+	files := testFiles()
+
+	// The reader skips a header reserve area.
+	writeCabinet(t, files, WithReserve(6144, 0, 0))
+
+	data := writeCabinetData(t, files, WithCompression(CompressionNone), WithReserve(20, 4, 8))
+	c := parseRaw(t, data)
+	if c.hdr.Flags&hdrReservePresent == 0 {
+		t.Fatalf("Flags = %#04x; want reserve present flag", c.hdr.Flags)
+	}
+	if got, want := data[cfHeaderSize:cfHeaderSize+4], []byte{20, 0, 4, 8}; !bytes.Equal(got, want) {
+		t.Errorf("reserve sizes = %v; want %v", got, want)
+	}
+	fldrStart := uint32(cfHeaderSize + 4 + 20)
+	if got, want := c.hdr.COFFFiles, fldrStart+cfFolderSize+4; got != want {
+		t.Errorf("COFFFiles = %d; want %d", got, want)
+	}
+	coff := binary.LittleEndian.Uint32(data[fldrStart:])
+	payload := data[coff+cfDataSize+8:]
+	if want := files[0].data; !bytes.HasPrefix(payload, want) {
+		t.Errorf("first data block does not start with the content of %q after the reserve area", files[0].name)
+	}
+	if got, want := uint32(len(data)), c.hdr.CBCabinet; got != want {
+		t.Errorf("len(data) = %d; want CBCabinet %d", got, want)
+	}
+
+	if err := NewWriter(io.Discard, WithReserve(maxHeaderReserve+1, 0, 0)).Close(); err == nil {
+		t.Error("Close() with oversized header reserve succeeded; want error")
+	}
+}
+
+func TestWriterNameEncoding(t *testing.T) {
+	for _, tc := range []struct {
+		enc      NameEncoding
+		name     string
+		wantName string
+		wantUTF  bool
+		wantErr  bool
+	}{
+		{enc: NameEncodingAuto, name: `dir\plain.txt`, wantName: `dir\plain.txt`},
+		{enc: NameEncodingAuto, name: "straße.txt", wantName: "straße.txt", wantUTF: true},
+		{enc: NameEncodingAuto, name: "bad\xff.txt", wantErr: true},
+		{enc: NameEncodingUTF, name: "plain.txt", wantName: "plain.txt", wantUTF: true},
+		{enc: NameEncodingOEM, name: "straße.txt", wantName: "stra\xe1e.txt"},
+		{enc: NameEncodingOEM, name: "日本.txt", wantErr: true},
+		{enc: NameEncodingAuto, name: "nul\x00.txt", wantErr: true},
+		{enc: NameEncodingAuto, name: strings.Repeat("a", 255), wantName: strings.Repeat("a", 255)},
+		{enc: NameEncodingAuto, name: strings.Repeat("a", 256), wantErr: true},
+		{enc: NameEncodingAuto, name: strings.Repeat("ß", 128), wantErr: true},
+	} {
+		var buf bytes.Buffer
+		w := NewWriter(&buf, WithNameEncoding(tc.enc))
+		_, err := w.CreateHeader(&FileHeader{Name: tc.name, Attributes: AttrNameIsUTF})
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("CreateHeader(%q) with encoding %d succeeded; want error", tc.name, tc.enc)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("CreateHeader(%q) with encoding %d failed: %v", tc.name, tc.enc, err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() failed: %v", err)
+		}
+		c := parseRaw(t, buf.Bytes())
+		if got := c.names[0]; got != tc.wantName {
+			t.Errorf("Name of %q with encoding %d = %q; want %q", tc.name, tc.enc, got, tc.wantName)
+		}
+		if got := Attributes(c.files[0].Attribs)&AttrNameIsUTF != 0; got != tc.wantUTF {
+			t.Errorf("AttrNameIsUTF of %q with encoding %d = %t; want %t", tc.name, tc.enc, got, tc.wantUTF)
+		}
+	}
+}
+
+func TestWriterChecksums(t *testing.T) {
+	files := testFiles()
+	for _, tc := range []struct {
+		name string
+		opts []WriterOption
+		zero bool
+	}{
+		{name: "checksums", opts: []WriterOption{WithReserve(0, 0, 4)}},
+		{name: "without", opts: []WriterOption{WithoutChecksums()}, zero: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			data := writeCabinetData(t, files, tc.opts...)
+			c := parseRaw(t, data)
+			off := c.fldrs[0].COFFCabStart
+			for i := 0; i < int(c.fldrs[0].CCFData); i++ {
+				d := cfData{
+					Checksum: binary.LittleEndian.Uint32(data[off:]),
+					CBData:   binary.LittleEndian.Uint16(data[off+4:]),
+					CBUncomp: binary.LittleEndian.Uint16(data[off+6:]),
+				}
+				start := off + cfDataSize + uint32(c.hdr.CBCFData)
+				want := blockChecksum(&d, data[start:start+uint32(d.CBData)])
+				if tc.zero {
+					want = 0
+				}
+				if d.Checksum != want {
+					t.Errorf("Checksum of block %d = %#08x; want %#08x", i, d.Checksum, want)
+				}
+				off = start + uint32(d.CBData)
+			}
+		})
+	}
+}
+
+func TestWriterDeduplication(t *testing.T) {
+	drv := bytes.Repeat([]byte("driver payload "), 500)
+	files := []testFile{
+		{`x86\drv.sys`, drv},
+		{"readme.txt", []byte("read me")},
+		{`x64\drv.sys`, drv},
+		{"empty", nil},
+		{"copy.txt", []byte("read me")},
+	}
+	plain := writeCabinetData(t, files, WithCompression(CompressionNone))
+	deduped := writeCabinetData(t, files, WithCompression(CompressionNone), WithDeduplication())
+	if got, want := len(deduped), len(plain)-len(drv)-len("read me"); got != want {
+		t.Errorf("Size of deduplicated Cabinet file = %d; want %d", got, want)
+	}
+	cab := checkCabinet(t, bytes.NewReader(deduped), files)
+	if a, b := cab.files[0].UOffFolderStart, cab.files[2].UOffFolderStart; a != b {
+		t.Errorf("Offsets of identical members = %d and %d; want equal", a, b)
+	}
+
+	// Identical members in different folders are stored separately.
+	perFile := writeCabinetData(t, files, WithCompression(CompressionNone), WithFolderPerFile(), WithDeduplication())
+	checkCabinet(t, bytes.NewReader(perFile), files)
+	if got, want := len(perFile), len(writeCabinetData(t, files, WithCompression(CompressionNone), WithFolderPerFile())); got != want {
+		t.Errorf("Size with a folder per file = %d; want %d", got, want)
+	}
+	writeCabinet(t, files, WithDeduplication())
+}
+
+func TestWriterAutoStore(t *testing.T) {
+	text := bytes.Repeat([]byte("compressible text\n"), 100)
+	gz := append([]byte("\x1f\x8b\x08\x00"), make([]byte, 100)...)
+	files := []testFile{
+		{"a.txt", text},
+		{"archive.bin", gz},
+		{`pics\photo.JPG`, []byte("not really a JPEG")},
+		{"b.txt", text},
+		{"forced.txt", text},
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(CompressionMSZIP), WithAutoStore())
+	for _, f := range files[:4] {
+		if err := w.AddFile(f.name, time.Time{}, bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	fw, err := w.CreateHeader(&FileHeader{Name: files[4].name, Store: true})
+	if err != nil {
+		t.Fatalf("CreateHeader(%q) failed: %v", files[4].name, err)
+	}
+	fw.Write(files[4].data)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	cab := checkCabinet(t, bytes.NewReader(buf.Bytes()), files)
+	var got []CompressionType
+	for _, fi := range cab.Folders() {
+		got = append(got, fi.Compression.Type)
+	}
+	want := []CompressionType{CompressionMSZIP, CompressionNone, CompressionMSZIP, CompressionNone}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Folder compression = %v; want %v", got, want)
+	}
+}
+
+type failingCompressor struct{}
+
+func (failingCompressor) Compress([]byte) ([]byte, error) {
+	return nil, errors.New("compression failed")
+}
+
+func TestWriterConcurrency(t *testing.T) {
+	var files []testFile
+	for i := 0; i < 8; i++ {
+		data := bytes.Repeat([]byte{byte('a' + i), '\n'}, 20000+i*1000)
+		files = append(files, testFile{string(rune('a'+i)) + ".txt", data})
+	}
+	write := func(opts ...WriterOption) []byte {
+		return writeCabinetData(t, files, append([]WriterOption{WithCompression(CompressionMSZIP), WithFolderPerFile()}, opts...)...)
+	}
+
+	want := write(WithConcurrency(1))
+	dir := t.TempDir()
+	got := write(WithConcurrency(4), WithTempDir(dir))
+	if !bytes.Equal(got, want) {
+		t.Error("Output with concurrent compression differs from sequential compression")
+	}
+	checkCabinet(t, bytes.NewReader(got), files)
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("Temporary directory holds %v after Close(); want no entries", entries)
+	}
+
+	// A failure compressing a folder in the background is reported by Close.
+	w := NewWriter(io.Discard, WithConcurrency(4), WithFolderPerFile())
+	w.RegisterCompressor(CompressionNone, func(Compression, int) (BlockCompressor, error) {
+		if len(w.fldrs) == 2 {
+			return failingCompressor{}, nil
+		}
+		return storeCompressor{}, nil
+	})
+	for _, f := range files {
+		if err := w.AddFile(f.name, time.Time{}, bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close() with failing compressor succeeded; want error")
+	}
+}
+
+func TestWriterProgress(t *testing.T) {
+	files := testFiles()
+	var reports []Progress
+	var buf bytes.Buffer
+	w := NewWriter(&buf, WithCompression(CompressionMSZIP), WithProgress(func(p Progress) {
+		reports = append(reports, p)
+	}))
+	var total int64
+	for i, f := range files {
+		if err := w.AddFile(f.name, time.Time{}, bytes.NewReader(f.data)); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+		total += int64(len(f.data))
+		last := reports[len(reports)-1]
+		if last.Files != i || last.Bytes != total {
+			t.Errorf("Progress after adding %q = %+v; want %d files and %d bytes", f.name, last, i, total)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	c := parseRaw(t, buf.Bytes())
+	want := Progress{Files: len(files), Bytes: total, Compressed: int64(c.hdr.CBCabinet - c.fldrs[0].COFFCabStart)}
+	if got := reports[len(reports)-1]; got != want {
+		t.Errorf("Final progress = %+v; want %+v", got, want)
+	}
+	for i := 1; i < len(reports); i++ {
+		if p, q := reports[i-1], reports[i]; q.Files < p.Files || q.Bytes < p.Bytes || q.Compressed < p.Compressed {
+			t.Errorf("Progress went backwards from %+v to %+v", p, q)
+		}
+	}
+}
+
+// cancelingReader cancels a context after n bytes have been read.
+type cancelingReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (r *cancelingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.n -= n; r.n <= 0 {
+		r.cancel()
+	}
+	return n, err
+}
+
+func TestWriterContext(t *testing.T) {
+	data := make([]byte, spillThreshold+10*maxBlockSize)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, workers := range []int{1, 4} {
+		dir := t.TempDir()
+		ctx, cancel := context.WithCancel(context.Background())
+		w := NewWriter(io.Discard, WithContext(ctx), WithConcurrency(workers), WithTempDir(dir), WithFolderPerFile())
+		if err := w.AddFile("first.bin", time.Time{}, bytes.NewReader(data)); err != nil {
+			t.Fatalf("AddFile() failed: %v", err)
+		}
+		err := w.AddFile("second.bin", time.Time{}, &cancelingReader{r: bytes.NewReader(data), n: len(data) / 2, cancel: cancel})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("AddFile() with %d workers = %v; want %v", workers, err, context.Canceled)
+		}
+		if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+			t.Errorf("Temporary directory holds %v after cancellation with %d workers; want no entries", entries, workers)
+		}
+		if err := w.AddFile("third.bin", time.Time{}, bytes.NewReader(nil)); !errors.Is(err, context.Canceled) {
+			t.Errorf("AddFile() after cancellation = %v; want %v", err, context.Canceled)
+		}
+		if err := w.Close(); !errors.Is(err, context.Canceled) {
+			t.Errorf("Close() after cancellation = %v; want %v", err, context.Canceled)
+		}
+	}
+}
+
+func TestWriterLimits(t *testing.T) {
+	w := NewWriter(io.Discard, WithFolderPerFile())
+	for i := 0; i < maxFolders; i++ {
+		if _, err := w.Create("f"); err != nil {
+			t.Fatalf("Create() #%d failed: %v", i, err)
+		}
+	}
+	if _, err := w.Create("f"); !errors.Is(err, ErrTooManyFolders) {
+		t.Errorf("Create() exceeding the folder limit = %v; want %v", err, ErrTooManyFolders)
+	}
+
+	w = NewWriter(io.Discard)
+	for i := 0; i < maxFiles; i++ {
+		if _, err := w.Create("f"); err != nil {
+			t.Fatalf("Create() #%d failed: %v", i, err)
+		}
+	}
+	if _, err := w.Create("f"); !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("Create() exceeding the file limit = %v; want %v", err, ErrTooManyFiles)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Close() with %d files failed: %v", maxFiles, err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		setup func(w *Writer, fw *fileWriter)
+		want  error
+	}{
+		{"file", func(w *Writer, fw *fileWriter) { fw.f.CBFile = maxFileSize - 1 }, ErrFileTooLarge},
+		{"folder", func(w *Writer, fw *fileWriter) { fw.fldr.size = maxFolderSize - 1 }, ErrFolderTooLarge},
+		{"cabinet", func(w *Writer, fw *fileWriter) { w.compressed = maxCabinetSize - 1 }, ErrCabinetTooLarge},
+	} {
+		w := NewWriter(io.Discard)
+		fw, err := w.Create("big")
+		if err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+		tc.setup(w, fw.(*fileWriter))
+		if _, err := fw.Write([]byte("x")); err != nil {
+			t.Errorf("Write() up to the %s limit failed: %v", tc.name, err)
+		}
+		if _, err := fw.Write([]byte("xx")); !errors.Is(err, tc.want) {
+			t.Errorf("Write() exceeding the %s limit = %v; want %v", tc.name, err, tc.want)
+		}
+		if err := w.Close(); !errors.Is(err, tc.want) {
+			t.Errorf("Close() after exceeding the %s limit = %v; want %v", tc.name, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cabtest builds small Microsoft Cabinet files for tests. Unlike
+// cabfile.Writer, it gives full control over the block layout, checksums and
+// member names, so that code handling Cabinet files can be tested offline
+// against unusual and broken input.
+package cabtest
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/google/go-cabfile/cabfile"
+)
+
+// File is a member of a Cabinet file built.
+type File struct {
+	// Name is stored verbatim, so it may be empty or hold any bytes.
+	Name string
+	Data []byte
+
+	// Date and Time are stored verbatim as the MS-DOS date and time.
+	Date uint16
+	Time uint16
+
+	Attributes cabfile.Attributes
+}
+
+// Options configures the Cabinet file built. The zero value builds an
+// uncompressed Cabinet file with blocks of 32768 bytes and no checksums.
+type Options struct {
+	// Compression is either cabfile.CompressionNone or
+	// cabfile.CompressionMSZIP.
+	Compression cabfile.CompressionType
+
+	// BlockSize is the number of uncompressed bytes in every data block but
+	// the last. It defaults to and must not exceed 32768.
+	BlockSize int
+
+	// Checksums computes the checksums of the data blocks, which are left
+	// zero otherwise.
+	Checksums bool
+
+	// CorruptChecksums writes checksums not matching the data blocks.
+	CorruptChecksums bool
+
+	SetID        uint16
+	CabinetIndex uint16
+
+	// HeaderReserve, if not empty, is stored as the reserve area of the
+	// header.
+	HeaderReserve []byte
+}
+
+// Build returns a Cabinet file holding files in a single folder.
+func Build(opts Options, files ...File) ([]byte, error) {
+	blockSize := opts.BlockSize
+	if blockSize == 0 {
+		blockSize = 32768
+	}
+	if blockSize < 0 || blockSize > 32768 {
+		return nil, fmt.Errorf("invalid block size %d", blockSize)
+	}
+	if len(opts.HeaderReserve) > 60000 {
+		return nil, fmt.Errorf("header reserve area of %d bytes exceeds the maximum of 60000 bytes", len(opts.HeaderReserve))
+	}
+
+	var data []byte
+	for _, f := range files {
+		data = append(data, f.Data...)
+	}
+	var blocks bytes.Buffer
+	var nblocks int
+	var history []byte
+	for off := 0; off < len(data); off += blockSize {
+		end := off + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[off:end]
+		cb, err := compress(opts.Compression, chunk, history)
+		if err != nil {
+			return nil, fmt.Errorf("could not compress block %d: %v", nblocks, err)
+		}
+		history = chunk
+		var checksum uint32
+		if opts.Checksums || opts.CorruptChecksums {
+			checksum = cabfile.Checksum(cb, uint16(len(chunk)))
+		}
+		if opts.CorruptChecksums {
+			if checksum++; checksum == 0 {
+				checksum = 1
+			}
+		}
+		binary.Write(&blocks, binary.LittleEndian, checksum)
+		binary.Write(&blocks, binary.LittleEndian, []uint16{uint16(len(cb)), uint16(len(chunk))})
+		blocks.Write(cb)
+		nblocks++
+	}
+
+	const hdrSize, fldrSize, fileSize = 36, 8, 16
+	var flags uint16
+	coffFiles := hdrSize + fldrSize
+	if len(opts.HeaderReserve) > 0 {
+		flags |= 0x0004
+		coffFiles += 4 + len(opts.HeaderReserve)
+	}
+	coffCabStart := coffFiles
+	for _, f := range files {
+		coffCabStart += fileSize + len(f.Name) + 1
+	}
+
+	var buf bytes.Buffer
+	w := func(v interface{}) { binary.Write(&buf, binary.LittleEndian, v) }
+	buf.WriteString("MSCF")
+	w([]uint32{0, uint32(coffCabStart + blocks.Len()), 0, uint32(coffFiles), 0})
+	w([]uint8{3, 1})
+	w([]uint16{1, uint16(len(files)), flags, opts.SetID, opts.CabinetIndex})
+	if len(opts.HeaderReserve) > 0 {
+		w(uint16(len(opts.HeaderReserve)))
+		w([]uint8{0, 0})
+		buf.Write(opts.HeaderReserve)
+	}
+	w(uint32(coffCabStart))
+	w([]uint16{uint16(nblocks), uint16(opts.Compression)})
+	var off uint32
+	for _, f := range files {
+		w(uint32(len(f.Data)))
+		w(off)
+		w([]uint16{0, f.Date, f.Time, uint16(f.Attributes)})
+		buf.WriteString(f.Name)
+		buf.WriteByte(0)
+		off += uint32(len(f.Data))
+	}
+	buf.Write(blocks.Bytes())
+	return buf.Bytes(), nil
+}
+
+// compress compresses a block of data, using history as the preceding
+// uncompressed data of the folder.
+func compress(c cabfile.CompressionType, block, history []byte) ([]byte, error) {
+	switch c {
+	case cabfile.CompressionNone:
+		return block, nil
+	case cabfile.CompressionMSZIP:
+		var buf bytes.Buffer
+		buf.WriteString("CK")
+		fw, err := flate.NewWriterDict(&buf, flate.DefaultCompression, history)
+		if err != nil {
+			return nil, err
+		}
+		fw.Write(block)
+		if err := fw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported compression %v", c)
+}
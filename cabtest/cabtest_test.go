@@ -0,0 +1,92 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cabtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/google/go-cabfile/cabfile"
+)
+
+func TestBuild(t *testing.T) {
+	files := []File{
+		{Name: "a.txt", Data: bytes.Repeat([]byte("hello, world\n"), 100)},
+		{Name: "\xff\xfe weird.bin", Data: []byte{0, 1, 2, 3}},
+		{Name: "empty"},
+	}
+	for _, opts := range []Options{
+		{},
+		{Compression: cabfile.CompressionMSZIP, BlockSize: 100, Checksums: true},
+		{Compression: cabfile.CompressionNone, BlockSize: 7, HeaderReserve: []byte("signature"), SetID: 42},
+	} {
+		data, err := Build(opts, files...)
+		if err != nil {
+			t.Fatalf("Build(%+v) failed: %v", opts, err)
+		}
+		cab, err := cabfile.New(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("cabfile.New() with %+v failed: %v", opts, err)
+		}
+		if got, want := cab.SetID(), opts.SetID; got != want {
+			t.Errorf("SetID() with %+v = %d; want %d", opts, got, want)
+		}
+		for _, f := range files {
+			r, err := cab.Content(f.Name)
+			if err != nil {
+				t.Fatalf("Content(%q) with %+v failed: %v", f.Name, opts, err)
+			}
+			if got, _ := io.ReadAll(r); !bytes.Equal(got, f.Data) {
+				t.Errorf("Content(%q) with %+v = %q; want %q", f.Name, opts, got, f.Data)
+			}
+		}
+	}
+}
+
+func TestBuildChecksums(t *testing.T) {
+	file := File{Name: "a", Data: []byte("some data")}
+	sum := func(opts Options) uint32 {
+		data, err := Build(opts, file)
+		if err != nil {
+			t.Fatalf("Build(%+v) failed: %v", opts, err)
+		}
+		coffCabStart := binary.LittleEndian.Uint32(data[36:])
+		return binary.LittleEndian.Uint32(data[coffCabStart:])
+	}
+	if got := sum(Options{}); got != 0 {
+		t.Errorf("Checksum without Checksums = %#08x; want 0", got)
+	}
+	good := sum(Options{Checksums: true})
+	if want := cabfile.Checksum(file.Data, uint16(len(file.Data))); good != want {
+		t.Errorf("Checksum = %#08x; want %#08x", good, want)
+	}
+	if bad := sum(Options{CorruptChecksums: true}); bad == good || bad == 0 {
+		t.Errorf("Corrupt checksum = %#08x; want neither 0 nor %#08x", bad, good)
+	}
+}
+
+func TestBuildInvalid(t *testing.T) {
+	for _, opts := range []Options{
+		{BlockSize: 32769},
+		{Compression: cabfile.CompressionLZX},
+		{HeaderReserve: make([]byte, 60001)},
+	} {
+		if _, err := Build(opts, File{Name: "a", Data: []byte("a")}); err == nil {
+			t.Errorf("Build(%+v) succeeded; want error", opts)
+		}
+	}
+}
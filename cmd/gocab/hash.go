@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/google/go-cabfile/cabfile"
+)
+
+var hashAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// runHash prints a digest for every member of the given Cabinet file in the
+// format used by sha256sum and friends. Member content is streamed through
+// the hash and never written to disk.
+func runHash(args []string) error {
+	flags := flag.NewFlagSet("hash", flag.ExitOnError)
+	algo := flags.String("algo", "sha256", "digest algorithm: md5, sha1 or sha256")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return errors.New("expected exactly one Cabinet file argument")
+	}
+	newHash, ok := hashAlgorithms[*algo]
+	if !ok {
+		return fmt.Errorf("unsupported digest algorithm %q", *algo)
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cab, err := cabfile.New(f)
+	if err != nil {
+		return fmt.Errorf("could not parse %q: %v", flags.Arg(0), err)
+	}
+	return hashMembers(os.Stdout, cab, newHash)
+}
+
+// hashMembers writes a line with the digest and the name of every member of
+// cab to w, in the order of FileList. Members sharing a name each get a line
+// of their own.
+func hashMembers(w io.Writer, cab *cabfile.Cabinet, newHash func() hash.Hash) error {
+	for {
+		fh, err := cab.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		h := newHash()
+		if _, err := io.Copy(h, cab); err != nil {
+			return fmt.Errorf("could not hash member %q: %v", fh.Name, err)
+		}
+		fmt.Fprintf(w, "%x  %s\n", h.Sum(nil), fh.Name)
+	}
+}
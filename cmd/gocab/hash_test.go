@@ -0,0 +1,72 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"testing"
+	"time"
+
+	"github.com/google/go-cabfile/cabfile"
+)
+
+func TestHashMembers(t *testing.T) {
+	files := []struct{ name, data string }{
+		{"a.txt", "hello"},
+		{`dir\b.txt`, "world"},
+		{"a.txt", "duplicate"},
+	}
+	var buf bytes.Buffer
+	w := cabfile.NewWriter(&buf, cabfile.WithCompression(cabfile.CompressionMSZIP))
+	for _, f := range files {
+		if err := w.AddFile(f.name, time.Now(), bytes.NewReader([]byte(f.data))); err != nil {
+			t.Fatalf("AddFile(%q) failed: %v", f.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		algo    string
+		newHash func() hash.Hash
+		sum     func([]byte) []byte
+	}{
+		{"md5", md5.New, func(b []byte) []byte { s := md5.Sum(b); return s[:] }},
+		{"sha256", sha256.New, func(b []byte) []byte { s := sha256.Sum256(b); return s[:] }},
+	} {
+		t.Run(tc.algo, func(t *testing.T) {
+			cab, err := cabfile.New(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatalf("New() failed: %v", err)
+			}
+			var out bytes.Buffer
+			if err := hashMembers(&out, cab, tc.newHash); err != nil {
+				t.Fatalf("hashMembers() failed: %v", err)
+			}
+			var want string
+			for _, f := range files {
+				want += fmt.Sprintf("%x  %s\n", tc.sum([]byte(f.data)), f.name)
+			}
+			if got := out.String(); got != want {
+				t.Errorf("hashMembers() wrote\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
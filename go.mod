@@ -1,5 +1,5 @@
 module github.com/google/go-cabfile
 
-go 1.11
+go 1.23
 
 require github.com/blang/semver v3.5.1+incompatible
@@ -0,0 +1,188 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wsuscab allows to access the Windows Update offline scan Cabinet
+// file family (wsusscn2.cab). The outer Cabinet file carries an index and a
+// number of nested package Cabinet files, which in turn carry the update
+// metadata as XML.
+package wsuscab
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-cabfile/cabfile"
+)
+
+const (
+	indexName   = "index.xml"
+	packageName = "package.xml"
+)
+
+// ScanCabinet provides read-only access to a WSUS offline scan Cabinet file.
+type ScanCabinet struct {
+	*cabfile.Cabinet
+
+	Index *Index
+}
+
+// Index describes the nested package Cabinet files listed in index.xml.
+type Index struct {
+	Cabinets []IndexEntry `xml:"cablist>cab"`
+}
+
+// IndexEntry is a single nested Cabinet file listed in the index. Range is
+// the first update revision ID whose metadata is carried by that Cabinet.
+type IndexEntry struct {
+	Name  string `xml:"name,attr"`
+	Range int    `xml:"range,attr"`
+}
+
+// Package is the content of a package.xml file.
+type Package struct {
+	PackageID            string         `xml:"PackageId,attr"`
+	PackageVersion       string         `xml:"PackageVersion,attr"`
+	ProtocolVersion      string         `xml:"ProtocolVersion,attr"`
+	MinimumClientVersion string         `xml:"MinimumClientVersion,attr"`
+	SourceID             string         `xml:"SourceId,attr"`
+	CreationDate         string         `xml:"CreationDate,attr"`
+	Updates              []Update       `xml:"Updates>Update"`
+	FileLocations        []FileLocation `xml:"FileLocations>FileLocation"`
+}
+
+// Update describes a single update revision.
+type Update struct {
+	UpdateID        string     `xml:"UpdateId,attr"`
+	RevisionNumber  int        `xml:"RevisionNumber,attr"`
+	RevisionID      int        `xml:"RevisionId,attr"`
+	CreationDate    string     `xml:"CreationDate,attr"`
+	DefaultLanguage string     `xml:"DefaultLanguage,attr"`
+	IsLeaf          bool       `xml:"IsLeaf,attr"`
+	IsBundle        bool       `xml:"IsBundle,attr"`
+	Categories      []Category `xml:"Categories>Category"`
+	BundledBy       []Revision `xml:"BundledBy>Revision"`
+	PayloadFiles    []FileRef  `xml:"PayloadFiles>File"`
+}
+
+// Category assigns an update to a company, product or update classification.
+type Category struct {
+	Type string `xml:"Type,attr"`
+	ID   string `xml:"Id,attr"`
+}
+
+// Revision references another update revision by its revision ID.
+type Revision struct {
+	ID int `xml:"Id,attr"`
+}
+
+// FileRef references a payload file by its ID.
+type FileRef struct {
+	ID string `xml:"Id,attr"`
+}
+
+// FileLocation maps a payload file ID to its download URL.
+type FileLocation struct {
+	ID  string `xml:"Id,attr"`
+	URL string `xml:"Url,attr"`
+}
+
+// New returns a new ScanCabinet with the index already parsed.
+func New(r io.ReadSeeker) (*ScanCabinet, error) {
+	cab, err := cabfile.New(r)
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	if err := unmarshalMember(cab, indexName, &idx); err != nil {
+		return nil, err
+	}
+	return &ScanCabinet{
+		Cabinet: cab,
+		Index:   &idx,
+	}, nil
+}
+
+// Packages returns the names of all nested package Cabinet files, in the
+// order they are listed in the Cabinet file.
+func (s *ScanCabinet) Packages() []string {
+	var names []string
+	for _, fn := range s.FileList() {
+		if strings.HasSuffix(strings.ToLower(fn), ".cab") {
+			names = append(names, fn)
+		}
+	}
+	return names
+}
+
+// OpenCabinet returns the nested Cabinet file of the given name. The nested
+// Cabinet is held in memory in its entirety.
+func (s *ScanCabinet) OpenCabinet(name string) (*cabfile.Cabinet, error) {
+	r, err := s.Content(name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, fmt.Errorf("could not read nested Cabinet file %q: %v", name, err)
+	}
+	cab, err := cabfile.New(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse nested Cabinet file %q: %v", name, err)
+	}
+	return cab, nil
+}
+
+// Package opens the nested Cabinet file of the given name and parses the
+// package.xml file within.
+func (s *ScanCabinet) Package(name string) (*Package, error) {
+	cab, err := s.OpenCabinet(name)
+	if err != nil {
+		return nil, err
+	}
+	var p Package
+	if err := unmarshalMember(cab, packageName, &p); err != nil {
+		return nil, fmt.Errorf("nested Cabinet file %q: %v", name, err)
+	}
+	return &p, nil
+}
+
+// unmarshalMember parses the XML member of the given name into v.
+func unmarshalMember(cab *cabfile.Cabinet, name string, v interface{}) error {
+	var found bool
+	for _, fn := range cab.FileList() {
+		if fn == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return errors.New("WSUS cabinet does not contain required " + name)
+	}
+	r, err := cab.Content(name)
+	if err != nil {
+		return fmt.Errorf("could not get content of %q: %v", name, err)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return fmt.Errorf("could not read from %q: %v", name, err)
+	}
+	if err := xml.Unmarshal(buf.Bytes(), v); err != nil {
+		return fmt.Errorf("could not parse %q: %v", name, err)
+	}
+	return nil
+}
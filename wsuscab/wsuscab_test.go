@@ -0,0 +1,94 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wsuscab
+
+import (
+	"encoding/xml"
+	"reflect"
+	"testing"
+)
+
+func TestIndexParsing(t *testing.T) {
+	const testData = `<?xml version="1.0" encoding="utf-8"?>
+<index xmlns="http://schemas.microsoft.com/msus/2004/02/OfflineSync">
+  <cablist>
+    <cab name="package2.cab" range="100"/>
+    <cab name="package3.cab" range="250"/>
+  </cablist>
+</index>`
+	want := Index{
+		Cabinets: []IndexEntry{
+			{Name: "package2.cab", Range: 100},
+			{Name: "package3.cab", Range: 250},
+		},
+	}
+	var idx Index
+	if err := xml.Unmarshal([]byte(testData), &idx); err != nil {
+		t.Fatalf("Could not parse embedded XML data: %v", err)
+	}
+	if !reflect.DeepEqual(idx, want) {
+		t.Errorf("xml.Unmarshal = %#+v; want %#+v", idx, want)
+	}
+}
+
+func TestPackageParsing(t *testing.T) {
+	const testData = `<?xml version="1.0" encoding="utf-8"?>
+<OfflineSyncPackage xmlns="http://schemas.microsoft.com/msus/2004/02/OfflineSync" PackageId="abc" PackageVersion="1.1" ProtocolVersion="1.0" MinimumClientVersion="5.8.0.2678" SourceId="def" CreationDate="2019-01-01T00:00:00Z">
+  <Updates>
+    <Update CreationDate="2018-12-01T00:00:00Z" DefaultLanguage="en" UpdateId="0123" RevisionNumber="201" RevisionId="42" IsLeaf="true" IsBundle="true">
+      <Categories>
+        <Category Type="Company" Id="56309036"/>
+      </Categories>
+      <BundledBy>
+        <Revision Id="41"/>
+      </BundledBy>
+      <PayloadFiles>
+        <File Id="file1"/>
+      </PayloadFiles>
+    </Update>
+  </Updates>
+  <FileLocations>
+    <FileLocation Id="file1" Url="http://download.windowsupdate.com/file1.cab"/>
+  </FileLocations>
+</OfflineSyncPackage>`
+	want := Package{
+		PackageID:            "abc",
+		PackageVersion:       "1.1",
+		ProtocolVersion:      "1.0",
+		MinimumClientVersion: "5.8.0.2678",
+		SourceID:             "def",
+		CreationDate:         "2019-01-01T00:00:00Z",
+		Updates: []Update{{
+			UpdateID:        "0123",
+			RevisionNumber:  201,
+			RevisionID:      42,
+			CreationDate:    "2018-12-01T00:00:00Z",
+			DefaultLanguage: "en",
+			IsLeaf:          true,
+			IsBundle:        true,
+			Categories:      []Category{{Type: "Company", ID: "56309036"}},
+			BundledBy:       []Revision{{ID: 41}},
+			PayloadFiles:    []FileRef{{ID: "file1"}},
+		}},
+		FileLocations: []FileLocation{{ID: "file1", URL: "http://download.windowsupdate.com/file1.cab"}},
+	}
+	var p Package
+	if err := xml.Unmarshal([]byte(testData), &p); err != nil {
+		t.Fatalf("Could not parse embedded XML data: %v", err)
+	}
+	if !reflect.DeepEqual(p, want) {
+		t.Errorf("xml.Unmarshal = %#+v; want %#+v", p, want)
+	}
+}